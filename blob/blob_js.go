@@ -81,3 +81,64 @@ func (r *blobReader) Read(b []byte) (int, error) {
 	r.pos = end
 	return n, nil
 }
+
+// ChunkReader returns the reader loading the blob by chunks.
+// Unlike Reader, whole data is not loaded at once,
+// and JavaScript event loop runs while loading each chunk.
+func (blob Blob) ChunkReader(chunkSize int) io.Reader {
+	return &blobChunkReader{
+		blob:      js.Value(blob),
+		size:      js.Value(blob).Get("size").Int(),
+		chunkSize: chunkSize,
+	}
+}
+
+type blobChunkReader struct {
+	blob      js.Value
+	size      int
+	chunkSize int
+	pos       int
+	buf       []byte
+}
+
+func (r *blobChunkReader) Read(b []byte) (int, error) {
+	if len(r.buf) == 0 {
+		if r.pos == r.size {
+			return 0, io.EOF
+		}
+		if err := r.load(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *blobChunkReader) load() error {
+	end := r.pos + r.chunkSize
+	if end > r.size {
+		end = r.size
+	}
+	chErr := make(chan error, 1)
+	onLoad := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		array := js.Global().Get("Uint8Array").New(args[0])
+		r.buf = make([]byte, array.Get("byteLength").Int())
+		js.CopyBytesToGo(r.buf, array)
+		chErr <- nil
+		return nil
+	})
+	defer onLoad.Release()
+	onError := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		chErr <- errors.New("failed to read blob")
+		return nil
+	})
+	defer onError.Release()
+	r.blob.Call("slice", r.pos, end).Call("arrayBuffer").Call("then", onLoad, onError)
+
+	if err := <-chErr; err != nil {
+		return err
+	}
+	r.pos = end
+	return nil
+}
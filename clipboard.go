@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+var errClipboardEmpty = errors.New("clipboard is empty")
+
+// clipboard keeps the copied points with all fields of the main cloud
+// in their original coordinates.
+type clipboard struct {
+	pp *pc.PointCloud
+	// origin is the bottom center of the bounding box of the points
+	// which is placed on the cursor when pasting at the cursor.
+	origin mat.Vec3
+	// box is the cursors of the rectangle or box selection.
+	// It is nil if the points are copied from the mask selection.
+	box []mat.Vec3
+}
+
+// Copy copies the selected points to the clipboard.
+// It returns the number of the copied points.
+func (c *commandContext) Copy() (int, error) {
+	if c.selectMode == selectModeInsert {
+		return 0, errors.New("selection is not available in insert mode")
+	}
+	indice, err := c.selectedIndice()
+	if err != nil {
+		return 0, err
+	}
+	selected := make([]bool, c.editor.pp.Points)
+	for _, i := range indice {
+		selected[i] = true
+	}
+	pp, err := passThrough(c.editor.pp, func(i int, _ mat.Vec3) bool {
+		return selected[i]
+	})
+	if err != nil {
+		return 0, err
+	}
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		return 0, err
+	}
+	min, max, err := pc.MinMaxVec3(it)
+	if err != nil {
+		return 0, err
+	}
+	var box []mat.Vec3
+	if c.selectMode == selectModeRect {
+		box = append(box, c.selected...)
+	}
+	c.clipboard = &clipboard{
+		pp:     pp,
+		origin: mat.Vec3{(min[0] + max[0]) / 2, (min[1] + max[1]) / 2, min[2]},
+		box:    box,
+	}
+	return pp.Points, nil
+}
+
+// Clipboard returns the number of the points and the origin of the clipboard.
+func (c *commandContext) Clipboard() (int, mat.Vec3, bool) {
+	if c.clipboard == nil {
+		return 0, mat.Vec3{}, false
+	}
+	return c.clipboard.pp.Points, c.clipboard.origin, true
+}
+
+// Paste starts inserting the clipboard points at their original position.
+func (c *commandContext) Paste() error {
+	return c.paste(mat.Vec3{})
+}
+
+// PasteAt starts inserting the clipboard points with the origin placed at p.
+func (c *commandContext) PasteAt(p mat.Vec3) error {
+	if c.clipboard == nil {
+		return errClipboardEmpty
+	}
+	return c.paste(p.Sub(c.clipboard.origin))
+}
+
+func (c *commandContext) paste(offset mat.Vec3) error {
+	if c.clipboard == nil {
+		return errClipboardEmpty
+	}
+	if c.editor.pp == nil {
+		return errors.New("must have base cloud")
+	}
+	// Sub cloud is transformed in place when it is merged.
+	src := c.clipboard.pp
+	pp := newPointCloudLike(src, src.Points)
+	copy(pp.Data, src.Data)
+	if err := c.editor.SetPointCloud(pp, cloudSub); err != nil {
+		return err
+	}
+
+	c.selectMode = selectModeInsert
+	c.hasMaskSelection = false
+	c.transformIndice = nil
+	c.pasteBox = c.clipboard.box
+	c.selected = []mat.Vec3{
+		offset,
+		offset.Add(mat.Vec3{1, 0, 0}),
+		offset.Add(mat.Vec3{0, 1, 0}),
+		offset.Add(mat.Vec3{0, 0, 1}),
+	}
+	c.updateRect()
+
+	c.subPointCloudUpdated = true
+	return nil
+}
+
+// PasteRepeat adds n copies of the clipboard points translated by offset, 2*offset, ..., n*offset
+// as one edit. It returns the number of the added points.
+func (c *commandContext) PasteRepeat(offset mat.Vec3, n int) (int, error) {
+	if c.clipboard == nil {
+		return 0, errClipboardEmpty
+	}
+	if c.editor.pp == nil {
+		return 0, errors.New("must have base cloud")
+	}
+	if n < 1 {
+		return 0, errors.New("number of copies must be positive")
+	}
+	src := c.clipboard.pp
+	pp := newPointCloudLike(src, src.Points*n)
+	stride := src.Stride()
+	for k := 0; k < n; k++ {
+		copy(pp.Data[k*src.Points*stride:], src.Data[:src.Points*stride])
+	}
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; it.IsValid(); i++ {
+		it.SetVec3(it.Vec3().Add(offset.Mul(float32(i/src.Points + 1))))
+		it.Incr()
+	}
+	h := c.editor.pp.PointCloudHeader
+	if pp, err = convertFields(pp, &h); err != nil {
+		return 0, err
+	}
+	if err := c.editor.merge(c.newJournal("paste_repeat", offset[0], offset[1], offset[2], float32(n)), pp); err != nil {
+		return 0, err
+	}
+	c.setPointCloudUpdated()
+	return pp.Points, nil
+}
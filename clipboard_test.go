@@ -0,0 +1,144 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestClipboard(t *testing.T) {
+	// vecs: (1, 2, 3), (4, 5, 6), (7, 8, 9) labeled 0, 1, 2
+	newConsole := func(t *testing.T) *console {
+		c := &console{cmd: newCommandContext(&dummyPCDIO{}, nil)}
+		if err := c.cmd.editor.SetPointCloud(createPointCloud(t, false), cloudMain); err != nil {
+			t.Fatal(err)
+		}
+		// Select the 2nd and 3rd points
+		c.cmd.SetSelectMask([]uint32{0, selectBitmaskSegmentSelected, selectBitmaskSegmentSelected})
+		c.cmd.selectMode = selectModeMask
+		res, err := c.Run("copy", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([][]float32{{2}}, res) {
+			t.Fatalf("Expected [[2]], got %v", res)
+		}
+		c.cmd.UnsetCursors()
+		return c
+	}
+	labels := func(t *testing.T, c *console) []uint32 {
+		lt, err := c.cmd.editor.pp.Uint32Iterator("label")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ls []uint32
+		for i := 0; i < c.cmd.editor.pp.Points; i++ {
+			ls = append(ls, lt.Uint32At(i))
+		}
+		return ls
+	}
+	orig := []mat.Vec3{{1, 2, 3}, {4, 5, 6}, {7, 8, 9}}
+
+	t.Run("Info", func(t *testing.T) {
+		c := newConsole(t)
+		res, err := c.Run("clipboard", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([][]float32{{2, 5.5, 6.5, 6}}, res) {
+			t.Errorf("Expected [[2 5.5 6.5 6]], got %v", res)
+		}
+	})
+	t.Run("PasteInPlace", func(t *testing.T) {
+		c := newConsole(t)
+		if _, err := c.Run("paste", noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		if c.cmd.SelectMode() != selectModeInsert {
+			t.Fatal("Expected insert mode")
+		}
+		if err := c.cmd.FinalizeCurrentMode(); err != nil {
+			t.Fatal(err)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, append(orig, orig[1:]...))
+		if ls := labels(t, c); !reflect.DeepEqual([]uint32{0, 1, 2, 1, 2}, ls) {
+			t.Errorf("Labels must be copied, got %v", ls)
+		}
+
+		// Clipboard must not be modified by the paste
+		if err := c.cmd.PasteAt(mat.Vec3{5.5, 6.5, 0}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.cmd.FinalizeCurrentMode(); err != nil {
+			t.Fatal(err)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, append(append(orig, orig[1:]...), mat.Vec3{4, 5, 0}, mat.Vec3{7, 8, 3}))
+	})
+	t.Run("PasteAtCursor", func(t *testing.T) {
+		c := newConsole(t)
+		c.cmd.SetCursor(0, mat.Vec3{0, 0, 0})
+		if _, err := c.Run("paste_at", noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		c.cmd.TransformCursors(mat.Translate(0, 0, 1))
+		if err := c.cmd.FinalizeCurrentMode(); err != nil {
+			t.Fatal(err)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, append(orig, mat.Vec3{-1.5, -1.5, 1}, mat.Vec3{1.5, 1.5, 4}))
+	})
+	t.Run("PasteRepeat", func(t *testing.T) {
+		c := newConsole(t)
+		res, err := c.Run("paste_repeat 10 0 0 2", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([][]float32{{4}}, res) {
+			t.Errorf("Expected [[4]], got %v", res)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, append(orig,
+			mat.Vec3{14, 5, 6}, mat.Vec3{17, 8, 9},
+			mat.Vec3{24, 5, 6}, mat.Vec3{27, 8, 9},
+		))
+		if ls := labels(t, c); !reflect.DeepEqual([]uint32{0, 1, 2, 1, 2, 1, 2}, ls) {
+			t.Errorf("Labels must be copied, got %v", ls)
+		}
+		if j, _ := c.cmd.Journal(); len(j) != 1 {
+			t.Errorf("Expected 1 history entry, got %d", len(j))
+		}
+		if !c.cmd.Undo() {
+			t.Fatal("Undo failed")
+		}
+		expectPointCloud(t, c.cmd.editor.pp, orig)
+	})
+	t.Run("SelectPastedBox", func(t *testing.T) {
+		c := newConsole(t)
+		box := []mat.Vec3{{0, 0, 0}, {2, 0, 0}, {2, 2, 0}}
+		for i, p := range box {
+			c.cmd.SetCursor(i, p)
+		}
+		c.cmd.SetSelectMask([]uint32{selectBitmaskSelected, 0, 0})
+		if _, err := c.cmd.Copy(); err != nil {
+			t.Fatal(err)
+		}
+		c.cmd.UnsetCursors()
+		if err := c.cmd.PasteAt(mat.Vec3{11, 12, 3}); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.cmd.FinalizeCurrentMode(); err != nil {
+			t.Fatal(err)
+		}
+		expected := []mat.Vec3{{10, 10, 0}, {12, 10, 0}, {12, 12, 0}}
+		if curs := c.cmd.Cursors(); !reflect.DeepEqual(expected, curs) {
+			t.Errorf("Expected cursors %v, got %v", expected, curs)
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		c := newTestConsole(t, orig...)
+		for _, cmd := range []string{"clipboard", "paste", "paste_at 0 0 0", "paste_repeat 1 0 0 1"} {
+			if _, err := c.Run(cmd, noUpdate); err != errClipboardEmpty {
+				t.Errorf("Expected error %v on %s, got %v", errClipboardEmpty, cmd, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+	"github.com/seqsense/pcgol/pc/storage/kdtree"
+)
+
+// euclideanClusters splits the points into the clusters
+// in which the points are connected within the tolerance.
+// The clusters are sorted by the size in descending order.
+func euclideanClusters(ra pc.Vec3RandomAccessor, tolerance float32) [][]int {
+	kdt := kdtree.New(ra)
+	n := ra.Len()
+	visited := make([]bool, n)
+	var out [][]int
+	for i := 0; i < n; i++ {
+		if visited[i] {
+			continue
+		}
+		visited[i] = true
+		cluster := []int{i}
+		for j := 0; j < len(cluster); j++ {
+			for _, nb := range kdt.Range(ra.Vec3At(cluster[j]), tolerance) {
+				if !visited[nb.ID] {
+					visited[nb.ID] = true
+					cluster = append(cluster, nb.ID)
+				}
+			}
+		}
+		out = append(out, cluster)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return len(out[i]) > len(out[j])
+	})
+	return out
+}
+
+// clusterHistogram returns the number of the clusters and the points
+// in the size ranges of power of 2 (1, 2-3, 4-7, ...).
+func clusterHistogram(clusters [][]int) [][3]int {
+	var hist [][3]int // [min size, clusters, points]
+	for i := len(clusters) - 1; i >= 0; i-- {
+		size := len(clusters[i])
+		if len(hist) == 0 || size >= hist[len(hist)-1][0]*2 {
+			min := 1
+			for min*2 <= size {
+				min *= 2
+			}
+			hist = append(hist, [3]int{min, 0, 0})
+		}
+		hist[len(hist)-1][1]++
+		hist[len(hist)-1][2] += size
+	}
+	return hist
+}
+
+// clustersInCrop runs the Euclidean clustering on the points in the crop box.
+// Returned clusters have the indices of the whole cloud.
+// Selection mask must be updated before calling it to exclude the cropped points.
+func (c *commandContext) clustersInCrop(tolerance float32) ([][]int, error) {
+	if tolerance <= 0 {
+		return nil, errors.New("tolerance must be positive")
+	}
+	if err := c.checkSelectMask(); err != nil {
+		return nil, err
+	}
+	it, err := c.editor.pp.Vec3Iterator()
+	if err != nil {
+		return nil, err
+	}
+	var indice []int
+	for i, m := range c.selectMask {
+		if m&selectBitmaskCropped == 0 {
+			indice = append(indice, i)
+		}
+	}
+	clusters := euclideanClusters(pc.NewIndiceVec3RandomAccessor(it, indice), tolerance)
+	for _, cl := range clusters {
+		for i, id := range cl {
+			cl[i] = indice[id]
+		}
+	}
+	return clusters, nil
+}
+
+// PreviewClusters returns the summary of the clusters in the crop box
+// and the histogram of the cluster sizes without editing the cloud.
+func (c *commandContext) PreviewClusters(tolerance float32, minSize, maxSize int) ([]string, error) {
+	clusters, err := c.clustersInCrop(tolerance)
+	if err != nil {
+		return nil, err
+	}
+	var smaller, larger int
+	for _, cl := range clusters {
+		switch {
+		case len(cl) < minSize:
+			smaller++
+		case len(cl) > maxSize:
+			larger++
+		}
+	}
+	lines := []string{
+		fmt.Sprintf("clusters: %d (in size range: %d, smaller: %d, larger: %d)",
+			len(clusters), len(clusters)-smaller-larger, smaller, larger),
+	}
+	for _, h := range clusterHistogram(clusters) {
+		lines = append(lines, fmt.Sprintf("size %d-%d: %d clusters, %d points", h[0], h[0]*2-1, h[1], h[2]))
+	}
+	return lines, nil
+}
+
+// LabelClusters sets the labels starting from l to the clusters in the crop box
+// having the size in the range in descending order of the size.
+// It returns the number of the labeled clusters.
+func (c *commandContext) LabelClusters(l uint32, tolerance float32, minSize, maxSize int) (int, error) {
+	clusters, err := c.clustersInCrop(tolerance)
+	if err != nil {
+		return 0, err
+	}
+	labels := make([]uint32, c.editor.pp.Points)
+	labeled := make([]bool, c.editor.pp.Points)
+	var n int
+	for _, cl := range clusters {
+		if len(cl) < minSize || maxSize < len(cl) {
+			continue
+		}
+		for _, i := range cl {
+			labels[i], labeled[i] = l+uint32(n), true
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	err = c.editor.label(
+		c.newJournal("label_clusters", float32(l), tolerance, float32(minSize), float32(maxSize)),
+		func(i int, _ mat.Vec3) (uint32, bool) {
+			return labels[i], labeled[i]
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	c.setPointCloudUpdated()
+	return n, nil
+}
+
+// DeleteClusters deletes the clusters in the crop box smaller than minSize.
+// It returns the number of the deleted clusters.
+func (c *commandContext) DeleteClusters(tolerance float32, minSize int) (int, error) {
+	clusters, err := c.clustersInCrop(tolerance)
+	if err != nil {
+		return 0, err
+	}
+	del := make([]bool, c.editor.pp.Points)
+	var n int
+	for _, cl := range clusters {
+		if len(cl) >= minSize {
+			continue
+		}
+		for _, i := range cl {
+			del[i] = true
+		}
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	err = c.editor.passThrough(
+		c.newJournal("delete_clusters", tolerance, float32(minSize)),
+		func(i int, _ mat.Vec3) bool {
+			return !del[i]
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	// indices are changed
+	if c.selectMode == selectModeMask {
+		c.clearMaskSelection()
+	}
+	c.hasMaskSelection = false
+	c.setPointCloudUpdated()
+	return n, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+// clusterTestCloud returns a line of 8 points (index 0-7), a line of 3 points (index 8-10)
+// and an isolated point (index 11).
+func clusterTestCloud() []mat.Vec3 {
+	var vs []mat.Vec3
+	for i := 0; i < 8; i++ {
+		vs = append(vs, mat.Vec3{float32(i) * 0.1, 0, 0})
+	}
+	for i := 0; i < 3; i++ {
+		vs = append(vs, mat.Vec3{float32(i) * 0.1, 5, 0})
+	}
+	return append(vs, mat.Vec3{5, 5, 5})
+}
+
+func TestEuclideanClusters(t *testing.T) {
+	pp := createXYZCloud(t, clusterTestCloud()...)
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clusters := euclideanClusters(it, 0.15)
+	for _, cl := range clusters {
+		sort.Ints(cl)
+	}
+	expected := [][]int{{0, 1, 2, 3, 4, 5, 6, 7}, {8, 9, 10}, {11}}
+	if !reflect.DeepEqual(expected, clusters) {
+		t.Errorf("Expected %v, got %v", expected, clusters)
+	}
+
+	expectedHist := [][3]int{{1, 1, 1}, {2, 1, 3}, {8, 1, 8}}
+	if hist := clusterHistogram(clusters); !reflect.DeepEqual(expectedHist, hist) {
+		t.Errorf("Expected histogram %v, got %v", expectedHist, hist)
+	}
+}
+
+func TestClusterCommands(t *testing.T) {
+	vs := clusterTestCloud()
+	t.Run("Preview", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		res, err := c.Run("cluster_preview 0.15 2 5", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []string{
+			"clusters: 3 (in size range: 1, smaller: 1, larger: 1)",
+			"size 1-1: 1 clusters, 1 points",
+			"size 2-3: 1 clusters, 3 points",
+			"size 8-15: 1 clusters, 8 points",
+		}
+		if !reflect.DeepEqual(expected, res) {
+			t.Errorf("Expected %v, got %v", expected, res)
+		}
+		if j, _ := c.cmd.Journal(); len(j) != 0 {
+			t.Error("Preview must not be recorded in the history")
+		}
+	})
+	t.Run("Label", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		res, err := c.Run("cluster_label 10 0.15 1 5", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([][]float32{{2}}, res) {
+			t.Errorf("Expected [[2]], got %v", res)
+		}
+		lt, err := c.cmd.editor.pp.Uint32Iterator("label")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range vs {
+			var expected uint32
+			switch {
+			case 8 <= i && i <= 10:
+				expected = 10
+			case i == 11:
+				expected = 11
+			}
+			if l := lt.Uint32At(i); l != expected {
+				t.Errorf("Expected label %d at %d, got %d", expected, i, l)
+			}
+		}
+	})
+	t.Run("Delete", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		// Crop the isolated point
+		c.cmd.SelectMask()[11] = selectBitmaskCropped
+		res, err := c.Run("cluster_delete 0.15 4", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([][]float32{{1}}, res) {
+			t.Errorf("Expected [[1]], got %v", res)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, append(append([]mat.Vec3{}, vs[:8]...), vs[11]))
+		if !c.cmd.Undo() {
+			t.Fatal("Undo failed")
+		}
+		expectPointCloud(t, c.cmd.editor.pp, vs)
+	})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"github.com/seqsense/pcgol/pc"
+)
+
+type colorMode int
+
+const (
+	colorModeLabel colorMode = iota // label color if in the render label range, otherwise z
+	colorModeZ
+	colorModeIntensity
+	colorModeRGB
+	colorModeNormal
+)
+
+var colorModeNames = []string{"label", "z", "intensity", "rgb", "normal"}
+
+func (m colorMode) String() string {
+	return colorModeNames[m]
+}
+
+type colormap int
+
+const (
+	colormapViridis colormap = iota
+	colormapJet
+	colormapGray
+)
+
+var colormapNames = []string{"viridis", "jet", "gray"}
+
+func (m colormap) String() string {
+	return colormapNames[m]
+}
+
+const (
+	defaultIntensityMin = 0.0
+	defaultIntensityMax = 255.0
+)
+
+// colorField is the layout of the field fed to the shader as aColorField.
+type colorField struct {
+	offset     int
+	typ        string
+	size       int
+	count      int
+	normalized bool
+
+	// separate is true if the color is stored in red, green and blue fields.
+	// They are packed as normalized B, G, R, A bytes in the render buffer.
+	separate    bool
+	channels    [3]int // offsets of red, green and blue
+	channelType string
+	channelSize int
+}
+
+var intensityFieldNames = []string{"intensity", "reflectivity"}
+
+// colorFieldOf returns the field used to color the points in the mode.
+// false is returned if the cloud doesn't have the field or the mode doesn't use the field.
+func colorFieldOf(h *pc.PointCloudHeader, m colorMode) (colorField, bool) {
+	switch m {
+	case colorModeIntensity:
+		for _, name := range intensityFieldNames {
+			i := fieldIndex(h, name, 0)
+			if i < 0 {
+				continue
+			}
+			switch {
+			case h.Type[i] == "F" && h.Size[i] == 4,
+				h.Type[i] == "U" && (h.Size[i] == 1 || h.Size[i] == 2 || h.Size[i] == 4):
+			default:
+				continue
+			}
+			off, _ := fieldOffsetAt(h, i)
+			return colorField{offset: off, typ: h.Type[i], size: h.Size[i], count: 1}, true
+		}
+	case colorModeRGB:
+		for _, name := range []string{"rgb", "rgba"} {
+			i := fieldIndex(h, name, 0)
+			if i < 0 || h.Size[i] != 4 || h.Count[i] != 1 {
+				continue
+			}
+			// Packed as 0x00RRGGBB (or 0xAARRGGBB) in little endian,
+			// and fed as normalized B, G, R, A bytes.
+			off, _ := fieldOffsetAt(h, i)
+			return colorField{offset: off, typ: "U", size: 1, count: 4, normalized: true}, true
+		}
+		// Separate channels stored by LAS, PLY and text formats
+		cf := colorField{typ: "U", size: 1, count: 4, normalized: true, separate: true}
+		for k, name := range []string{"red", "green", "blue"} {
+			i := fieldIndex(h, name, 0)
+			if i < 0 || h.Count[i] != 1 || !isNumericType(h.Type[i], h.Size[i]) {
+				return colorField{}, false
+			}
+			if k > 0 && (h.Type[i] != cf.channelType || h.Size[i] != cf.channelSize) {
+				return colorField{}, false
+			}
+			cf.channels[k], _ = fieldOffsetAt(h, i)
+			cf.channelType, cf.channelSize = h.Type[i], h.Size[i]
+		}
+		return cf, true
+	case colorModeNormal:
+		i := fieldIndex(h, "normal_x", 0)
+		if i < 0 || i+2 >= len(h.Fields) {
+			return colorField{}, false
+		}
+		for j, name := range []string{"normal_x", "normal_y", "normal_z"} {
+			if h.Fields[i+j] != name || h.Type[i+j] != "F" || h.Size[i+j] != 4 || h.Count[i+j] != 1 {
+				return colorField{}, false
+			}
+		}
+		off, _ := fieldOffsetAt(h, i)
+		return colorField{offset: off, typ: "F", size: 4, count: 3}, true
+	}
+	return colorField{}, false
+}
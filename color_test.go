@@ -0,0 +1,136 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+func TestColorFieldOf(t *testing.T) {
+	testCases := map[string]struct {
+		header   pc.PointCloudHeader
+		mode     colorMode
+		expected colorField
+		ok       bool
+	}{
+		"Intensity": {
+			header: pc.PointCloudHeader{
+				Fields: []string{"x", "y", "z", "label", "intensity"},
+				Size:   []int{4, 4, 4, 4, 2},
+				Type:   []string{"F", "F", "F", "U", "U"},
+				Count:  []int{1, 1, 1, 1, 1},
+			},
+			mode:     colorModeIntensity,
+			expected: colorField{offset: 16, typ: "U", size: 2, count: 1},
+			ok:       true,
+		},
+		"Reflectivity": {
+			header: pc.PointCloudHeader{
+				Fields: []string{"x", "y", "z", "label", "reflectivity"},
+				Size:   []int{4, 4, 4, 4, 4},
+				Type:   []string{"F", "F", "F", "U", "F"},
+				Count:  []int{1, 1, 1, 1, 1},
+			},
+			mode:     colorModeIntensity,
+			expected: colorField{offset: 16, typ: "F", size: 4, count: 1},
+			ok:       true,
+		},
+		"UnsupportedIntensityType": {
+			header: pc.PointCloudHeader{
+				Fields: []string{"x", "y", "z", "label", "intensity"},
+				Size:   []int{4, 4, 4, 4, 8},
+				Type:   []string{"F", "F", "F", "U", "F"},
+				Count:  []int{1, 1, 1, 1, 1},
+			},
+			mode: colorModeIntensity,
+		},
+		"RGB": {
+			header: pc.PointCloudHeader{
+				Fields: []string{"x", "y", "z", "label", "_", "rgb"},
+				Size:   []int{4, 4, 4, 4, 1, 4},
+				Type:   []string{"F", "F", "F", "U", "U", "F"},
+				Count:  []int{1, 1, 1, 1, 4, 1},
+			},
+			mode:     colorModeRGB,
+			expected: colorField{offset: 20, typ: "U", size: 1, count: 4, normalized: true},
+			ok:       true,
+		},
+		"SeparateRGB": {
+			header: pc.PointCloudHeader{
+				Fields: []string{"x", "y", "z", "label", "red", "green", "blue"},
+				Size:   []int{4, 4, 4, 4, 2, 2, 2},
+				Type:   []string{"F", "F", "F", "U", "U", "U", "U"},
+				Count:  []int{1, 1, 1, 1, 1, 1, 1},
+			},
+			mode: colorModeRGB,
+			expected: colorField{
+				typ: "U", size: 1, count: 4, normalized: true,
+				separate: true, channels: [3]int{16, 18, 20}, channelType: "U", channelSize: 2,
+			},
+			ok: true,
+		},
+		"Normal": {
+			header: pc.PointCloudHeader{
+				Fields: []string{"x", "y", "z", "label", "normal_x", "normal_y", "normal_z"},
+				Size:   []int{4, 4, 4, 4, 4, 4, 4},
+				Type:   []string{"F", "F", "F", "U", "F", "F", "F"},
+				Count:  []int{1, 1, 1, 1, 1, 1, 1},
+			},
+			mode:     colorModeNormal,
+			expected: colorField{offset: 16, typ: "F", size: 4, count: 3},
+			ok:       true,
+		},
+		"NonContiguousNormal": {
+			header: pc.PointCloudHeader{
+				Fields: []string{"x", "y", "z", "label", "normal_x", "normal_y", "curvature", "normal_z"},
+				Size:   []int{4, 4, 4, 4, 4, 4, 4, 4},
+				Type:   []string{"F", "F", "F", "U", "F", "F", "F", "F"},
+				Count:  []int{1, 1, 1, 1, 1, 1, 1, 1},
+			},
+			mode: colorModeNormal,
+		},
+		"NoField": {
+			header: pc.PointCloudHeader{
+				Fields: []string{"x", "y", "z", "label"},
+				Size:   []int{4, 4, 4, 4},
+				Type:   []string{"F", "F", "F", "U"},
+				Count:  []int{1, 1, 1, 1},
+			},
+			mode: colorModeRGB,
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			cf, ok := colorFieldOf(&tt.header, tt.mode)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok=%v, got: %v", tt.ok, ok)
+			}
+			if cf != tt.expected {
+				t.Errorf("Expected %+v, got: %+v", tt.expected, cf)
+			}
+		})
+	}
+}
+
+func TestCommandContext_SetColorMode(t *testing.T) {
+	c := newCommandContext(nil, nil)
+	if err := c.SetColorMode(colorModeRGB); err != nil {
+		t.Errorf("Color mode must be settable before loading: %v", err)
+	}
+	if err := c.editor.SetPointCloud(createPointCloud(t, true), cloudMain); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetColorMode(colorModeIntensity); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetColorMode(colorModeRGB); err == nil {
+		t.Error("Expected error on missing rgb field")
+	}
+	if m := c.ColorMode(); m != colorModeIntensity {
+		t.Errorf("Expected %s, got: %s", colorModeIntensity, m)
+	}
+	if err := c.SetIntensityRange(10, 10); err == nil {
+		t.Error("Expected error on empty intensity range")
+	}
+}
@@ -44,8 +44,8 @@ const (
 )
 
 type pcdIO interface {
-	importPCD(blob interface{}) (*pc.PointCloud, error)
-	exportPCD(pp *pc.PointCloud) (interface{}, error)
+	importPCD(blob interface{}, opts formatOptions) (*pc.PointCloud, error)
+	exportPCD(pp *pc.PointCloud, opts formatOptions) (interface{}, error)
 }
 
 type mapIO interface {
@@ -84,6 +84,10 @@ type commandContext struct {
 	rect        []mat.Vec3
 	rectCenter  []mat.Vec3
 
+	polygonUpdated           bool
+	polygon                  []mat.Vec3
+	polygonZMin, polygonZMax float32
+
 	mapInfo *occupancyGrid
 	mapImg  mapImage
 
@@ -96,12 +100,41 @@ type commandContext struct {
 	numFastRenderPoints int
 
 	selectMode selectMode
+	selectOp   selectOp
+	// hasMaskSelection is true if selectBitmaskSegmentSelected bits are kept
+	// to be combined with the next selection.
+	hasMaskSelection bool
+
+	// transformIndice is the indices of the points being transformed
+	// in insert mode started by BeginTransformSelected.
+	transformIndice []int
+	transformRev    uint64
+
+	// clipboard is kept across Reset to paste the points to another cloud.
+	clipboard *clipboard
+	// pasteBox is the selection box of the clipboard points being pasted.
+	pasteBox []mat.Vec3
 
 	segmentationDistance, segmentationRange float32
 
 	labelSegmentationRange, labelSegmentationSearchDistance float32
 
+	groundParam groundParam
+	planeLabels planeLabels
+
 	renderLabelMin, renderLabelMax uint32
+
+	colorMode                  colorMode
+	colormap                   colormap
+	intensityMin, intensityMax float32
+
+	labelTable        *labelTable
+	labelPalette      []byte
+	labelTableUpdated bool
+
+	tiles *tileSet
+
+	selections namedSelections
 }
 
 func newCommandContext(pcdio pcdIO, mapio mapIO) *commandContext {
@@ -110,6 +143,7 @@ func newCommandContext(pcdio pcdIO, mapio mapIO) *commandContext {
 		pcdIO:  pcdio,
 		mapIO:  mapio,
 	}
+	c.SetLabelTable(defaultLabelTable())
 	c.Reset()
 	return c
 }
@@ -123,9 +157,16 @@ func (c *commandContext) Reset() {
 	c.selected = nil
 	c.selectedStack = nil
 	c.selectMask = nil
+	c.selectOp = selectOpReplace
+	c.hasMaskSelection = false
+	c.transformIndice = nil
+	c.pasteBox = nil
 	c.rectUpdated = true
 	c.rect = nil
 	c.rectCenter = nil
+	c.unsetPolygon()
+	c.polygonZMin = float32(math.Inf(-1))
+	c.polygonZMax = float32(math.Inf(1))
 	c.mapInfo = nil
 	c.mapImg = nil
 	c.selectRangeOrtho = defaultSelectRangeOrtho
@@ -140,8 +181,15 @@ func (c *commandContext) Reset() {
 	c.segmentationRange = defaultSegmentationRange
 	c.labelSegmentationRange = defaultLabelSegmentationRange
 	c.labelSegmentationSearchDistance = defaultLabelSegmentationSearchDistance
+	c.groundParam = defaultGroundParam
+	c.planeLabels = planeLabels{}
 	c.renderLabelMin = 1
 	c.renderLabelMax = math.MaxUint32
+	c.colorMode = colorModeLabel
+	c.colormap = colormapViridis
+	c.intensityMin = defaultIntensityMin
+	c.intensityMax = defaultIntensityMax
+	c.tiles = nil
 }
 
 func (c *commandContext) SelectMask() []uint32 {
@@ -244,6 +292,70 @@ func (c *commandContext) SetRenderLabelRange(min, max uint32) error {
 	return nil
 }
 
+func (c *commandContext) ColorMode() colorMode {
+	return c.colorMode
+}
+
+// SetColorMode sets the mode to color the points.
+// It fails if the loaded cloud doesn't have the field used by the mode.
+func (c *commandContext) SetColorMode(m colorMode) error {
+	if c.editor.pp != nil {
+		if _, ok := colorFieldOf(&c.editor.pp.PointCloudHeader, m); !ok && m != colorModeLabel && m != colorModeZ {
+			return fmt.Errorf("point cloud doesn't have %s field", m)
+		}
+	}
+	c.colorMode = m
+	return nil
+}
+
+func (c *commandContext) Colormap() colormap {
+	return c.colormap
+}
+
+func (c *commandContext) SetColormap(m colormap) {
+	c.colormap = m
+}
+
+func (c *commandContext) IntensityRange() (float32, float32) {
+	return c.intensityMin, c.intensityMax
+}
+
+func (c *commandContext) SetIntensityRange(min, max float32) error {
+	if min >= max {
+		return errors.New("invalid intensity range (max must be > min)")
+	}
+	c.intensityMin, c.intensityMax = min, max
+	return nil
+}
+
+func (c *commandContext) LabelTable() *labelTable {
+	return c.labelTable
+}
+
+// SetLabelTable sets the names, colors and hotkeys of the labels.
+// The table is kept over Reset.
+func (c *commandContext) SetLabelTable(t *labelTable) {
+	c.labelTable = t
+	c.labelPalette = t.palette()
+	c.labelTableUpdated = true
+}
+
+func (c *commandContext) ImportLabelTable(b []byte) error {
+	t, err := parseLabelTable(b)
+	if err != nil {
+		return err
+	}
+	c.SetLabelTable(t)
+	return nil
+}
+
+// LabelPalette returns RGBA colors of the labels and whether the table is updated.
+func (c *commandContext) LabelPalette() ([]byte, bool) {
+	updated := c.labelTableUpdated
+	c.labelTableUpdated = false
+	return c.labelPalette, updated
+}
+
 func (c *commandContext) LabelSegmentationParam() (float32, float32) {
 	return c.labelSegmentationSearchDistance, c.labelSegmentationRange
 }
@@ -416,10 +528,14 @@ func (c *commandContext) UnsetCursors() {
 	if c.selectMode == selectModeInsert {
 		// Clear sub cloud to leave insert mode
 		_ = c.editor.SetPointCloud(nil, cloudSub)
+		c.transformIndice = nil
+		c.pasteBox = nil
 	}
 	c.selectMode = selectModeRect
+	c.hasMaskSelection = false
 	c.selected = nil
 	c.updateRect()
+	c.unsetPolygon()
 }
 
 func (c *commandContext) PushCursors() {
@@ -536,6 +652,15 @@ func (c *commandContext) baseFilterByMask(selected bool) func(int, mat.Vec3) boo
 	}
 }
 
+// newJournal creates journalEntry with the current selection box.
+func (c *commandContext) newJournal(name string, params ...float32) journalEntry {
+	j := journalEntry{name: name, params: params}
+	if c.selectMode != selectModeMask && len(c.rect) >= 8 {
+		j.box = append([]mat.Vec3(nil), c.rect[:8]...)
+	}
+	return j
+}
+
 func (c *commandContext) AddSurface(resolution float32) bool {
 	if c.selectMode == selectModeInsert {
 		return false
@@ -583,36 +708,48 @@ func (c *commandContext) AddSurface(resolution float32) bool {
 			it.Incr()
 		}
 	}
-	c.editor.merge(pcNew)
+	c.editor.merge(c.newJournal("add_surface", resolution), pcNew)
 	c.setPointCloudUpdated()
 	return true
 }
 
-func (c *commandContext) Delete() bool {
+func (c *commandContext) Delete() error {
 	switch c.SelectMode() {
 	case selectModeRect:
 		filter := c.baseFilter(false) // keep unselected points
-		c.editor.passThrough(filter)
+		if err := c.editor.passThrough(c.newJournal("delete"), filter); err != nil {
+			return err
+		}
+		c.hasMaskSelection = false // indices are changed
 		c.setPointCloudUpdated()
 	case selectModeMask:
-		c.editor.passThroughByMask(c.selectMask, selectBitmaskSegmentSelected, 0)
-		c.selectMode = selectModeRect // selected points are deleted
+		if err := c.editor.passThroughByMask(c.newJournal("delete"), c.selectMask, selectBitmaskSegmentSelected, 0); err != nil {
+			return err
+		}
+		c.clearMaskSelection() // selected points are deleted
 		c.setPointCloudUpdated()
 	}
-	return true
+	return nil
 }
 
 func (c *commandContext) VoxelFilter(resolution float32) error {
-	if c.SelectMode() != selectModeRect {
-		return errors.New("VoxelFilter is not supported on segment based select")
+	var selected bool
+	var filter func(selected bool) func(int, mat.Vec3) bool
+	switch c.SelectMode() {
+	case selectModeRect:
+		_, selected = c.SelectMatrix()
+		filter = c.baseFilter
+	case selectModeMask:
+		selected = true
+		filter = c.baseFilterByMask
+	default:
+		return errors.New("VoxelFilter is not supported in insert mode")
 	}
 
 	var pp *pc.PointCloud
-
-	_, selected := c.SelectMatrix()
 	if selected {
 		var err error
-		if pp, err = passThrough(c.editor.pp, c.baseFilter(true)); err != nil {
+		if pp, err = passThrough(c.editor.pp, filter(true)); err != nil {
 			return err
 		}
 	} else {
@@ -628,13 +765,18 @@ func (c *commandContext) VoxelFilter(resolution float32) error {
 	if err != nil {
 		return err
 	}
+	if pcFiltered, err = convertFields(pcFiltered, &c.editor.pp.PointCloudHeader); err != nil {
+		return err
+	}
 
+	j := c.newJournal("voxel_filter", resolution)
 	if selected {
-		c.editor.passThrough(c.baseFilter(false))
-		c.editor.pop()
-		c.editor.merge(pcFiltered)
+		if err := c.editor.passThroughAndMerge(j, filter(false), pcFiltered); err != nil {
+			return err
+		}
+		c.clearMaskSelection() // selected points are replaced
 	} else {
-		if err := c.editor.SetPointCloud(pcFiltered, cloudMain); err != nil {
+		if err := c.editor.replace(j, pcFiltered); err != nil {
 			return err
 		}
 	}
@@ -653,7 +795,7 @@ func (c *commandContext) Label(l uint32) bool {
 	default:
 		return false
 	}
-	c.editor.label(func(i int, p mat.Vec3) (uint32, bool) {
+	c.editor.label(c.newJournal("label", float32(l)), func(i int, p mat.Vec3) (uint32, bool) {
 		if filter(i, p) {
 			return l, true
 		}
@@ -664,8 +806,36 @@ func (c *commandContext) Label(l uint32) bool {
 }
 
 func (c *commandContext) Undo() bool {
+	return c.moveHistory(c.editor.Undo)
+}
+
+func (c *commandContext) Redo() bool {
+	return c.moveHistory(c.editor.Redo)
+}
+
+func (c *commandContext) UndoTo(n int) bool {
+	return c.moveHistory(func() bool { return c.editor.UndoTo(n) })
+}
+
+// moveHistory undoes or redoes the edits by fn.
+// Mask selection is cleared if the number of the points is changed
+// since the selected indices no longer point to the same points.
+func (c *commandContext) moveHistory(fn func() bool) bool {
+	n := c.editor.points()
+	ok := fn()
 	c.setPointCloudUpdated()
-	return c.editor.Undo()
+	if c.editor.points() != n {
+		c.clearMaskSelection()
+		c.selectMask = nil
+		c.invalidateSelectMask()
+	}
+	return ok
+}
+
+// Journal returns the descriptions of the edits in the history and
+// the number of the applied entries.
+func (c *commandContext) Journal() ([]journalEntry, int) {
+	return c.editor.journal()
 }
 
 func (c *commandContext) MaxHistory() int {
@@ -680,32 +850,54 @@ func (c *commandContext) SetMaxHistory(m int) bool {
 	return true
 }
 
-func (c *commandContext) ImportPCD(blob interface{}) error {
-	p, err := c.pcdIO.importPCD(blob)
+// importPointCloud imports the cloud and returns its LAS origin, or nil if it isn't LAS.
+func (c *commandContext) importPointCloud(blob interface{}, opts formatOptions) (*pc.PointCloud, *lasGeoref, error) {
+	georef := &lasGeoref{}
+	opts.georef = georef
+	p, err := c.pcdIO.importPCD(blob, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if georef.scale == ([3]float64{}) {
+		georef = nil
+	}
+	return p, georef, nil
+}
+
+func (c *commandContext) ImportPCD(blob interface{}, opts formatOptions) error {
+	p, georef, err := c.importPointCloud(blob, opts)
 	if err != nil {
 		return err
 	}
-	if err := c.editor.SetPointCloud(p, cloudMain); err != nil {
+	if err := c.editor.setPointCloud(p, cloudMain, georef); err != nil {
 		return err
 	}
+	c.tiles = nil
 
 	c.setPointCloudUpdated()
 	return nil
 }
 
-func (c *commandContext) ImportSubPCD(blob interface{}) error {
+func (c *commandContext) ImportSubPCD(blob interface{}, opts formatOptions) error {
 	if c.editor.pp == nil {
 		return errors.New("must have base cloud")
 	}
-	p, err := c.pcdIO.importPCD(blob)
+	p, georef, err := c.importPointCloud(blob, opts)
 	if err != nil {
 		return err
 	}
+	if o, oMain := georef.origin(), c.editor.georef.origin(); o != oMain {
+		if err := translatePointCloud(p, [3]float64{o[0] - oMain[0], o[1] - oMain[1], o[2] - oMain[2]}); err != nil {
+			return err
+		}
+	}
 	if err := c.editor.SetPointCloud(p, cloudSub); err != nil {
 		return err
 	}
 
 	c.selectMode = selectModeInsert
+	c.transformIndice = nil
+	c.pasteBox = nil
 	// Put unit vectors to reconstruct final transformation easily
 	// by cursorsToTrans()
 	c.selected = []mat.Vec3{
@@ -723,6 +915,9 @@ func (c *commandContext) ImportSubPCD(blob interface{}) error {
 func (c *commandContext) FinalizeCurrentMode() error {
 	switch c.selectMode {
 	case selectModeInsert:
+		if c.transformIndice != nil {
+			return c.finalizeTransformSelected()
+		}
 		it, err := c.editor.ppSub.Vec3Iterator()
 		if err != nil {
 			return err
@@ -731,9 +926,21 @@ func (c *commandContext) FinalizeCurrentMode() error {
 		for ; it.IsValid(); it.Incr() {
 			it.SetVec3(trans.Transform(it.Vec3()))
 		}
-		c.editor.merge(c.editor.ppSub)
+		o := trans.Transform(mat.Vec3{})
+		if err := c.editor.merge(c.newJournal("insert", o[0], o[1], o[2]), c.editor.ppSub); err != nil {
+			return err
+		}
 		c.setPointCloudUpdated()
+		box := c.pasteBox
 		c.UnsetCursors()
+		// Select the pasted points by the box they were copied with
+		for i, p := range box {
+			c.SetCursor(i, trans.Transform(p))
+		}
+	default:
+		if len(c.polygon) > 0 {
+			return c.SelectPolygon(c.polygon)
+		}
 	}
 	return nil
 }
@@ -885,18 +1092,23 @@ func (c *commandContext) Import2D(yamlBlob, img interface{}) error {
 	return nil
 }
 
-func (c *commandContext) ExportPCD() (interface{}, error) {
+func (c *commandContext) ExportPCD(opts formatOptions) (interface{}, error) {
 	if c.editor.pp == nil {
 		return nil, errors.New("no pointcloud")
 	}
-	blob, err := c.pcdIO.exportPCD(c.editor.pp)
+	pp, err := c.editor.exportable(c.editor.pp)
+	if err != nil {
+		return nil, err
+	}
+	opts.georef = c.editor.georef
+	blob, err := c.pcdIO.exportPCD(pp, opts)
 	if err != nil {
 		return nil, err
 	}
 	return blob, nil
 }
 
-func (c *commandContext) ExportSelectedPCD() (interface{}, error) {
+func (c *commandContext) ExportSelectedPCD(opts formatOptions) (interface{}, error) {
 	if c.editor.pp == nil {
 		return nil, errors.New("no pointcloud")
 	}
@@ -919,8 +1131,12 @@ func (c *commandContext) ExportSelectedPCD() (interface{}, error) {
 	if pp == nil || pp.Points == 0 {
 		return nil, errors.New("no points are selected")
 	}
+	if pp, err = c.editor.exportable(pp); err != nil {
+		return nil, err
+	}
 
-	blob, err := c.pcdIO.exportPCD(pp)
+	opts.georef = c.editor.georef
+	blob, err := c.pcdIO.exportPCD(pp, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -928,7 +1144,7 @@ func (c *commandContext) ExportSelectedPCD() (interface{}, error) {
 }
 
 func (c *commandContext) SelectSegment(p mat.Vec3) {
-	c.invalidateSelectMask()
+	c.beginMaskSelection()
 	res := float32(c.segmentationDistance)
 	w := int(c.segmentationRange / c.segmentationDistance)
 	half := float32(w) * res / 2
@@ -942,7 +1158,6 @@ func (c *commandContext) SelectSegment(p mat.Vec3) {
 	// Detect surface and exclude from selection.
 	n := c.editor.pp.Points
 	for i := 0; i < n; i++ {
-		c.selectMask[i] &= ^uint32(selectBitmaskSegmentSelected)
 		a, ok := v.Addr(it.Vec3())
 		if ok {
 			if c.selectMask[i]&(selectBitmaskCropped|selectBitmaskOnScreen) == selectBitmaskOnScreen {
@@ -996,12 +1211,10 @@ func (c *commandContext) SelectSegment(p mat.Vec3) {
 		// Clear selectBitmaskExclude bit.
 		c.selectMask[i] &= 0xFFFFFFFF ^ uint32(selectBitmaskExclude)
 	}
-	c.UnsetCursors()
-	c.selectMode = selectModeMask
+	c.endMaskSelection()
 }
 
 func (c *commandContext) SelectLabelSegment(p mat.Vec3) error {
-	c.invalidateSelectMask()
 	it, err := c.editor.pp.Vec3Iterator()
 	if err != nil {
 		return err
@@ -1011,10 +1224,10 @@ func (c *commandContext) SelectLabelSegment(p mat.Vec3) error {
 		return err
 	}
 
+	c.beginMaskSelection()
 	vIndice := make([]int, 0, 8192)
 	n := c.editor.pp.Points
 	for i := 0; i < n; i++ {
-		c.selectMask[i] &= ^uint32(selectBitmaskSegmentSelected)
 		if c.selectMask[i]&(selectBitmaskCropped|selectBitmaskOnScreen) == selectBitmaskOnScreen {
 			v := it.Vec3At(i).Sub(p)
 			if v[0] < -c.labelSegmentationRange || c.labelSegmentationRange < v[0] ||
@@ -1033,6 +1246,7 @@ func (c *commandContext) SelectLabelSegment(p mat.Vec3) error {
 	kdt := kdtree.New(raIn)
 	nn := kdt.Nearest(p, searchDistance)
 	if nn.ID < 0 {
+		c.abortMaskSelection()
 		return fmt.Errorf("no point close to %v", p)
 	}
 
@@ -1044,14 +1258,15 @@ func (c *commandContext) SelectLabelSegment(p mat.Vec3) error {
 			c.selectMask[i] |= selectBitmaskSegmentSelected
 		}
 	}
-
-	c.UnsetCursors()
-	c.selectMode = selectModeMask
+	c.endMaskSelection()
 	return nil
 }
 
 func (c *commandContext) RelabelPointsInLabelRange(minLabel, maxLabel, newLabel uint32) error {
-	err := c.editor.relabelPointsInLabelRange(minLabel, maxLabel, newLabel)
+	err := c.editor.relabelPointsInLabelRange(
+		c.newJournal("relabel", float32(minLabel), float32(maxLabel), float32(newLabel)),
+		minLabel, maxLabel, newLabel,
+	)
 	if err != nil {
 		return err
 	}
@@ -1065,7 +1280,11 @@ func (c *commandContext) UnlabelPoints(labelsToKeep []uint32) error {
 		return nil
 	}
 
-	err := c.editor.unlabelPoints(labelsToKeep)
+	params := make([]float32, len(labelsToKeep))
+	for i, l := range labelsToKeep {
+		params[i] = float32(l)
+	}
+	err := c.editor.unlabelPoints(c.newJournal("unlabel", params...), labelsToKeep)
 	if err != nil {
 		return err
 	}
@@ -39,6 +39,47 @@ func TestSelectRange(t *testing.T) {
 	}
 }
 
+// createXYZCloud returns the cloud of x, y and z fields.
+func createXYZCloud(t *testing.T, vecs ...mat.Vec3) *pc.PointCloud {
+	t.Helper()
+	pp := &pc.PointCloud{
+		PointCloudHeader: pc.PointCloudHeader{
+			Fields: []string{"x", "y", "z"},
+			Size:   []int{4, 4, 4},
+			Type:   []string{"F", "F", "F"},
+			Count:  []int{1, 1, 1},
+			Width:  len(vecs),
+			Height: 1,
+		},
+		Points: len(vecs),
+	}
+	pp.Data = make([]byte, len(vecs)*pp.Stride())
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vecs {
+		it.SetVec3(v)
+		it.Incr()
+	}
+	return pp
+}
+
+// newTestConsole returns the console editing the cloud of the points
+// with the selection mask of nothing selected.
+func newTestConsole(t *testing.T, vecs ...mat.Vec3) *console {
+	t.Helper()
+	c := &console{cmd: newCommandContext(&dummyPCDIO{}, nil)}
+	if err := c.cmd.editor.SetPointCloud(createXYZCloud(t, vecs...), cloudMain); err != nil {
+		t.Fatal(err)
+	}
+	c.cmd.SetSelectMask(make([]uint32, len(vecs)))
+	return c
+}
+
+// noUpdate is updateSelectionFn of the tests setting the selection mask directly.
+func noUpdate() error { return nil }
+
 func expectPointCloud(t *testing.T, pp *pc.PointCloud, vecs []mat.Vec3) {
 	t.Helper()
 	it, err := pp.Vec3Iterator()
@@ -89,7 +130,7 @@ func TestImportPCD(t *testing.T) {
 
 	t.Run("ImportPCD", func(t *testing.T) {
 		c := newCommandContext(&dummyPCDIO{}, nil)
-		if err := c.ImportPCD(pp0); err != nil {
+		if err := c.ImportPCD(pp0, formatOptions{}); err != nil {
 			t.Fatal(err)
 		}
 
@@ -101,10 +142,10 @@ func TestImportPCD(t *testing.T) {
 	})
 	t.Run("ImportSubPCD", func(t *testing.T) {
 		c := newCommandContext(&dummyPCDIO{}, nil)
-		if err := c.ImportPCD(pp0); err != nil {
+		if err := c.ImportPCD(pp0, formatOptions{}); err != nil {
 			t.Fatal(err)
 		}
-		if err := c.ImportSubPCD(pp1); err != nil {
+		if err := c.ImportSubPCD(pp1, formatOptions{}); err != nil {
 			t.Fatal(err)
 		}
 
@@ -130,10 +171,10 @@ func TestImportPCD(t *testing.T) {
 	})
 	t.Run("CancelImportSubPCD", func(t *testing.T) {
 		c := newCommandContext(&dummyPCDIO{}, nil)
-		if err := c.ImportPCD(pp0); err != nil {
+		if err := c.ImportPCD(pp0, formatOptions{}); err != nil {
 			t.Fatal(err)
 		}
-		if err := c.ImportSubPCD(pp1); err != nil {
+		if err := c.ImportSubPCD(pp1, formatOptions{}); err != nil {
 			t.Fatal(err)
 		}
 
@@ -194,7 +235,7 @@ func TestExportPCD(t *testing.T) {
 	c.selectMode = selectModeMask
 
 	t.Run("ExportPCD", func(t *testing.T) {
-		blob, err := c.ExportPCD()
+		blob, err := c.ExportPCD(formatOptions{format: formatPCD})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -208,7 +249,7 @@ func TestExportPCD(t *testing.T) {
 		})
 	})
 	t.Run("ExportSelectedPCD", func(t *testing.T) {
-		blob, err := c.ExportSelectedPCD()
+		blob, err := c.ExportSelectedPCD(formatOptions{format: formatPCD})
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -223,11 +264,11 @@ func TestExportPCD(t *testing.T) {
 
 type dummyPCDIO struct{}
 
-func (dummyPCDIO) importPCD(blob interface{}) (*pc.PointCloud, error) {
+func (dummyPCDIO) importPCD(blob interface{}, opts formatOptions) (*pc.PointCloud, error) {
 	return blob.(*pc.PointCloud), nil
 }
 
-func (dummyPCDIO) exportPCD(pp *pc.PointCloud) (interface{}, error) {
+func (dummyPCDIO) exportPCD(pp *pc.PointCloud, opts formatOptions) (interface{}, error) {
 	return pp, nil
 }
 
@@ -496,7 +537,7 @@ func TestRevisionCounters(t *testing.T) {
 	}
 
 	rev := c.PointCloudRev()
-	if err := c.ImportPCD(pp); err != nil {
+	if err := c.ImportPCD(pp, formatOptions{}); err != nil {
 		t.Fatal(err)
 	}
 	if c.PointCloudRev() == rev {
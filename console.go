@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"math"
 	"runtime"
-	"strconv"
 	"strings"
 
 	"github.com/seqsense/pcgol/mat"
@@ -25,376 +24,969 @@ var (
 
 type updateSelectionFn func() error
 
-var consoleCommands = map[string]func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error){
-	"mem": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		var stat runtime.MemStats
-		runtime.ReadMemStats(&stat)
-		fmt.Printf("%+v\n", stat)
-		return nil, nil
-	},
-	"select_range": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			return [][]float32{{c.cmd.SelectRange(rangeTypeAuto)}}, nil
-		case 1:
-			c.cmd.SetSelectRange(rangeTypeAuto, args[0])
-			return [][]float32{{c.cmd.SelectRange(rangeTypeAuto)}}, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"select_range_perspective": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			return [][]float32{{c.cmd.SelectRange(rangeTypePerspective)}}, nil
-		case 1:
-			c.cmd.SetSelectRange(rangeTypePerspective, args[0])
-			return [][]float32{{c.cmd.SelectRange(rangeTypePerspective)}}, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"select_range_ortho": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			return [][]float32{{c.cmd.SelectRange(rangeTypeOrtho)}}, nil
-		case 1:
-			c.cmd.SetSelectRange(rangeTypeOrtho, args[0])
-			return [][]float32{{c.cmd.SelectRange(rangeTypeOrtho)}}, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"cursor": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			var resFloat [][]float32
-			for i, c := range c.cmd.Cursors() {
-				resFloat = append(resFloat, []float32{float32(i), c[0], c[1], c[2]})
-			}
-			return resFloat, nil
-		case 3:
-			n := len(c.cmd.Cursors())
-			if !c.cmd.SetCursor(n, mat.Vec3{args[0], args[1], args[2]}) {
-				return nil, errSetCursor
-			}
-			return [][]float32{{float32(n), args[0], args[1], args[2]}}, nil
-		case 4:
-			if !c.cmd.SetCursor(int(args[0]), mat.Vec3{args[1], args[2], args[3]}) {
-				return nil, errSetCursor
-			}
-			return [][]float32{args}, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"unset_cursor": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.cmd.UnsetCursors()
-		return nil, nil
-	},
-	"snap_v": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.cmd.SnapVertical()
-		return nil, nil
-	},
-	"snap_h": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.cmd.SnapHorizontal()
-		return nil, nil
-	},
-	"translate_cursor": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 3 {
-			return nil, errArgumentNumber
-		}
-		c.cmd.TransformCursors(mat.Translate(args[0], args[1], args[2]))
-		return nil, nil
-	},
-	"add_surface": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			c.cmd.AddSurface(defaultResolution)
+// consoleCommand is a console command with the specs of the accepted arguments.
+type consoleCommand struct {
+	description string
+	usages      []consoleUsage
+	returns     string // shape of the result, empty if nothing is returned
+	fn          func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error)
+}
+
+var fitAxes = []string{"x", "y", "z", "roll", "pitch", "yaw"}
+
+var consoleCommands = map[string]consoleCommand{
+	"mem": {
+		description: "Print memory statistics to the browser console",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			var stat runtime.MemStats
+			runtime.ReadMemStats(&stat)
+			fmt.Printf("%+v\n", stat)
+			return nil, nil
+		},
+	},
+	"select_range":             selectRangeCommand(rangeTypeAuto),
+	"select_range_perspective": selectRangeCommand(rangeTypePerspective),
+	"select_range_ortho":       selectRangeCommand(rangeTypeOrtho),
+	"cursor": {
+		description: "Show the cursors, add a cursor or move the cursor of the ID",
+		returns:     "[[id x y z]...]",
+		usages: []consoleUsage{
+			{},
+			{numArg("x"), numArg("y"), numArg("z")},
+			{numArg("id"), numArg("x"), numArg("y"), numArg("z")},
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			switch args.Len() {
+			case 0:
+				var resFloat [][]float32
+				for i, c := range c.cmd.Cursors() {
+					resFloat = append(resFloat, []float32{float32(i), c[0], c[1], c[2]})
+				}
+				return resFloat, nil
+			case 3:
+				n := len(c.cmd.Cursors())
+				if !c.cmd.SetCursor(n, mat.Vec3{args.Float(0), args.Float(1), args.Float(2)}) {
+					return nil, errSetCursor
+				}
+				return [][]float32{{float32(n), args.Float(0), args.Float(1), args.Float(2)}}, nil
+			default:
+				if !c.cmd.SetCursor(int(args.Float(0)), mat.Vec3{args.Float(1), args.Float(2), args.Float(3)}) {
+					return nil, errSetCursor
+				}
+				return [][]float32{args.Floats()}, nil
+			}
+		},
+	},
+	"unset_cursor": {
+		description: "Clear the cursors",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.UnsetCursors()
+			return nil, nil
+		},
+	},
+	"snap_v": {
+		description: "Snap the 3rd cursor vertically",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.SnapVertical()
 			return nil, nil
-		case 1:
-			c.cmd.AddSurface(args[0])
+		},
+	},
+	"snap_h": {
+		description: "Snap the 2nd and 3rd cursors horizontally",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.SnapHorizontal()
+			return nil, nil
+		},
+	},
+	"translate_cursor": {
+		description: "Translate the cursors",
+		usages:      []consoleUsage{{numArg("x"), numArg("y"), numArg("z")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.TransformCursors(mat.Translate(args.Float(0), args.Float(1), args.Float(2)))
+			return nil, nil
+		},
+	},
+	"flatten": {
+		description: "Project the selected points within the tolerance (all if 0) onto the plane fitted to them or the plane of the rectangle",
+		returns:     "[[a b c d count]]",
+		usages:      []consoleUsage{{strArg("plane", flattenPlaneNames...), numArg("tolerance")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			p, n, err := c.cmd.Flatten(flattenPlane(indexOf(flattenPlaneNames, args.String(0))), args.Float(1))
+			if err != nil {
+				return nil, err
+			}
+			return [][]float32{{p.normal[0], p.normal[1], p.normal[2], p.d, float32(n)}}, nil
+		},
+	},
+	"transform_selected": {
+		description: "Move the selected points by dragging, or rotate them around the center by roll, pitch and yaw and translate them",
+		returns:     "[[count]]",
+		usages: []consoleUsage{
+			{},
+			{numArg("x"), numArg("y"), numArg("z"), numArg("roll"), numArg("pitch"), numArg("yaw")},
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			if args.Len() == 0 {
+				return nil, c.cmd.BeginTransformSelected()
+			}
+			a := args.Floats()
+			n, err := c.cmd.TransformSelected(a[0], a[1], a[2], a[3], a[4], a[5])
+			if err != nil {
+				return nil, err
+			}
+			return [][]float32{{float32(n)}}, nil
+		},
+	},
+	"copy": {
+		description: "Copy the selected points to the clipboard",
+		returns:     "[[count]]",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			n, err := c.cmd.Copy()
+			if err != nil {
+				return nil, err
+			}
+			return [][]float32{{float32(n)}}, nil
+		},
+	},
+	"clipboard": {
+		description: "Show the number of the points and the origin (bottom center) of the clipboard",
+		returns:     "[[count x y z]]",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			n, o, ok := c.cmd.Clipboard()
+			if !ok {
+				return nil, errClipboardEmpty
+			}
+			return [][]float32{{float32(n), o[0], o[1], o[2]}}, nil
+		},
+	},
+	"paste": {
+		description: "Start inserting the clipboard points at the original position",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			return nil, c.cmd.Paste()
+		},
+	},
+	"paste_at": {
+		description: "Start inserting the clipboard points with the origin placed at the last cursor or the given point",
+		usages:      []consoleUsage{{}, {numArg("x"), numArg("y"), numArg("z")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 3 {
+				return nil, c.cmd.PasteAt(mat.Vec3{args.Float(0), args.Float(1), args.Float(2)})
+			}
+			curs := c.cmd.Cursors()
+			if c.cmd.SelectMode() != selectModeRect || len(curs) == 0 {
+				return nil, errors.New("cursor is not set")
+			}
+			return nil, c.cmd.PasteAt(curs[len(curs)-1])
+		},
+	},
+	"paste_repeat": {
+		description: "Add n copies of the clipboard points translated by the offset, 2 times the offset, ...",
+		returns:     "[[count]]",
+		usages:      []consoleUsage{{numArg("dx"), numArg("dy"), numArg("dz"), numArg("n")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			n, err := c.cmd.PasteRepeat(mat.Vec3{args.Float(0), args.Float(1), args.Float(2)}, int(args.Float(3)))
+			if err != nil {
+				return nil, err
+			}
+			return [][]float32{{float32(n)}}, nil
+		},
+	},
+	"add_surface": {
+		description: "Add a surface to the selected rectangle",
+		usages:      []consoleUsage{{}, {numArg("resolution")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				c.cmd.AddSurface(defaultResolution)
+				return nil, nil
+			}
+			c.cmd.AddSurface(args.Float(0))
 			return nil, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"delete": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		if err := updateSel(); err != nil {
-			return nil, err
-		}
-		c.cmd.Delete()
-		return nil, nil
-	},
-	"label": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 1 {
-			return nil, errArgumentNumber
-		}
-		if err := updateSel(); err != nil {
-			return nil, err
-		}
-		c.cmd.Label(uint32(args[0]))
-		return nil, nil
-	},
-	"undo": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.cmd.Undo()
-		return nil, nil
-	},
-	"max_history": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			return [][]float32{{float32(c.cmd.MaxHistory())}}, nil
-		case 1:
-			c.cmd.SetMaxHistory(int(args[0]))
+		},
+	},
+	"delete": {
+		description: "Delete the selected points",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.Delete()
+		},
+	},
+	"label": {
+		description: "Set the label of the selected points",
+		usages:      []consoleUsage{{numArg("label")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			c.cmd.Label(uint32(args.Float(0)))
 			return nil, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"crop": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.cmd.Crop()
-		return nil, nil
-	},
-	"map_alpha": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			return [][]float32{{c.cmd.MapAlpha()}}, nil
-		case 1:
-			c.cmd.SetMapAlpha(args[0])
+		},
+	},
+	"select_op": {
+		description: "Show or set the operation to combine the next selection with the current selection",
+		returns:     "[op]",
+		usages:      []consoleUsage{{}, {strArg("op", selectOpNames...)}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				return []string{c.cmd.SelectOp().String()}, nil
+			}
+			c.cmd.SetSelectOp(selectOp(indexOf(selectOpNames, args.String(0))))
 			return nil, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"point_size": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			return [][]float32{{c.cmd.PointSize()}}, nil
-		case 1:
-			return nil, c.cmd.SetPointSize(args[0])
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"num_fast_render_points": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			return [][]float32{{float32(c.cmd.NumFastRenderPoints())}}, nil
-		case 1:
-			return nil, c.cmd.SetNumFastRenderPoints(int(args[0]))
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"fov": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 1:
+		},
+	},
+	"select_box": {
+		description: "Convert the rectangle or box selection into the point selection combined by select_op",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.SelectBox()
+		},
+	},
+	"select_invert": {
+		description: "Invert the selection in the crop box",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.InvertSelection()
+		},
+	},
+	"select_where": {
+		description: "Select the points in the crop box matching the query (e.g. label in 3,5 and z > 1.2)",
+		usages:      []consoleUsage{{strArg("query").rest()}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.SelectWhere(strings.Join(args.Strings(), " "))
+		},
+	},
+	"sel_save": {
+		description: "Save the current selection by the name",
+		usages:      []consoleUsage{{strArg("name")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.SaveSelection(args.String(0))
+		},
+	},
+	"sel_load": {
+		description: "Restore the selection saved by the name",
+		usages:      []consoleUsage{{strArg("name")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.LoadSelection(args.String(0))
+		},
+	},
+	"sel_delete": {
+		description: "Delete the selection saved by the name",
+		usages:      []consoleUsage{{strArg("name")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			return nil, c.cmd.DeleteSelection(args.String(0))
+		},
+	},
+	"sel_list": {
+		description: "Show the saved selections",
+		returns:     "[line...]",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			return c.cmd.SelectionList(), nil
+		},
+	},
+	"polygon": {
+		description: "Select the points in the polygon on XY plane extruded in the polygon Z range",
+		usages: []consoleUsage{
+			{numArg("x1"), numArg("y1"), numArg("x2"), numArg("y2"), numArg("x3"), numArg("y3"), numArg("xy").many()},
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			xy := args.Floats()
+			if len(xy)%2 != 0 {
+				return nil, errors.New("coordinates must be given in x y pairs")
+			}
+			vertices := make([]mat.Vec3, len(xy)/2)
+			for i := range vertices {
+				vertices[i] = mat.Vec3{xy[2*i], xy[2*i+1], 0}
+			}
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.SelectPolygon(vertices)
+		},
+	},
+	"polygon_z_range": {
+		description: "Show or set the Z range to extrude the selection polygon",
+		returns:     "[[min max]]",
+		usages:      []consoleUsage{{}, {numArg("min"), numArg("max")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				min, max := c.cmd.PolygonZRange()
+				return [][]float32{{min, max}}, nil
+			}
+			return nil, c.cmd.SetPolygonZRange(args.Float(0), args.Float(1))
+		},
+	},
+	"undo": {
+		description: "Undo the last edit",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.Undo()
+			return nil, nil
+		},
+	},
+	"redo": {
+		description: "Redo the undone edit",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.Redo()
+			return nil, nil
+		},
+	},
+	"undo_to": {
+		description: "Undo until N entries of the history are applied",
+		usages:      []consoleUsage{{numArg("n")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if !c.cmd.UndoTo(int(args.Float(0))) {
+				return nil, errOutOfRange
+			}
+			return nil, nil
+		},
+	},
+	"history": {
+		description: "Show the edit history (undone entries are marked by *)",
+		returns:     "[line...]",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			entries, pos := c.cmd.Journal()
+			res := make([]string, len(entries))
+			for i, j := range entries {
+				mark := " "
+				if i >= pos {
+					mark = "*" // undone
+				}
+				res[i] = fmt.Sprintf("%s%d %s", mark, i+1, j)
+			}
+			return res, nil
+		},
+	},
+	"max_history": {
+		description: "Show or set the number of the undo steps",
+		returns:     "[[n]]",
+		usages:      []consoleUsage{{}, {numArg("n")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				return [][]float32{{float32(c.cmd.MaxHistory())}}, nil
+			}
+			c.cmd.SetMaxHistory(int(args.Float(0)))
+			return nil, nil
+		},
+	},
+	"crop": {
+		description: "Crop the view by the selected box, or uncrop if nothing is selected",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.Crop()
+			return nil, nil
+		},
+	},
+	"map_alpha": {
+		description: "Show or set the opacity of the 2D map",
+		returns:     "[[alpha]]",
+		usages:      []consoleUsage{{}, {numArg("alpha")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				return [][]float32{{c.cmd.MapAlpha()}}, nil
+			}
+			c.cmd.SetMapAlpha(args.Float(0))
+			return nil, nil
+		},
+	},
+	"point_size": {
+		description: "Show or set the rendering size of the points",
+		returns:     "[[size]]",
+		usages:      []consoleUsage{{}, {numArg("size")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				return [][]float32{{c.cmd.PointSize()}}, nil
+			}
+			return nil, c.cmd.SetPointSize(args.Float(0))
+		},
+	},
+	"num_fast_render_points": {
+		description: "Show or set the max number of the points rendered during the operation",
+		returns:     "[[n]]",
+		usages:      []consoleUsage{{}, {numArg("n")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				return [][]float32{{float32(c.cmd.NumFastRenderPoints())}}, nil
+			}
+			return nil, c.cmd.SetNumFastRenderPoints(int(args.Float(0)))
+		},
+	},
+	"fov": {
+		description: "Increase (direction>0) or decrease (direction<0) the field of view",
+		usages:      []consoleUsage{{numArg("direction")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
 			switch {
-			case args[0] > 0:
+			case args.Float(0) > 0:
 				c.view.IncreaseFOV()
-			case args[0] < 0:
+			case args.Float(0) < 0:
 				c.view.DecreaseFOV()
 			}
 			return nil, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"voxel_grid": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if err := updateSel(); err != nil {
-			return nil, err
-		}
-		switch len(args) {
-		case 0:
-			return [][]float32{}, c.cmd.VoxelFilter(defaultResolution)
-		case 1:
-			return [][]float32{}, c.cmd.VoxelFilter(args[0])
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"z_range": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			zMin, zMax := c.cmd.ZRange()
-			return [][]float32{{zMin, zMax}}, nil
-		case 2:
-			c.cmd.SetZRange(args[0], args[1])
+		},
+	},
+	"voxel_grid": {
+		description: "Downsample the selected points, or the whole cloud if nothing is selected, by the voxel grid filter",
+		usages:      []consoleUsage{{}, {numArg("resolution")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			if args.Len() == 0 {
+				return [][]float32{}, c.cmd.VoxelFilter(defaultResolution)
+			}
+			return [][]float32{}, c.cmd.VoxelFilter(args.Float(0))
+		},
+	},
+	"outlier_sor": {
+		description: "Delete or label the outliers in the selected points, or the whole cloud if nothing is selected, by the statistical outlier removal",
+		returns:     "[[count]]",
+		usages: []consoleUsage{
+			{},
+			{numArg("k"), numArg("stddev")},
+			{numArg("k"), numArg("stddev"), numArg("label")},
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			k, stddev := defaultOutlierSORNeighbors, float32(defaultOutlierSORStddev)
+			if args.Len() > 0 {
+				k, stddev = int(args.Float(0)), args.Float(1)
+			}
+			n, err := c.cmd.RemoveOutliersSOR(k, stddev, outlierLabelArg(args, 2))
+			if err != nil {
+				return nil, err
+			}
+			return [][]float32{{float32(n)}}, nil
+		},
+	},
+	"outlier_radius": {
+		description: "Delete or label the points having less than minNeighbors neighbors within the radius in the selected points, or the whole cloud if nothing is selected",
+		returns:     "[[count]]",
+		usages: []consoleUsage{
+			{},
+			{numArg("radius"), numArg("minNeighbors")},
+			{numArg("radius"), numArg("minNeighbors"), numArg("label")},
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			r, minNeighbors := float32(defaultOutlierRadius), defaultOutlierRadiusNeighbors
+			if args.Len() > 0 {
+				r, minNeighbors = args.Float(0), int(args.Float(1))
+			}
+			n, err := c.cmd.RemoveOutliersRadius(r, minNeighbors, outlierLabelArg(args, 2))
+			if err != nil {
+				return nil, err
+			}
+			return [][]float32{{float32(n)}}, nil
+		},
+	},
+	"z_range": {
+		description: "Show or set the z range to be colored",
+		returns:     "[[min max]]",
+		usages:      []consoleUsage{{}, {numArg("min"), numArg("max")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				zMin, zMax := c.cmd.ZRange()
+				return [][]float32{{zMin, zMax}}, nil
+			}
+			c.cmd.SetZRange(args.Float(0), args.Float(1))
 			return nil, nil
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"ortho": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.cmd.SetProjectionType(ProjectionOrthographic)
-		return nil, nil
-	},
-	"perspective": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.cmd.SetProjectionType(ProjectionPerspective)
-		return nil, nil
-	},
-	"rotate_yaw": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 1 {
-			return nil, errArgumentNumber
-		}
-		c.view.RotateYaw(float64(args[0]))
-		return nil, nil
-	},
-	"pitch": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 1 {
-			return nil, errArgumentNumber
-		}
-		c.view.SetPitch(float64(args[0]))
-		return nil, nil
-	},
-	"snap_pitch": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.view.SnapPitch()
-		return nil, nil
-	},
-	"snap_yaw": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.view.SnapYaw()
-		return nil, nil
-	},
-	"segmentation_param": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			p0, p1 := c.cmd.SegmentationParam()
-			return [][]float32{{p0, p1}}, nil
-		case 2:
-			return nil, c.cmd.SetSegmentationParam(args[0], args[1])
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"view_reset": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.view.Reset()
-		return nil, nil
-	},
-	"view_fps": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) != 0 {
-			return nil, errArgumentNumber
-		}
-		c.view.FPS()
-		return nil, nil
-	},
-	"view": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			x, y, yaw, pitch, distance := c.view.View()
-			return [][]float32{{
-				float32(x), float32(y),
-				float32(yaw), float32(pitch), float32(distance),
-			}}, nil
-		case 5:
+		},
+	},
+	"color_mode": {
+		description: "Show or set the field to color the points",
+		returns:     "[mode]",
+		usages:      []consoleUsage{{}, {strArg("mode", colorModeNames...)}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				return []string{c.cmd.ColorMode().String()}, nil
+			}
+			return nil, c.cmd.SetColorMode(colorMode(indexOf(colorModeNames, args.String(0))))
+		},
+	},
+	"colormap": {
+		description: "Show or set the colormap used in intensity color mode",
+		returns:     "[name]",
+		usages:      []consoleUsage{{}, {strArg("name", colormapNames...)}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				return []string{c.cmd.Colormap().String()}, nil
+			}
+			c.cmd.SetColormap(colormap(indexOf(colormapNames, args.String(0))))
+			return nil, nil
+		},
+	},
+	"intensity_range": {
+		description: "Show or set the intensity range mapped to the colormap",
+		returns:     "[[min max]]",
+		usages:      []consoleUsage{{}, {numArg("min"), numArg("max")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				iMin, iMax := c.cmd.IntensityRange()
+				return [][]float32{{iMin, iMax}}, nil
+			}
+			return nil, c.cmd.SetIntensityRange(args.Float(0), args.Float(1))
+		},
+	},
+	"ortho": {
+		description: "Use orthographic projection",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.SetProjectionType(ProjectionOrthographic)
+			return nil, nil
+		},
+	},
+	"perspective": {
+		description: "Use perspective projection",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.cmd.SetProjectionType(ProjectionPerspective)
+			return nil, nil
+		},
+	},
+	"rotate_yaw": {
+		description: "Rotate the view around the vertical axis",
+		usages:      []consoleUsage{{numArg("yaw")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.view.RotateYaw(float64(args.Float(0)))
+			return nil, nil
+		},
+	},
+	"pitch": {
+		description: "Set the pitch angle of the view",
+		usages:      []consoleUsage{{numArg("pitch")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.view.SetPitch(float64(args.Float(0)))
+			return nil, nil
+		},
+	},
+	"snap_pitch": {
+		description: "Snap the pitch angle of the view to 90 degrees step",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.view.SnapPitch()
+			return nil, nil
+		},
+	},
+	"snap_yaw": {
+		description: "Snap the yaw angle of the view to 90 degrees step",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.view.SnapYaw()
+			return nil, nil
+		},
+	},
+	"segmentation_param": {
+		description: "Show or set the distance and the range of the segmentation",
+		returns:     "[[distance range]]",
+		usages:      []consoleUsage{{}, {numArg("distance"), numArg("range")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				p0, p1 := c.cmd.SegmentationParam()
+				return [][]float32{{p0, p1}}, nil
+			}
+			return nil, c.cmd.SetSegmentationParam(args.Float(0), args.Float(1))
+		},
+	},
+	"view_reset": {
+		description: "Reset the view",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.view.Reset()
+			return nil, nil
+		},
+	},
+	"view_fps": {
+		description: "Use first person view",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			c.view.FPS()
+			return nil, nil
+		},
+	},
+	"view": {
+		description: "Show or set the view",
+		returns:     "[[x y yaw pitch distance]]",
+		usages: []consoleUsage{
+			{},
+			{numArg("x"), numArg("y"), numArg("yaw"), numArg("pitch"), numArg("distance")},
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				x, y, yaw, pitch, distance := c.view.View()
+				return [][]float32{{
+					float32(x), float32(y),
+					float32(yaw), float32(pitch), float32(distance),
+				}}, nil
+			}
 			x, y, yaw, pitch, distance :=
-				float64(args[0]), float64(args[1]),
-				float64(args[2]), float64(args[3]), float64(args[4])
+				float64(args.Float(0)), float64(args.Float(1)),
+				float64(args.Float(2)), float64(args.Float(3)), float64(args.Float(4))
 			return nil, c.view.SetView(x, y, yaw, pitch, distance)
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"fit_inserting": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		var axes [6]bool
-		for _, v := range args {
-			i := int(math.Round(float64(v)))
-			if i < 0 || 6 <= i {
-				return nil, errOutOfRange
+		},
+	},
+	"fit_inserting": {
+		description: "Fit the inserting cloud to the base cloud along the axes",
+		usages: []consoleUsage{
+			{strArg("axis", fitAxes...).many()},
+			{numArg("axis").many()}, // axis index for backward compatibility
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			var axes [6]bool
+			for i := 0; i < args.Len(); i++ {
+				n := -1
+				for j, a := range fitAxes {
+					if a == args.String(i) {
+						n = j
+					}
+				}
+				if n < 0 {
+					n = int(math.Round(float64(args.Float(i))))
+				}
+				if n < 0 || 6 <= n {
+					return nil, errOutOfRange
+				}
+				axes[n] = true
+			}
+			return nil, c.cmd.FitInserting(axes)
+		},
+	},
+	"label_segmentation_param": {
+		description: "Show or set the search distance and the range of the label based segmentation",
+		returns:     "[[distance range]]",
+		usages:      []consoleUsage{{}, {numArg("distance"), numArg("range")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				p0, p1 := c.cmd.LabelSegmentationParam()
+				return [][]float32{{p0, p1}}, nil
+			}
+			return nil, c.cmd.SetLabelSegmentationParam(args.Float(0), args.Float(1))
+		},
+	},
+	"cluster_preview": {
+		description: "Show the number of the clusters in the crop box and the histogram of the cluster sizes",
+		returns:     "[line...]",
+		usages:      []consoleUsage{{numArg("tolerance"), numArg("minSize"), numArg("maxSize")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return c.cmd.PreviewClusters(args.Float(0), int(args.Float(1)), int(args.Float(2)))
+		},
+	},
+	"cluster_label": {
+		description: "Set the labels starting from the label to the clusters in the crop box having the size in the range",
+		returns:     "[[count]]",
+		usages:      []consoleUsage{{numArg("label"), numArg("tolerance"), numArg("minSize"), numArg("maxSize")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			n, err := c.cmd.LabelClusters(uint32(args.Float(0)), args.Float(1), int(args.Float(2)), int(args.Float(3)))
+			if err != nil {
+				return nil, err
+			}
+			return [][]float32{{float32(n)}}, nil
+		},
+	},
+	"cluster_delete": {
+		description: "Delete the clusters in the crop box smaller than minSize",
+		returns:     "[[count]]",
+		usages:      []consoleUsage{{numArg("tolerance"), numArg("minSize")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			n, err := c.cmd.DeleteClusters(args.Float(0), int(args.Float(1)))
+			if err != nil {
+				return nil, err
+			}
+			return [][]float32{{float32(n)}}, nil
+		},
+	},
+	"planes": {
+		description: "Extract the planes in the crop box, and label floors, ceilings and walls by the plane labels",
+		returns:     "[[a b c d inliers class]...]",
+		usages: []consoleUsage{
+			{},
+			{numArg("distance"), numArg("maxPlanes"), numArg("minInliers")},
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			distance, maxPlanes, minInliers := float32(defaultPlaneDistance), defaultPlaneMaxPlanes, defaultPlaneMinInliers
+			if args.Len() > 0 {
+				distance, maxPlanes, minInliers = args.Float(0), int(args.Float(1)), int(args.Float(2))
+			}
+			planes, err := c.cmd.ExtractPlanes(distance, maxPlanes, minInliers)
+			if err != nil {
+				return nil, err
+			}
+			res := make([][]float32, len(planes))
+			for i := range planes {
+				res[i] = planes[i].row()
+			}
+			return res, nil
+		},
+	},
+	"plane_labels": {
+		description: "Show or set the labels of floors, ceilings and walls extracted by planes (0: not labeled)",
+		returns:     "[[floor ceiling wall]]",
+		usages:      []consoleUsage{{}, {numArg("floor"), numArg("ceiling"), numArg("wall")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				l := c.cmd.PlaneLabels()
+				return [][]float32{{float32(l.floor), float32(l.ceiling), float32(l.wall)}}, nil
 			}
-			axes[i] = true
-		}
-		return nil, c.cmd.FitInserting(axes)
-	},
-	"label_segmentation_param": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			p0, p1 := c.cmd.LabelSegmentationParam()
-			return [][]float32{{p0, p1}}, nil
-		case 2:
-			return nil, c.cmd.SetLabelSegmentationParam(args[0], args[1])
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"render_label_range": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		switch len(args) {
-		case 0:
-			p0, p1 := c.cmd.RenderLabelRange()
-			return [][]float32{{float32(p0), float32(p1)}}, nil
-		case 2:
-			return nil, c.cmd.SetRenderLabelRange(uint32(args[0]), uint32(args[1]))
-		default:
-			return nil, errArgumentNumber
-		}
-	},
-	"relabel": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		if len(args) < 3 {
-			return nil, errArgumentNumber
-		}
-		return nil, c.cmd.RelabelPointsInLabelRange(uint32(args[0]), uint32(args[1]), uint32(args[2]))
-	},
-	"unlabel": func(c *console, updateSel updateSelectionFn, args []float32) ([][]float32, error) {
-		var labelsToKeep []uint32
-		for _, v := range args {
-			labelsToKeep = append(labelsToKeep, uint32(v))
-		}
-		return nil, c.cmd.UnlabelPoints(labelsToKeep)
+			c.cmd.SetPlaneLabels(planeLabels{
+				floor:   uint32(args.Float(0)),
+				ceiling: uint32(args.Float(1)),
+				wall:    uint32(args.Float(2)),
+			})
+			return nil, nil
+		},
+	},
+	"ground_param": {
+		description: "Show or set the cell size, the maximum slope, the height threshold and the maximum window size of the ground segmentation",
+		returns:     "[[cell slope height window]]",
+		usages:      []consoleUsage{{}, {numArg("cell"), numArg("slope"), numArg("height"), numArg("window")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				p := c.cmd.GroundParam()
+				return [][]float32{{p.cell, p.slope, p.height, p.window}}, nil
+			}
+			return nil, c.cmd.SetGroundParam(groundParam{
+				cell:   args.Float(0),
+				slope:  args.Float(1),
+				height: args.Float(2),
+				window: args.Float(3),
+			})
+		},
+	},
+	"ground_select": {
+		description: "Select the ground points in the crop box to preview the ground segmentation",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.SelectGround()
+		},
+	},
+	"ground_label": {
+		description: "Set the label to the ground points in the crop box",
+		usages:      []consoleUsage{{numArg("label")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if err := updateSel(); err != nil {
+				return nil, err
+			}
+			return nil, c.cmd.LabelGround(uint32(args.Float(0)))
+		},
+	},
+	"render_label_range": {
+		description: "Show or set the range of the labels to be colored",
+		returns:     "[[min max]]",
+		usages:      []consoleUsage{{}, {numArg("min"), numArg("max")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				p0, p1 := c.cmd.RenderLabelRange()
+				return [][]float32{{float32(p0), float32(p1)}}, nil
+			}
+			return nil, c.cmd.SetRenderLabelRange(uint32(args.Float(0)), uint32(args.Float(1)))
+		},
+	},
+	"labels": {
+		description: "Show the label table (ID, name, color and hotkey)",
+		returns:     "[line...]",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			return c.cmd.LabelTable().lines(), nil
+		},
+	},
+	"label_stats": {
+		description: "Show the point count, bounding box (including z range) and centroid of each label in the whole cloud, the selected points or the crop region",
+		returns:     "[[label count minX minY minZ maxX maxY maxZ centroidX centroidY centroidZ]...]",
+		usages: []consoleUsage{
+			{},
+			{strArg("scope", statsScopeNames...), numArg("label").many()},
+		},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			scope := statsScopeAll
+			if args.Len() > 0 {
+				scope = statsScope(indexOf(statsScopeNames, args.String(0)))
+			}
+			if scope == statsScopeSelected {
+				if err := updateSel(); err != nil {
+					return nil, err
+				}
+			}
+			var labels []uint32
+			if args.Len() > 1 {
+				for _, l := range args.Floats()[1:] {
+					labels = append(labels, uint32(l))
+				}
+			}
+			stats, err := c.cmd.LabelStats(scope, labels)
+			if err != nil {
+				return nil, err
+			}
+			res := make([][]float32, len(stats))
+			for i := range stats {
+				res[i] = stats[i].row()
+			}
+			return res, nil
+		},
+	},
+	"tiles": {
+		description: "Show the tiles of the tiled map (path, state, number of the loaded points and modified flag)",
+		returns:     "[line...]",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			return c.cmd.TileStatus()
+		},
+	},
+	"tile_update": {
+		description: "Switch the tiles around the view discarding the edit history",
+		usages:      []consoleUsage{{}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			return nil, c.cmd.RequestTileUpdate()
+		},
+	},
+	"tile_radius": {
+		description: "Show or set the radius around the view to load the tiles",
+		returns:     "[[radius]]",
+		usages:      []consoleUsage{{}, {numArg("radius")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				r, err := c.cmd.TileRadius()
+				if err != nil {
+					return nil, err
+				}
+				return [][]float32{{r}}, nil
+			}
+			return nil, c.cmd.SetTileRadius(args.Float(0))
+		},
+	},
+	"relabel": {
+		description: "Set the label of the points labeled in min-max range to new",
+		usages:      []consoleUsage{{numArg("min"), numArg("max"), numArg("new")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			return nil, c.cmd.RelabelPointsInLabelRange(uint32(args.Float(0)), uint32(args.Float(1)), uint32(args.Float(2)))
+		},
+	},
+	"unlabel": {
+		description: "Set the label of the points not labeled by the given labels to 0",
+		usages:      []consoleUsage{{numArg("label").many()}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			var labelsToKeep []uint32
+			for _, v := range args.Floats() {
+				labelsToKeep = append(labelsToKeep, uint32(v))
+			}
+			return nil, c.cmd.UnlabelPoints(labelsToKeep)
+		},
 	},
 }
 
-func (c *console) Run(line string, updateSel updateSelectionFn) ([][]float32, error) {
-	args := strings.Fields(line)
-	if len(args) == 0 {
-		return nil, nil
+func selectRangeCommand(t rangeType) consoleCommand {
+	desc := "Show or set the thickness of the selection box"
+	switch t {
+	case rangeTypePerspective:
+		desc += " in perspective projection"
+	case rangeTypeOrtho:
+		desc += " in orthographic projection"
 	}
-	fn, ok := consoleCommands[args[0]]
-	if !ok {
+	return consoleCommand{
+		description: desc,
+		returns:     "[[range]]",
+		usages:      []consoleUsage{{}, {numArg("range")}},
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 1 {
+				c.cmd.SetSelectRange(t, args.Float(0))
+			}
+			return [][]float32{{c.cmd.SelectRange(t)}}, nil
+		},
+	}
+}
+
+// outlierLabelArg returns the label to set to the outliers if i-th argument is given.
+func outlierLabelArg(args consoleArgs, i int) *uint32 {
+	if args.Len() <= i {
+		return nil
+	}
+	l := uint32(args.Float(i))
+	return &l
+}
+
+// Run runs a console command.
+// Result is [][]float32 or []string depending on the command.
+func (c *console) Run(line string, updateSel updateSelectionFn) (interface{}, error) {
+	tokens, err := tokenizeConsole(line)
+	if err != nil {
+		return nil, err
+	}
+	return c.runTokens(tokens, updateSel)
+}
+
+func (c *console) runTokens(tokens []consoleToken, updateSel updateSelectionFn) (interface{}, error) {
+	if len(tokens) == 0 {
+		return [][]float32(nil), nil
+	}
+	if tokens[0].key != "" || tokens[0].quoted {
 		return nil, errInvalidCommand
 	}
-	var argsFloat []float32
-	for i := 1; i < len(args); i++ {
-		f, err := strconv.ParseFloat(args[i], 32)
-		if err != nil {
-			return nil, err
-		}
-		argsFloat = append(argsFloat, float32(f))
+	cmd, ok := consoleCommands[tokens[0].value]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errInvalidCommand, tokens[0].value)
 	}
-	res, err := fn(c, updateSel, argsFloat)
+	args, err := parseConsoleArgs(tokens[0].value, cmd.usages, tokens[1:])
 	if err != nil {
 		return nil, err
 	}
+	res, err := cmd.fn(c, updateSel, args)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return [][]float32(nil), nil
+	}
 	return res, nil
 }
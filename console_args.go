@@ -0,0 +1,298 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// consoleToken is a token of the console command line.
+// key is set if the token is written in key=value form.
+type consoleToken struct {
+	key, value string
+	quoted     bool
+}
+
+// tokenizeConsole splits the command line into tokens.
+// Single or double quoted strings are kept as one token and
+// unquoted token starting with # begins a comment.
+func tokenizeConsole(line string) ([]consoleToken, error) {
+	var tokens []consoleToken
+	rs := []rune(line)
+	for i := 0; i < len(rs); {
+		if isConsoleSpace(rs[i]) {
+			i++
+			continue
+		}
+		if rs[i] == '#' {
+			break
+		}
+		var b strings.Builder
+		var t consoleToken
+		for ; i < len(rs) && !isConsoleSpace(rs[i]); i++ {
+			switch r := rs[i]; {
+			case r == '"' || r == '\'':
+				t.quoted = true
+				i++
+				for ; i < len(rs) && rs[i] != r; i++ {
+					if r == '"' && rs[i] == '\\' && i+1 < len(rs) {
+						i++
+					}
+					b.WriteRune(rs[i])
+				}
+				if i == len(rs) {
+					return nil, errUnterminatedQuote
+				}
+			case r == '=' && !t.quoted && t.key == "" && isScriptVarName(b.String()):
+				t.key = b.String()
+				b.Reset()
+			default:
+				b.WriteRune(r)
+			}
+		}
+		t.value = b.String()
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+func isConsoleSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
+
+type consoleArgType int
+
+const (
+	consoleArgNumber consoleArgType = iota
+	consoleArgString
+)
+
+// consoleArg is a spec of the console command argument.
+type consoleArg struct {
+	name     string
+	typ      consoleArgType
+	choices  []string // allowed values of string argument
+	variadic bool     // takes remaining arguments (must be the last)
+	raw      bool     // takes remaining arguments without interpreting key=value form
+}
+
+func numArg(name string) consoleArg {
+	return consoleArg{name: name, typ: consoleArgNumber}
+}
+
+func strArg(name string, choices ...string) consoleArg {
+	return consoleArg{name: name, typ: consoleArgString, choices: choices}
+}
+
+func (a consoleArg) many() consoleArg {
+	a.variadic = true
+	return a
+}
+
+// rest makes the argument take the remaining tokens as they are written.
+// It is used for the expressions containing = like "label=3".
+func (a consoleArg) rest() consoleArg {
+	a.variadic = true
+	a.raw = true
+	return a
+}
+
+func (a consoleArg) String() string {
+	s := a.name
+	if len(a.choices) > 0 {
+		s += "=" + strings.Join(a.choices, "|")
+	}
+	if a.variadic {
+		s += "..."
+	}
+	return s
+}
+
+type consoleUsage []consoleArg
+
+func (u consoleUsage) String() string {
+	s := make([]string, len(u))
+	for i, a := range u {
+		s[i] = a.String()
+	}
+	return strings.Join(s, " ")
+}
+
+// raw returns true if the last argument takes the remaining tokens as they are written.
+func (u consoleUsage) raw() bool {
+	return len(u) > 0 && u[len(u)-1].raw
+}
+
+func (u consoleUsage) accepts(n int) bool {
+	if len(u) > 0 && u[len(u)-1].variadic {
+		return n >= len(u)-1
+	}
+	return n == len(u)
+}
+
+// consoleArgs is parsed arguments of the console command.
+type consoleArgs struct {
+	usage  consoleUsage
+	values []consoleValue
+}
+
+type consoleValue struct {
+	f float32
+	s string
+}
+
+func (a consoleArgs) Len() int {
+	return len(a.values)
+}
+
+func (a consoleArgs) Float(i int) float32 {
+	return a.values[i].f
+}
+
+func (a consoleArgs) String(i int) string {
+	return a.values[i].s
+}
+
+func (a consoleArgs) Floats() []float32 {
+	out := make([]float32, len(a.values))
+	for i, v := range a.values {
+		out[i] = v.f
+	}
+	return out
+}
+
+func (a consoleArgs) Strings() []string {
+	out := make([]string, len(a.values))
+	for i, v := range a.values {
+		out[i] = v.s
+	}
+	return out
+}
+
+// parseConsoleArgs selects the usage matching to the tokens and converts the values.
+// Named tokens (key=value) are placed at the position of the argument of the same name.
+func parseConsoleArgs(name string, usages []consoleUsage, tokens []consoleToken) (consoleArgs, error) {
+	var matched []consoleUsage
+	for _, u := range usages {
+		if u.accepts(len(tokens)) {
+			matched = append(matched, u)
+		}
+	}
+	if len(matched) == 0 {
+		return consoleArgs{}, &consoleUsageError{name: name, usages: usages, err: errArgumentNumber}
+	}
+	var errFirst error
+	for _, u := range matched {
+		args, err := parseConsoleArgsWithUsage(u, tokens)
+		if err == nil {
+			return args, nil
+		}
+		if errFirst == nil {
+			errFirst = err
+		}
+	}
+	return consoleArgs{}, &consoleUsageError{name: name, usages: usages, err: errFirst}
+}
+
+func parseConsoleArgsWithUsage(u consoleUsage, tokens []consoleToken) (consoleArgs, error) {
+	ordered := make([]*consoleToken, len(tokens))
+	var positional []*consoleToken
+	for i := range tokens {
+		t := &tokens[i]
+		if u.raw() && t.key != "" {
+			t = &consoleToken{value: t.key + "=" + t.value, quoted: t.quoted}
+		}
+		if t.key == "" {
+			positional = append(positional, t)
+			continue
+		}
+		j := u.index(t.key)
+		if j < 0 || u[j].variadic {
+			return consoleArgs{}, fmt.Errorf("unknown argument name %q", t.key)
+		}
+		if ordered[j] != nil {
+			return consoleArgs{}, fmt.Errorf("duplicated argument %q", t.key)
+		}
+		ordered[j] = t
+	}
+	for i := range ordered {
+		if ordered[i] == nil {
+			ordered[i], positional = positional[0], positional[1:]
+		}
+	}
+
+	args := consoleArgs{usage: u, values: make([]consoleValue, len(ordered))}
+	for i, t := range ordered {
+		a := u[len(u)-1]
+		if i < len(u) {
+			a = u[i]
+		}
+		v, err := a.parse(t.value)
+		if err != nil {
+			return consoleArgs{}, err
+		}
+		args.values[i] = v
+	}
+	return args, nil
+}
+
+func (u consoleUsage) index(name string) int {
+	for i, a := range u {
+		if a.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (a consoleArg) parse(s string) (consoleValue, error) {
+	switch a.typ {
+	case consoleArgNumber:
+		f, err := strconv.ParseFloat(s, 32)
+		if err != nil {
+			return consoleValue{}, fmt.Errorf("%s must be a number: %q", a.name, s)
+		}
+		return consoleValue{f: float32(f), s: s}, nil
+	default:
+		if len(a.choices) == 0 {
+			return consoleValue{s: s}, nil
+		}
+		for _, c := range a.choices {
+			if c == s {
+				return consoleValue{s: s}, nil
+			}
+		}
+		return consoleValue{}, fmt.Errorf("%s must be one of %s: %q", a.name, strings.Join(a.choices, ", "), s)
+	}
+}
+
+type consoleUsageError struct {
+	name   string
+	usages []consoleUsage
+	err    error
+}
+
+func (e *consoleUsageError) Error() string {
+	us := make([]string, len(e.usages))
+	for i, u := range e.usages {
+		us[i] = strings.TrimSpace(e.name + " " + u.String())
+	}
+	return fmt.Sprintf("%v (usage: %s)", e.err, strings.Join(us, " | "))
+}
+
+func (e *consoleUsageError) Unwrap() error {
+	return e.err
+}
+
+// indexOf returns the index of s in the list, or -1 if not found.
+func indexOf(list []string, s string) int {
+	for i, v := range list {
+		if v == s {
+			return i
+		}
+	}
+	return -1
+}
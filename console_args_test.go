@@ -0,0 +1,139 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTokenizeConsole(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		expected []consoleToken
+		err      error
+	}{
+		"Empty": {
+			input: "  ",
+		},
+		"Numbers": {
+			input: "cursor 1 -2.5\t3",
+			expected: []consoleToken{
+				{value: "cursor"}, {value: "1"}, {value: "-2.5"}, {value: "3"},
+			},
+		},
+		"Quoted": {
+			input: `export "a b.pcd" 'c "d"' "e\"f"`,
+			expected: []consoleToken{
+				{value: "export"},
+				{value: "a b.pcd", quoted: true},
+				{value: `c "d"`, quoted: true},
+				{value: `e"f`, quoted: true},
+			},
+		},
+		"KeyValue": {
+			input: `cmd resolution=0.1 name="a=b c" "x=y"`,
+			expected: []consoleToken{
+				{value: "cmd"},
+				{key: "resolution", value: "0.1"},
+				{key: "name", value: "a=b c", quoted: true},
+				{value: "x=y", quoted: true},
+			},
+		},
+		"Comment": {
+			input: `cmd "#a" b#c # comment`,
+			expected: []consoleToken{
+				{value: "cmd"}, {value: "#a", quoted: true}, {value: "b#c"},
+			},
+		},
+		"UnterminatedQuote": {
+			input: `cmd "abc`,
+			err:   errUnterminatedQuote,
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			tokens, err := tokenizeConsole(tt.input)
+			if err != tt.err {
+				t.Fatalf("Expected error: %v, got: %v", tt.err, err)
+			}
+			if !reflect.DeepEqual(tt.expected, tokens) {
+				t.Errorf("Expected: %+v, got: %+v", tt.expected, tokens)
+			}
+		})
+	}
+}
+
+func TestParseConsoleArgs(t *testing.T) {
+	usages := []consoleUsage{
+		{},
+		{numArg("x"), numArg("y")},
+		{strArg("mode", "a", "b"), numArg("v").many()},
+	}
+	testCases := map[string]struct {
+		input    string
+		expected []consoleValue
+		err      error
+	}{
+		"NoArgs": {
+			input:    "cmd",
+			expected: []consoleValue{},
+		},
+		"Positional": {
+			input:    "cmd 1 2",
+			expected: []consoleValue{{f: 1, s: "1"}, {f: 2, s: "2"}},
+		},
+		"Named": {
+			input:    "cmd y=2 1",
+			expected: []consoleValue{{f: 1, s: "1"}, {f: 2, s: "2"}},
+		},
+		"Variadic": {
+			input:    "cmd b 1 2 3",
+			expected: []consoleValue{{s: "b"}, {f: 1, s: "1"}, {f: 2, s: "2"}, {f: 3, s: "3"}},
+		},
+		"FallbackOverload": {
+			input:    "cmd a 5",
+			expected: []consoleValue{{s: "a"}, {f: 5, s: "5"}},
+		},
+		"ArgumentNumber": {
+			input: "cmd",
+			err:   errArgumentNumber,
+		},
+		"NotNumber": {
+			input: "cmd 1 2 c",
+		},
+		"UnknownName": {
+			input: "cmd z=1 2",
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			tokens, err := tokenizeConsole(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u := usages
+			if name == "ArgumentNumber" {
+				u = usages[1:]
+			}
+			args, err := parseConsoleArgs(tokens[0].value, u, tokens[1:])
+			if tt.expected == nil {
+				var ue *consoleUsageError
+				if !errors.As(err, &ue) {
+					t.Fatalf("Expected consoleUsageError, got: %v", err)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Errorf("Expected %v, got: %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.expected, args.values) {
+				t.Errorf("Expected: %+v, got: %+v", tt.expected, args.values)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+func init() {
+	// Registered here since they refer consoleCommands itself.
+	consoleCommands["help"] = consoleCommand{
+		description: "Show the list of the commands or the usage of the command",
+		usages:      []consoleUsage{{}, {strArg("command")}},
+		returns:     "[line...]",
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			if args.Len() == 0 {
+				var res []string
+				for _, name := range consoleCommandNames() {
+					res = append(res, fmt.Sprintf("%s: %s", name, consoleCommands[name].description))
+				}
+				return res, nil
+			}
+			cmd, ok := consoleCommands[args.String(0)]
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", errInvalidCommand, args.String(0))
+			}
+			return cmd.help(args.String(0)), nil
+		},
+	}
+	consoleCommands["complete"] = consoleCommand{
+		description: "Show the candidates to complete the last word of the command line",
+		usages:      []consoleUsage{{strArg("line")}},
+		returns:     "[candidate...]",
+		fn: func(c *console, updateSel updateSelectionFn, args consoleArgs) (interface{}, error) {
+			return completeConsole(args.String(0)), nil
+		},
+	}
+}
+
+func consoleCommandNames() []string {
+	names := make([]string, 0, len(consoleCommands))
+	for name := range consoleCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (cmd consoleCommand) help(name string) []string {
+	res := []string{fmt.Sprintf("%s: %s", name, cmd.description)}
+	for _, u := range cmd.usages {
+		res = append(res, strings.TrimSpace("usage: "+name+" "+u.String()))
+	}
+	if cmd.returns != "" {
+		res = append(res, "returns: "+cmd.returns)
+	}
+	return res
+}
+
+// completeConsole returns the candidates of the last word of the command line.
+// Command names are completed for the first word, and the choices and
+// the names of the arguments are completed for the following words.
+func completeConsole(line string) []string {
+	tokens, err := tokenizeConsole(line)
+	if err != nil {
+		return nil
+	}
+	var prefix string
+	if n := len(tokens); n > 0 && !strings.HasSuffix(line, " ") {
+		prefix = tokens[n-1].value
+		tokens = tokens[:n-1]
+	}
+	if len(tokens) == 0 {
+		var res []string
+		for _, name := range consoleCommandNames() {
+			if strings.HasPrefix(name, prefix) {
+				res = append(res, name)
+			}
+		}
+		return res
+	}
+
+	cmd, ok := consoleCommands[tokens[0].value]
+	if !ok {
+		return nil
+	}
+	pos := len(tokens) - 1
+	found := make(map[string]bool)
+	var res []string
+	add := func(s string) {
+		if strings.HasPrefix(s, prefix) && !found[s] {
+			found[s] = true
+			res = append(res, s)
+		}
+	}
+	for _, u := range cmd.usages {
+		if pos >= len(u) && !u.accepts(pos+1) {
+			continue
+		}
+		a := u[len(u)-1]
+		if pos < len(u) {
+			a = u[pos]
+		}
+		for _, c := range a.choices {
+			add(c)
+		}
+		if prefix != "" {
+			for _, a := range u {
+				if !a.variadic {
+					add(a.name + "=")
+				}
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConsole_Help(t *testing.T) {
+	c := &console{
+		cmd: newCommandContext(nil, nil),
+	}
+	res, err := c.Run("help cursor", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"cursor: Show the cursors, add a cursor or move the cursor of the ID",
+		"usage: cursor",
+		"usage: cursor x y z",
+		"usage: cursor id x y z",
+		"returns: [[id x y z]...]",
+	}
+	if !reflect.DeepEqual(expected, res) {
+		t.Errorf("Expected: %v, got: %v", expected, res)
+	}
+
+	res, err = c.Run("help", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := res.([]string); len(lines) != len(consoleCommands) {
+		t.Errorf("Expected %d lines, got: %d", len(consoleCommands), len(lines))
+	}
+
+	for name, cmd := range consoleCommands {
+		if cmd.description == "" {
+			t.Errorf("Command %s has no description", name)
+		}
+		if len(cmd.usages) == 0 {
+			t.Errorf("Command %s has no usage", name)
+		}
+	}
+}
+
+func TestCompleteConsole(t *testing.T) {
+	testCases := map[string][]string{
+		"snap_":              {"snap_h", "snap_pitch", "snap_v", "snap_yaw"},
+		"undo":               {"undo", "undo_to"},
+		"undo_":              {"undo_to"},
+		"foo":                nil,
+		"fit_inserting ":     {"pitch", "roll", "x", "y", "yaw", "z"},
+		"fit_inserting x y":  {"y", "yaw"},
+		"cursor 1 2 3 ":      nil,
+		"cursor x":           {"x="},
+		"segmentation_param": {"segmentation_param"},
+		`cursor "1`:          nil,
+	}
+	for line, expected := range testCases {
+		line, expected := line, expected
+		t.Run(line, func(t *testing.T) {
+			if res := completeConsole(line); !reflect.DeepEqual(expected, res) {
+				t.Errorf("Expected: %v, got: %v", expected, res)
+			}
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"errors"
 	"testing"
+
+	"github.com/seqsense/pcgol/mat"
 )
 
 func TestConsole_SelectRange(t *testing.T) {
@@ -36,3 +39,78 @@ func TestConsole_SelectRange(t *testing.T) {
 		t.Errorf("SelectRangeAuto must not be updated by setting rangeTypeOrtho, expected: 125, got: %f", v)
 	}
 }
+
+func TestConsole_History(t *testing.T) {
+	c := &console{
+		cmd: newCommandContext(nil, nil),
+	}
+	if err := c.cmd.editor.SetPointCloud(createPointCloud(t, false), cloudMain); err != nil {
+		t.Fatal(err)
+	}
+	c.cmd.SetSelectMask(make([]uint32, 3))
+	for _, l := range []uint32{4, 5} {
+		c.cmd.Label(l)
+	}
+	if _, err := c.Run("undo", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := c.Run("history", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		" 1 label points=+0 params=4",
+		"*2 label points=+0 params=5",
+	}
+	lines, ok := res.([]string)
+	if !ok || len(lines) != len(expected) {
+		t.Fatalf("Expected %v, got: %v", expected, res)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected %s, got: %s", expected[i], lines[i])
+		}
+	}
+
+	if _, err := c.Run("undo_to 2", nil); err != errOutOfRange {
+		t.Errorf("Expected %v, got: %v", errOutOfRange, err)
+	}
+	if _, err := c.Run("undo_to 0", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, pos := c.cmd.Journal(); pos != 0 {
+		t.Errorf("Expected position: 0, got: %d", pos)
+	}
+}
+
+func TestConsole_Arguments(t *testing.T) {
+	c := &console{
+		cmd: newCommandContext(nil, nil),
+	}
+	if _, err := c.Run("cursor z=3 x=1 2", nil); err != nil {
+		t.Fatal(err)
+	}
+	if cs := c.cmd.Cursors(); len(cs) != 1 || cs[0] != (mat.Vec3{1, 2, 3}) {
+		t.Errorf("Expected cursor: [1 2 3], got: %v", cs)
+	}
+
+	_, err := c.Run("cursor 1 2", nil)
+	if !errors.Is(err, errArgumentNumber) {
+		t.Errorf("Expected %v, got: %v", errArgumentNumber, err)
+	}
+	expected := "invalid number of arguments (usage: cursor | cursor x y z | cursor id x y z)"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error message %q, got: %v", expected, err)
+	}
+
+	_, err = c.Run("fit_inserting x pitch w", nil)
+	expected = `axis must be one of x, y, z, roll, pitch, yaw: "w" (usage: fit_inserting axis=x|y|z|roll|pitch|yaw... | fit_inserting axis...)`
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected error message %q, got: %v", expected, err)
+	}
+
+	if _, err := c.Run("foo", nil); !errors.Is(err, errInvalidCommand) {
+		t.Errorf("Expected %v, got: %v", errInvalidCommand, err)
+	}
+}
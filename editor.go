@@ -8,7 +8,7 @@ import (
 )
 
 const (
-	maxHistoryDefault = 4
+	maxHistoryDefault = 100
 )
 
 type editor struct {
@@ -17,6 +17,11 @@ type editor struct {
 	ppSub     *pc.PointCloud
 	ppSubRect rect
 
+	// schema is the header of the loaded cloud to export in the original form.
+	schema pc.PointCloudHeader
+	// georef is the LAS origin of the loaded cloud, or nil if it isn't LAS.
+	georef *lasGeoref
+
 	cropMatrix mat.Mat4
 }
 
@@ -36,25 +41,66 @@ func newEditor() *editor {
 type history interface {
 	MaxHistory() int
 	SetMaxHistory(m int)
-	push(pp *pc.PointCloud) *pc.PointCloud
-	pop() *pc.PointCloud
-	undo() (*pc.PointCloud, bool)
+	push(d delta, j journalEntry)
+	undo(pp *pc.PointCloud) (*pc.PointCloud, bool)
+	redo(pp *pc.PointCloud) (*pc.PointCloud, bool)
+	journal() ([]journalEntry, int)
 	clear()
 }
 
 func (e *editor) Undo() bool {
-	pp, ok := e.history.undo()
+	pp, ok := e.history.undo(e.pp)
+	if ok {
+		e.pp = pp
+		runtime.GC()
+	}
+	return ok
+}
+
+func (e *editor) Redo() bool {
+	pp, ok := e.history.redo(e.pp)
 	if ok {
 		e.pp = pp
+		runtime.GC()
 	}
 	return ok
 }
 
+// UndoTo undoes the edits until n entries of the journal are applied.
+func (e *editor) UndoTo(n int) bool {
+	_, pos := e.journal()
+	if n < 0 || n > pos {
+		return false
+	}
+	for ; pos > n; pos-- {
+		if !e.Undo() {
+			return false
+		}
+	}
+	return true
+}
+
+// commit applies the delta to the main cloud and records it to the history.
+func (e *editor) commit(j journalEntry, d delta) error {
+	pp, err := d.apply(e.pp)
+	if err != nil {
+		d.release()
+		return err
+	}
+	j.pointsDelta = pp.Points - e.pp.Points
+	e.pp = pp
+	e.push(d, j)
+	runtime.GC()
+	return nil
+}
+
 func (e *editor) Reset() {
 	e.clear()
 	e.pp = nil
 	e.ppSub = nil
 	e.ppSubRect = rect{}
+	e.schema = pc.PointCloudHeader{}
+	e.georef = nil
 	e.cropMatrix = mat.Mat4{}
 }
 
@@ -63,58 +109,40 @@ func (e *editor) Crop(origin mat.Mat4) {
 }
 
 func (e *editor) SetPointCloud(pp *pc.PointCloud, id cloudID) error {
+	return e.setPointCloud(pp, id, nil)
+}
+
+// setPointCloud sets the cloud loaded relative to the LAS origin georef.
+// georef is ignored for the sub cloud which must be translated to the origin of the main cloud.
+func (e *editor) setPointCloud(pp *pc.PointCloud, id cloudID, georef *lasGeoref) error {
 	if pp == nil && id == cloudSub {
 		e.ppSub = nil
 		runtime.GC()
 		return nil
 	}
-	var pcNew *pc.PointCloud
-	if len(pp.Fields) == 4 && pp.Fields[0] == "x" && pp.Fields[1] == "y" && pp.Fields[2] == "z" && pp.Fields[3] == "label" {
-		pcNew = pp
-	} else {
-		i, err := pp.Vec3Iterator()
-		if err != nil {
-			return err
-		}
-		iL, _ := pp.Uint32Iterator("label")
-
-		pcNew = &pc.PointCloud{
-			PointCloudHeader: pc.PointCloudHeader{
-				Version:   pp.Version,
-				Fields:    []string{"x", "y", "z", "label"},
-				Size:      []int{4, 4, 4, 4},
-				Type:      []string{"F", "F", "F", "U"},
-				Count:     []int{1, 1, 1, 1},
-				Viewpoint: pp.Viewpoint,
-				Width:     pp.Points,
-				Height:    1,
-			},
-			Points: pp.Points,
-		}
-		pcNew.Data = make([]byte, pp.Points*pcNew.Stride())
-
-		j, err := pcNew.Vec3Iterator()
-		if err != nil {
-			return err
-		}
-		jL, err := pcNew.Uint32Iterator("label")
-		if err != nil {
-			return err
-		}
-		for i.IsValid() && j.IsValid() {
-			j.SetVec3(i.Vec3())
-			j.Incr()
-			i.Incr()
-			if iL != nil {
-				jL.SetUint32(iL.Uint32())
-				jL.Incr()
-				iL.Incr()
-			}
-		}
+	h, err := editorHeader(&pp.PointCloudHeader)
+	if err != nil {
+		return err
+	}
+	if id == cloudSub && e.pp != nil {
+		// Sub cloud will be merged to the main cloud.
+		h = e.pp.PointCloudHeader
+	}
+	pcNew, err := convertFields(pp, &h)
+	if err != nil {
+		return err
 	}
 	switch id {
 	case cloudMain:
-		e.pp = e.push(pcNew)
+		if e.pp == nil {
+			e.schema = pp.PointCloudHeader.Clone()
+			e.georef = georef
+			e.pp = pcNew
+			break
+		}
+		if err := e.replaceWithSchema(journalEntry{name: "import"}, pcNew, pp.PointCloudHeader, georef); err != nil {
+			return err
+		}
 	case cloudSub:
 		e.ppSub = pcNew
 		it, err := pcNew.Vec3Iterator()
@@ -134,111 +162,90 @@ func (e *editor) SetPointCloud(pp *pc.PointCloud, id cloudID) error {
 	return nil
 }
 
-func (e *editor) label(fn func(int, mat.Vec3) (uint32, bool)) error {
-	pcNew := &pc.PointCloud{
-		PointCloudHeader: e.pp.PointCloudHeader.Clone(),
-		Points:           e.pp.Points,
-		Data:             make([]byte, len(e.pp.Data)),
-	}
-	copy(pcNew.Data, e.pp.Data)
-
-	it, err := pcNew.Vec3Iterator()
-	if err != nil {
-		return err
-	}
-	itL, err := pcNew.Uint32Iterator("label")
-	if err != nil {
-		return err
+// points returns the number of the points of the main cloud.
+func (e *editor) points() int {
+	if e.pp == nil {
+		return 0
 	}
+	return e.pp.Points
+}
 
-	i := 0
-	for it.IsValid() {
-		l, ok := fn(i, it.Vec3())
-		if ok {
-			itL.SetUint32(l)
-		}
-		it.Incr()
-		itL.Incr()
-		i++
+// exportable converts pp to the schema of the loaded cloud.
+func (e *editor) exportable(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	if len(e.schema.Fields) == 0 {
+		return pp, nil
 	}
-	e.pp = e.push(pcNew)
-	runtime.GC()
-	return nil
+	h := exportHeader(&e.schema)
+	return convertFields(pp, &h)
 }
 
-func (e *editor) passThrough(fn func(int, mat.Vec3) bool) error {
-	pp, err := passThrough(e.pp, fn)
+func (e *editor) label(j journalEntry, fn func(int, mat.Vec3) (uint32, bool)) error {
+	it, err := e.pp.Vec3Iterator()
 	if err != nil {
 		return err
 	}
-	e.pp = e.push(pp)
-	runtime.GC()
-	return nil
-}
-
-func (e *editor) passThroughByMask(sel []uint32, mask, val uint32) error {
-	pp, err := passThroughByMask(e.pp, sel, mask, val)
+	d, err := newLabelDelta(e.pp, func(i int, _ uint32) (uint32, bool) {
+		return fn(i, it.Vec3At(i))
+	})
 	if err != nil {
 		return err
 	}
-	e.pp = e.push(pp)
-	runtime.GC()
-	return nil
+	return e.commit(j, d)
 }
 
-func (e *editor) relabelPointsInLabelRange(minLabel, maxLabel, newLabel uint32) error {
-	_, err := e.pp.Uint32Iterator("label")
+func (e *editor) move(j journalEntry, fn func(int, mat.Vec3) (mat.Vec3, bool)) error {
+	d, err := newMoveDelta(e.pp, fn)
 	if err != nil {
 		return err
 	}
+	return e.commit(j, d)
+}
 
-	pcNew := &pc.PointCloud{
-		PointCloudHeader: e.pp.PointCloudHeader.Clone(),
-		Data:             make([]byte, len(e.pp.Data)),
-		Points:           e.pp.Points,
-	}
-	copy(pcNew.Data, e.pp.Data)
-	pcNew.Width = e.pp.Width
-	pcNew.Height = e.pp.Height
-
-	lt, err := pcNew.Uint32Iterator("label")
+func (e *editor) passThrough(j journalEntry, fn func(int, mat.Vec3) bool) error {
+	it, err := e.pp.Vec3Iterator()
 	if err != nil {
 		return err
 	}
+	return e.commit(j, newDeleteDelta(e.pp, func(i int) bool {
+		return !fn(i, it.Vec3At(i))
+	}))
+}
 
-	for ; lt.IsValid(); lt.Incr() {
-		l := lt.Uint32()
-		if l == newLabel || l < minLabel || l > maxLabel {
-			continue
-		}
-		lt.SetUint32(newLabel)
-	}
-
-	e.pp = e.push(pcNew)
-	runtime.GC()
-	return nil
+func (e *editor) passThroughByMask(j journalEntry, sel []uint32, mask, val uint32) error {
+	return e.commit(j, newDeleteDelta(e.pp, func(i int) bool {
+		return sel[i]&mask != val
+	}))
 }
 
-func (e *editor) unlabelPoints(labelsToKeep []uint32) error {
-	_, err := e.pp.Uint32Iterator("label")
+// passThroughAndMerge removes points not passing fn and adds pp
+// as a single history entry.
+func (e *editor) passThroughAndMerge(j journalEntry, fn func(int, mat.Vec3) bool, pp *pc.PointCloud) error {
+	it, err := e.pp.Vec3Iterator()
 	if err != nil {
 		return err
 	}
+	return e.commit(j, deltaSequence{
+		newDeleteDelta(e.pp, func(i int) bool {
+			return !fn(i, it.Vec3At(i))
+		}),
+		newAppendDelta(pp),
+	})
+}
 
-	pcNew := &pc.PointCloud{
-		PointCloudHeader: e.pp.PointCloudHeader.Clone(),
-		Data:             make([]byte, len(e.pp.Data)),
-		Points:           e.pp.Points,
-	}
-	copy(pcNew.Data, e.pp.Data)
-	pcNew.Width = e.pp.Width
-	pcNew.Height = e.pp.Height
-
-	lt, err := pcNew.Uint32Iterator("label")
+func (e *editor) relabelPointsInLabelRange(j journalEntry, minLabel, maxLabel, newLabel uint32) error {
+	d, err := newLabelDelta(e.pp, func(_ int, l uint32) (uint32, bool) {
+		if l < minLabel || l > maxLabel {
+			return 0, false
+		}
+		return newLabel, true
+	})
 	if err != nil {
 		return err
 	}
+	return e.commit(j, d)
+}
 
+func (e *editor) unlabelPoints(j journalEntry, labelsToKeep []uint32) error {
 	isInLabelsToKeep := func(l uint32) bool {
 		for _, kl := range labelsToKeep {
 			if kl == l {
@@ -248,16 +255,16 @@ func (e *editor) unlabelPoints(labelsToKeep []uint32) error {
 		return false
 	}
 
-	for ; lt.IsValid(); lt.Incr() {
-		if isInLabelsToKeep(lt.Uint32()) {
-			continue
+	d, err := newLabelDelta(e.pp, func(_ int, l uint32) (uint32, bool) {
+		if isInLabelsToKeep(l) {
+			return 0, false
 		}
-		lt.SetUint32(0)
+		return 0, true
+	})
+	if err != nil {
+		return err
 	}
-
-	e.pp = e.push(pcNew)
-	runtime.GC()
-	return nil
+	return e.commit(j, d)
 }
 
 func passThrough(pp *pc.PointCloud, fn func(int, mat.Vec3) bool) (*pc.PointCloud, error) {
@@ -347,15 +354,24 @@ func passThroughImpl(pp *pc.PointCloud, core func(_, _ *pc.PointCloud) int) (*pc
 	return pcNew, nil
 }
 
-func (e *editor) merge(pp *pc.PointCloud) {
-	pcNew := &pc.PointCloud{
-		PointCloudHeader: e.pp.PointCloudHeader.Clone(),
-		Points:           e.pp.Points + pp.Points,
-		Data:             append(e.pp.Data[:e.pp.Stride()*e.pp.Points], pp.Data...),
-	}
-	pcNew.Width = pcNew.Points
-	pcNew.Height = 1
+func (e *editor) merge(j journalEntry, pp *pc.PointCloud) error {
+	return e.commit(j, newAppendDelta(pp))
+}
 
-	e.pp = e.push(pcNew)
-	runtime.GC()
+// replace replaces whole main cloud by pp which must have the same fields.
+func (e *editor) replace(j journalEntry, pp *pc.PointCloud) error {
+	return e.replaceWithSchema(j, pp, e.schema, e.georef)
+}
+
+// replaceWithSchema replaces whole main cloud by pp loaded with the schema and the LAS origin.
+// The schema and the origin are switched together with the cloud on undo and redo.
+func (e *editor) replaceWithSchema(j journalEntry, pp *pc.PointCloud, schema pc.PointCloudHeader, georef *lasGeoref) error {
+	d := newReplaceDelta(e.pp, pp)
+	d.schema = &e.schema
+	d.before.schema = e.schema.Clone()
+	d.after.schema = schema.Clone()
+	d.georef = &e.georef
+	d.before.georef = e.georef
+	d.after.georef = georef
+	return e.commit(j, d)
 }
@@ -147,4 +147,65 @@ func TestSetPointCloud(t *testing.T) {
 		}
 		check(t, e.pp, indices)
 	}
+
+	it, err := e.pp.Float32Iterator("intensity")
+	if err != nil {
+		t.Fatal("Intensity field must be preserved")
+	}
+	for i := 0; it.IsValid(); it.Incr() {
+		if v := it.Float32(); v != intensities[i] {
+			t.Errorf("Expected intensity: %f, got: %f", intensities[i], v)
+		}
+		i++
+	}
+	out, err := e.exportable(e.pp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"x", "y", "z", "intensity", "label"}
+	if !reflect.DeepEqual(expected, out.Fields) {
+		t.Errorf("Expected exported fields: %v, got: %v", expected, out.Fields)
+	}
+
+	// Schema must be switched with the cloud
+	if !e.Undo() {
+		t.Fatal("Undo failed")
+	}
+	if expected := []string{"x", "y", "z", "label"}; !reflect.DeepEqual(expected, e.schema.Fields) {
+		t.Errorf("Expected schema fields after undo: %v, got: %v", expected, e.schema.Fields)
+	}
+	if !e.Redo() {
+		t.Fatal("Redo failed")
+	}
+	if !reflect.DeepEqual(expected, e.schema.Fields) {
+		t.Errorf("Expected schema fields after redo: %v, got: %v", expected, e.schema.Fields)
+	}
+}
+
+func TestSetPointCloud_Georef(t *testing.T) {
+	e := newEditor()
+	georef := &lasGeoref{scale: [3]float64{0.01, 0.01, 0.01}, offset: [3]float64{500000, 4000000, 0}}
+	if err := e.setPointCloud(createPointCloud(t, false), cloudMain, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.setPointCloud(createPointCloud(t, false), cloudMain, georef); err != nil {
+		t.Fatal(err)
+	}
+	if e.georef != georef {
+		t.Fatalf("Expected georef %+v, got: %+v", georef, e.georef)
+	}
+
+	// LAS origin must be switched with the cloud
+	if !e.Undo() {
+		t.Fatal("Undo failed")
+	}
+	if e.georef != nil {
+		t.Errorf("Expected no georef after undo, got: %+v", e.georef)
+	}
+	if !e.Redo() {
+		t.Fatal("Redo failed")
+	}
+	if e.georef != georef {
+		t.Errorf("Expected georef %+v after redo, got: %+v", georef, e.georef)
+	}
 }
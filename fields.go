@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+var errNoVec3Fields = errors.New("x, y and z fields must be 4 bytes float")
+
+// editorHeader returns the header of the cloud stored in the editor.
+// x, y, z and label are placed at the beginning to be rendered directly,
+// and the other fields follow in the original order.
+// label is added if the input doesn't have it.
+func editorHeader(h *pc.PointCloudHeader) (pc.PointCloudHeader, error) {
+	out := pc.PointCloudHeader{
+		Version:   h.Version,
+		Viewpoint: h.Viewpoint,
+		Fields:    []string{"x", "y", "z", "label"},
+		Size:      []int{4, 4, 4, 4},
+		Type:      []string{"F", "F", "F", "U"},
+		Count:     []int{1, 1, 1, 1},
+	}
+	for _, f := range out.Fields[:3] {
+		i := fieldIndex(h, f, 0)
+		if i < 0 || h.Type[i] != "F" || h.Size[i] != 4 || h.Count[i] != 1 {
+			return pc.PointCloudHeader{}, errNoVec3Fields
+		}
+	}
+	for i, f := range h.Fields {
+		switch f {
+		case "x", "y", "z", "label":
+			continue
+		}
+		out.Fields = append(out.Fields, f)
+		out.Size = append(out.Size, h.Size[i])
+		out.Type = append(out.Type, h.Type[i])
+		out.Count = append(out.Count, h.Count[i])
+	}
+	return out, nil
+}
+
+// exportHeader returns the header to export the cloud loaded with the schema.
+// label is appended if the schema doesn't have it to keep the edited labels.
+func exportHeader(schema *pc.PointCloudHeader) pc.PointCloudHeader {
+	out := schema.Clone()
+	if fieldIndex(schema, "label", 0) < 0 {
+		out.Fields = append(out.Fields, "label")
+		out.Size = append(out.Size, 4)
+		out.Type = append(out.Type, "U")
+		out.Count = append(out.Count, 1)
+	}
+	return out
+}
+
+// fieldIndex returns the index of n-th field of the name.
+// n is used to distinguish fields having the same name like padding ("_").
+func fieldIndex(h *pc.PointCloudHeader, name string, n int) int {
+	for i, f := range h.Fields {
+		if f == name {
+			if n == 0 {
+				return i
+			}
+			n--
+		}
+	}
+	return -1
+}
+
+func sameFields(a, b *pc.PointCloudHeader) bool {
+	if len(a.Fields) != len(b.Fields) {
+		return false
+	}
+	for i := range a.Fields {
+		if a.Fields[i] != b.Fields[i] || a.Size[i] != b.Size[i] ||
+			a.Type[i] != b.Type[i] || a.Count[i] != b.Count[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type fieldCopy struct {
+	src, dst   int // byte offset in the point
+	srcT, dstT string
+	srcS, dstS int
+	count      int
+}
+
+// convertFields converts the cloud to have the fields of h.
+// Fields are matched by the name, missing fields are filled by zero,
+// and the values are converted if the types are different.
+// pp is returned as is if it already has the fields of h.
+func convertFields(pp *pc.PointCloud, h *pc.PointCloudHeader) (*pc.PointCloud, error) {
+	if sameFields(&pp.PointCloudHeader, h) {
+		return pp, nil
+	}
+	var copies []fieldCopy
+	seen := make(map[string]int)
+	var dstOff int
+	for i, f := range h.Fields {
+		n := seen[f]
+		seen[f]++
+		if j := fieldIndex(&pp.PointCloudHeader, f, n); j >= 0 {
+			if !isNumericType(pp.Type[j], pp.Size[j]) || !isNumericType(h.Type[i], h.Size[i]) {
+				return nil, fmt.Errorf("unsupported type of field %s", f)
+			}
+			srcOff, _ := fieldOffsetAt(&pp.PointCloudHeader, j)
+			count := h.Count[i]
+			if pp.Count[j] < count {
+				count = pp.Count[j]
+			}
+			copies = append(copies, fieldCopy{
+				src: srcOff, dst: dstOff,
+				srcT: pp.Type[j], dstT: h.Type[i],
+				srcS: pp.Size[j], dstS: h.Size[i],
+				count: count,
+			})
+		}
+		dstOff += h.Size[i] * h.Count[i]
+	}
+
+	out := &pc.PointCloud{
+		PointCloudHeader: h.Clone(),
+		Points:           pp.Points,
+	}
+	out.Width, out.Height = pp.Points, 1
+	sStride, dStride := pp.Stride(), out.Stride()
+	out.Data = make([]byte, pp.Points*dStride)
+	for i := 0; i < pp.Points; i++ {
+		src := pp.Data[i*sStride : (i+1)*sStride]
+		dst := out.Data[i*dStride : (i+1)*dStride]
+		for _, c := range copies {
+			if c.srcT == c.dstT && c.srcS == c.dstS {
+				copy(dst[c.dst:c.dst+c.dstS*c.count], src[c.src:])
+				continue
+			}
+			for k := 0; k < c.count; k++ {
+				v := readNumber(src[c.src+k*c.srcS:], c.srcT, c.srcS)
+				writeNumber(dst[c.dst+k*c.dstS:], c.dstT, c.dstS, v)
+			}
+		}
+	}
+	return out, nil
+}
+
+func fieldOffsetAt(h *pc.PointCloudHeader, idx int) (int, bool) {
+	if idx < 0 || idx >= len(h.Fields) {
+		return 0, false
+	}
+	var off int
+	for i := 0; i < idx; i++ {
+		off += h.Size[i] * h.Count[i]
+	}
+	return off, true
+}
+
+func isNumericType(t string, size int) bool {
+	switch t {
+	case "U", "I":
+		return size == 1 || size == 2 || size == 4 || size == 8
+	case "F":
+		return size == 4 || size == 8
+	}
+	return false
+}
+
+func readNumber(b []byte, t string, size int) float64 {
+	switch t {
+	case "F":
+		if size == 4 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	case "I":
+		switch size {
+		case 1:
+			return float64(int8(b[0]))
+		case 2:
+			return float64(int16(binary.LittleEndian.Uint16(b)))
+		case 4:
+			return float64(int32(binary.LittleEndian.Uint32(b)))
+		}
+		return float64(int64(binary.LittleEndian.Uint64(b)))
+	default:
+		switch size {
+		case 1:
+			return float64(b[0])
+		case 2:
+			return float64(binary.LittleEndian.Uint16(b))
+		case 4:
+			return float64(binary.LittleEndian.Uint32(b))
+		}
+		return float64(binary.LittleEndian.Uint64(b))
+	}
+}
+
+func writeNumber(b []byte, t string, size int, v float64) {
+	switch t {
+	case "F":
+		if size == 4 {
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+			return
+		}
+		binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+	case "I":
+		switch size {
+		case 1:
+			b[0] = byte(int8(v))
+		case 2:
+			binary.LittleEndian.PutUint16(b, uint16(int16(v)))
+		case 4:
+			binary.LittleEndian.PutUint32(b, uint32(int32(v)))
+		default:
+			binary.LittleEndian.PutUint64(b, uint64(int64(v)))
+		}
+	default:
+		switch size {
+		case 1:
+			b[0] = byte(v)
+		case 2:
+			binary.LittleEndian.PutUint16(b, uint16(v))
+		case 4:
+			binary.LittleEndian.PutUint32(b, uint32(v))
+		default:
+			binary.LittleEndian.PutUint64(b, uint64(v))
+		}
+	}
+}
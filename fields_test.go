@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+func TestEditorHeader(t *testing.T) {
+	t.Run("Reorder", func(t *testing.T) {
+		h, err := editorHeader(&pc.PointCloudHeader{
+			Fields: []string{"intensity", "x", "y", "z", "_", "normal"},
+			Size:   []int{2, 4, 4, 4, 1, 4},
+			Type:   []string{"U", "F", "F", "F", "U", "F"},
+			Count:  []int{1, 1, 1, 1, 4, 3},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := pc.PointCloudHeader{
+			Fields: []string{"x", "y", "z", "label", "intensity", "_", "normal"},
+			Size:   []int{4, 4, 4, 4, 2, 1, 4},
+			Type:   []string{"F", "F", "F", "U", "U", "U", "F"},
+			Count:  []int{1, 1, 1, 1, 1, 4, 3},
+		}
+		if !reflect.DeepEqual(expected, h) {
+			t.Errorf("Expected:\n%+v\nGot:\n%+v", expected, h)
+		}
+	})
+	t.Run("NoXYZ", func(t *testing.T) {
+		_, err := editorHeader(&pc.PointCloudHeader{
+			Fields: []string{"x", "y", "z"},
+			Size:   []int{8, 8, 8},
+			Type:   []string{"F", "F", "F"},
+			Count:  []int{1, 1, 1},
+		})
+		if err != errNoVec3Fields {
+			t.Errorf("Expected %v, got: %v", errNoVec3Fields, err)
+		}
+	})
+}
+
+func TestConvertFields(t *testing.T) {
+	in := &pc.PointCloud{
+		PointCloudHeader: pc.PointCloudHeader{
+			Fields: []string{"label", "x", "y", "z", "_", "intensity", "_"},
+			Size:   []int{2, 4, 4, 4, 1, 4, 1},
+			Type:   []string{"U", "F", "F", "F", "U", "F", "U"},
+			Count:  []int{1, 1, 1, 1, 1, 1, 1},
+			Width:  2,
+			Height: 1,
+		},
+		Points: 2,
+	}
+	in.Data = make([]byte, in.Stride()*2)
+	for i := 0; i < 2; i++ {
+		p := in.Data[i*in.Stride():]
+		binary.LittleEndian.PutUint16(p[0:], uint16(10+i))
+		binary.LittleEndian.PutUint32(p[2:], math.Float32bits(float32(i)))
+		binary.LittleEndian.PutUint32(p[6:], math.Float32bits(2))
+		binary.LittleEndian.PutUint32(p[10:], math.Float32bits(3))
+		p[14] = 0xAA
+		binary.LittleEndian.PutUint32(p[15:], math.Float32bits(0.5))
+		p[19] = 0xBB
+	}
+
+	h, err := editorHeader(&in.PointCloudHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := convertFields(in, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.Points != 2 || out.Width != 2 || out.Height != 1 {
+		t.Fatalf("Unexpected size: %d (%dx%d)", out.Points, out.Width, out.Height)
+	}
+	expectLabels := []uint32{10, 11}
+	lt, err := out.Uint32Iterator("label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; lt.IsValid(); lt.Incr() {
+		if l := lt.Uint32(); l != expectLabels[i] {
+			t.Errorf("Expected label %d, got: %d", expectLabels[i], l)
+		}
+		i++
+	}
+	ft, err := out.Float32Iterator("intensity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ; ft.IsValid(); ft.Incr() {
+		if v := ft.Float32(); v != 0.5 {
+			t.Errorf("Expected intensity 0.5, got: %f", v)
+		}
+	}
+
+	// Convert back to the original schema
+	back, err := convertFields(out, &in.PointCloudHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in.Data, back.Data) {
+		t.Errorf("Expected:\n%v\nGot:\n%v", in.Data, back.Data)
+	}
+
+	if same, err := convertFields(out, &h); err != nil || same != out {
+		t.Error("Cloud with the same fields must be returned as is")
+	}
+}
+
+func TestExportHeader(t *testing.T) {
+	h := exportHeader(&pc.PointCloudHeader{
+		Fields: []string{"x", "y", "z", "intensity"},
+		Size:   []int{4, 4, 4, 4},
+		Type:   []string{"F", "F", "F", "F"},
+		Count:  []int{1, 1, 1, 1},
+	})
+	expected := []string{"x", "y", "z", "intensity", "label"}
+	if !reflect.DeepEqual(expected, h.Fields) {
+		t.Errorf("Expected: %v, got: %v", expected, h.Fields)
+	}
+}
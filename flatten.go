@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+type flattenPlane int
+
+const (
+	flattenPlaneFit flattenPlane = iota
+	flattenPlaneRect
+)
+
+var flattenPlaneNames = []string{"fit", "rect"}
+
+// Flatten projects the selected points onto the plane fitted to the selected points
+// or the plane of the rectangle selected by 3 cursors.
+// Points farther than the tolerance from the plane are kept untouched.
+// All selected points are projected if the tolerance is 0.
+// It returns the plane and the number of the projected points.
+func (c *commandContext) Flatten(src flattenPlane, tolerance float32) (plane, int, error) {
+	if tolerance < 0 {
+		return plane{}, 0, errors.New("tolerance must not be negative")
+	}
+	indice, err := c.selectedIndice()
+	if err != nil {
+		return plane{}, 0, err
+	}
+	it, err := c.editor.pp.Vec3Iterator()
+	if err != nil {
+		return plane{}, 0, err
+	}
+
+	var p plane
+	switch src {
+	case flattenPlaneRect:
+		if c.selectMode != selectModeRect || len(c.selected) < 3 {
+			return plane{}, 0, errors.New("rectangle is not selected")
+		}
+		var ok bool
+		if p, ok = planeFrom3Points(c.selected[0], c.selected[1], c.selected[2]); !ok {
+			return plane{}, 0, errors.New("cursors are on a line")
+		}
+	default:
+		ra := pc.NewIndiceVec3RandomAccessor(it, indice)
+		if tolerance > 0 {
+			planes := extractPlanes(ra, tolerance, 1, 3)
+			if len(planes) == 0 {
+				return plane{}, 0, errors.New("failed to fit plane")
+			}
+			p = planes[0]
+		} else {
+			all := make([]int, len(indice))
+			for i := range all {
+				all[i] = i
+			}
+			var ok bool
+			if p, ok = refinePlane(ra, all); !ok {
+				return plane{}, 0, errors.New("failed to fit plane")
+			}
+		}
+	}
+	p.orient()
+
+	move := make([]bool, c.editor.pp.Points)
+	var n int
+	for _, i := range indice {
+		if tolerance == 0 || p.distance(it.Vec3At(i)) <= tolerance {
+			move[i] = true
+			n++
+		}
+	}
+	err = c.editor.move(
+		c.newJournal("flatten", p.normal[0], p.normal[1], p.normal[2], p.d, tolerance),
+		func(i int, v mat.Vec3) (mat.Vec3, bool) {
+			if !move[i] {
+				return v, false
+			}
+			return v.Sub(p.normal.Mul(p.normal.Dot(v) + p.d)), true
+		},
+	)
+	if err != nil {
+		return plane{}, 0, err
+	}
+	p.inliers = nil
+	c.setPointCloudUpdated()
+	return p, n, nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestFlatten(t *testing.T) {
+	// 5cm thick floor and a box on it
+	var vs []mat.Vec3
+	for i := 0; i < 10; i++ {
+		for j := 0; j < 10; j++ {
+			vs = append(vs, mat.Vec3{float32(i) * 0.1, float32(j) * 0.1, float32((i+j)%3) * 0.025})
+		}
+	}
+	vs = append(vs, mat.Vec3{0.5, 0.5, 0.5})
+
+	newConsole := func(t *testing.T) *console {
+		c := newTestConsole(t, vs...)
+		mask := make([]uint32, len(vs))
+		for i := range mask {
+			mask[i] = selectBitmaskSelected
+		}
+		c.cmd.SetSelectMask(mask)
+		for i, p := range []mat.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}} {
+			c.cmd.SetCursor(i, p)
+		}
+		return c
+	}
+	heights := func(c *console) []float32 {
+		it, err := c.cmd.editor.pp.Vec3Iterator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var zs []float32
+		for ; it.IsValid(); it.Incr() {
+			zs = append(zs, it.Vec3()[2])
+		}
+		return zs
+	}
+
+	t.Run("Fit", func(t *testing.T) {
+		c := newConsole(t)
+		res, err := c.Run("flatten fit 0.1", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := res.([][]float32)[0]
+		if math.Abs(float64(r[2]-1)) > 0.01 || r[4] != 100 {
+			t.Errorf("Unexpected result %v", r)
+		}
+		zs := heights(c)
+		for i, z := range zs[:100] {
+			if math.Abs(float64(z-zs[0])) > 0.001 {
+				t.Errorf("Point %d must be flattened to %f, got %f", i, zs[0], z)
+			}
+		}
+		if zs[100] != 0.5 {
+			t.Errorf("Outlier must be kept, got %f", zs[100])
+		}
+
+		if !c.cmd.Undo() {
+			t.Fatal("Undo failed")
+		}
+		expectPointCloud(t, c.cmd.editor.pp, vs)
+	})
+	t.Run("Rect", func(t *testing.T) {
+		c := newConsole(t)
+		if _, err := c.Run("flatten rect 0", noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		for i, z := range heights(c) {
+			if z != 0 {
+				t.Errorf("Point %d must be projected onto z=0, got %f", i, z)
+			}
+		}
+	})
+	t.Run("NoSelection", func(t *testing.T) {
+		c := newConsole(t)
+		c.cmd.UnsetCursors()
+		if _, err := c.Run("flatten fit 0.1", noUpdate); err == nil {
+			t.Error("Expected error without selection")
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/seqsense/pcdeditor/pcd"
+	"github.com/seqsense/pcgol/pc"
+)
+
+type pointCloudFormat int
+
+const (
+	formatAuto pointCloudFormat = iota // detect from the file header on import, PCD on export
+	formatPCD
+	formatLAS
+	formatPLY
+	formatXYZ // space separated text
+	formatCSV // comma separated text with a header row
+)
+
+// defaultMaxPointCloudBytes is the default memory budget of the point data (1.5GiB).
+// WebAssembly can't use more than 4GiB and the editor makes a copy of the data.
+const defaultMaxPointCloudBytes = 3 << 29
+
+var pointCloudFormatNames = []string{"auto", "pcd", "las", "ply", "xyz", "csv"}
+
+func (f pointCloudFormat) String() string {
+	return pointCloudFormatNames[f]
+}
+
+func (f pointCloudFormat) mimeType() string {
+	switch f {
+	case formatLAS:
+		return "application/vnd.las"
+	case formatPLY:
+		return "application/x-ply"
+	case formatXYZ:
+		return "text/plain"
+	case formatCSV:
+		return "text/csv"
+	default:
+		return "application/x-pcd"
+	}
+}
+
+// formatOptions is the file format and the format specific options.
+type formatOptions struct {
+	format pointCloudFormat
+	text   textOptions
+	georef *lasGeoref // filled on LAS import and used to restore the coordinates on export, or nil
+
+	// Import options of PCD
+	ctx      context.Context         // to cancel loading, or nil
+	progress func(loaded, total int) // called during loading with the number of loaded points, or nil
+	maxBytes int                     // memory budget of the point data, or 0 to use defaultMaxPointCloudBytes
+
+	// Export options
+	encoding  string    // data encoding, ascii, binary (default) or binary_compressed (PCD only)
+	fields    []string  // fields to be exported, or nil to export all fields
+	precision int       // significant digits of floats in text, or 0 for the shortest representation
+	viewpoint []float32 // viewpoint (tx ty tz qw qx qy qz) overriding the original one
+}
+
+// parsePointCloudFormat parses the format name. Empty string means formatAuto.
+func parsePointCloudFormat(s string) (pointCloudFormat, error) {
+	if s == "" {
+		return formatAuto, nil
+	}
+	if i := indexOf(pointCloudFormatNames, s); i >= 0 {
+		return pointCloudFormat(i), nil
+	}
+	return formatAuto, fmt.Errorf("unknown point cloud format %q", s)
+}
+
+// formatDetectionSize is the size of the beginning of the file to detect the format.
+// It should cover the leading comments.
+const formatDetectionSize = 4096
+
+// detectPointCloudFormat detects the format from the beginning of the file.
+func detectPointCloudFormat(head []byte) pointCloudFormat {
+	switch {
+	case isLAS(head):
+		return formatLAS
+	case isPLY(head):
+		return formatPLY
+	case isPCD(head):
+		return formatPCD
+	}
+	return formatXYZ
+}
+
+var pcdHeaderKeys = []string{
+	"VERSION", "FIELDS", "SIZE", "TYPE", "COUNT", "WIDTH", "HEIGHT", "VIEWPOINT", "POINTS", "DATA",
+}
+
+// isPCD returns true if the first line except comments is a PCD header entry.
+// Comments are also used in XYZ files, like "# x y z".
+func isPCD(head []byte) bool {
+	for len(head) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(head, '\n'); i >= 0 {
+			line, head = head[:i], head[i+1:]
+		} else {
+			line, head = head, nil
+		}
+		tokens := bytes.Fields(line)
+		if len(tokens) == 0 || tokens[0][0] == '#' {
+			continue
+		}
+		return indexOf(pcdHeaderKeys, string(tokens[0])) >= 0
+	}
+	return false
+}
+
+// unmarshalPointCloud reads the point cloud in the format.
+// If the format is formatAuto, it is detected from the file header.
+func unmarshalPointCloud(r io.Reader, opts formatOptions) (*pc.PointCloud, error) {
+	f := opts.format
+	if f == formatAuto {
+		br := bufio.NewReader(r)
+		head, err := br.Peek(formatDetectionSize)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		f = detectPointCloudFormat(head)
+		r = br
+	}
+	maxBytes := opts.maxBytes
+	if maxBytes == 0 {
+		maxBytes = defaultMaxPointCloudBytes
+	}
+	switch f {
+	case formatLAS:
+		return unmarshalLAS(r, maxBytes, opts.georef)
+	case formatPLY:
+		return unmarshalPLY(r, maxBytes)
+	case formatXYZ, formatCSV:
+		return unmarshalText(r, opts.text, maxBytes)
+	default:
+		ctx := opts.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		return pcd.Decode(ctx, r, pcd.Options{
+			MaxBytes: maxBytes,
+			Progress: opts.progress,
+		})
+	}
+}
+
+// checkPointCloudBytes returns an error if n points of the stride exceed the memory budget.
+// It is checked before allocating the point data of the size written in the file header.
+func checkPointCloudBytes(n, stride, maxBytes int) error {
+	if n < 0 {
+		return fmt.Errorf("invalid number of points %d", n)
+	}
+	if maxBytes > 0 && stride > 0 && n > maxBytes/stride {
+		return fmt.Errorf("%w: %d points require %d bytes but the budget is %d bytes",
+			pcd.ErrTooLarge, n, int64(n)*int64(stride), maxBytes)
+	}
+	return nil
+}
+
+func marshalPointCloud(pp *pc.PointCloud, w io.Writer, opts formatOptions) error {
+	pp, err := applyExportOptions(pp, opts)
+	if err != nil {
+		return err
+	}
+	if opts.georef != nil && opts.format != formatLAS {
+		// Restore the absolute coordinates
+		pp2 := newPointCloudLike(pp, pp.Points)
+		copy(pp2.Data, pp.Data)
+		if err := translatePointCloud(pp2, opts.georef.offset); err != nil {
+			return err
+		}
+		pp = pp2
+	}
+	switch opts.format {
+	case formatLAS:
+		return marshalLAS(pp, w, opts.georef)
+	case formatPLY:
+		switch opts.encoding {
+		case "", "binary":
+			return marshalPLY(pp, w, false, opts.precision)
+		case "ascii":
+			return marshalPLY(pp, w, true, opts.precision)
+		}
+		return fmt.Errorf("unsupported PLY encoding %q", opts.encoding)
+	case formatXYZ:
+		return marshalText(pp, w, " ", false, opts.precision)
+	case formatCSV:
+		return marshalText(pp, w, ",", true, opts.precision)
+	default:
+		return marshalPCD(pp, w, opts.encoding, opts.precision)
+	}
+}
+
+// applyExportOptions extracts the fields and overrides the viewpoint.
+// pp is not modified.
+func applyExportOptions(pp *pc.PointCloud, opts formatOptions) (*pc.PointCloud, error) {
+	if opts.fields != nil {
+		h := pc.PointCloudHeader{
+			Version:   pp.Version,
+			Viewpoint: pp.Viewpoint,
+		}
+		for _, f := range opts.fields {
+			if fieldIndex(&h, f, 0) >= 0 {
+				return nil, fmt.Errorf("duplicated field %s", f)
+			}
+			i := fieldIndex(&pp.PointCloudHeader, f, 0)
+			if i < 0 {
+				return nil, fmt.Errorf("point cloud doesn't have %s field", f)
+			}
+			h.Fields = append(h.Fields, f)
+			h.Size = append(h.Size, pp.Size[i])
+			h.Type = append(h.Type, pp.Type[i])
+			h.Count = append(h.Count, pp.Count[i])
+		}
+		var err error
+		if pp, err = convertFields(pp, &h); err != nil {
+			return nil, err
+		}
+	}
+	if opts.viewpoint != nil {
+		if len(opts.viewpoint) != 7 {
+			return nil, errors.New("viewpoint must have 7 values (tx ty tz qw qx qy qz)")
+		}
+		cp := *pp
+		cp.Viewpoint = opts.viewpoint
+		pp = &cp
+	}
+	return pp, nil
+}
+
+var fieldNameAliases = map[string]string{
+	"nx":             "normal_x",
+	"ny":             "normal_y",
+	"nz":             "normal_z",
+	"r":              "red",
+	"g":              "green",
+	"b":              "blue",
+	"i":              "intensity",
+	"classification": "label",
+}
+
+// normalizeFieldName converts the property or column name used by other tools
+// (e.g. "//X", "scalar_Intensity", "nx") to the field name.
+func normalizeFieldName(name string) string {
+	name = strings.ToLower(strings.TrimLeft(strings.TrimSpace(name), "/#"))
+	name = strings.TrimPrefix(name, "scalar_")
+	if a, ok := fieldNameAliases[name]; ok {
+		return a
+	}
+	return name
+}
+
+// plyPropertyName returns the property name commonly used in PLY.
+func plyPropertyName(field string) string {
+	switch field {
+	case "normal_x":
+		return "nx"
+	case "normal_y":
+		return "ny"
+	case "normal_z":
+		return "nz"
+	}
+	return field
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+// groundParam is the parameter of the ground segmentation.
+type groundParam struct {
+	cell   float32 // grid cell size [m]
+	slope  float32 // maximum terrain slope (rise/run)
+	height float32 // height threshold from the ground surface [m]
+	window float32 // maximum window size of the morphological filter [m]
+}
+
+// maxGroundGridCells is the maximum number of the cells of the ground grid.
+// The morphological filter keeps a few copies of the grid of 4 bytes per cell.
+const maxGroundGridCells = 1 << 24
+
+var defaultGroundParam = groundParam{
+	cell:   0.5,
+	slope:  0.3,
+	height: 0.2,
+	window: 16,
+}
+
+func (p groundParam) validate() error {
+	if p.cell <= 0 || p.window < p.cell {
+		return errors.New("cell must be positive and window must be larger than cell")
+	}
+	if p.slope < 0 || p.height < 0 {
+		return errors.New("slope and height must not be negative")
+	}
+	return nil
+}
+
+// groundGrid is the 2D grid of the elevation.
+// Empty cells have +Inf.
+type groundGrid struct {
+	nx, ny int
+	z      []float32
+}
+
+// morph applies the erosion (min) or the dilation (max) of the square window of 2r+1 cells.
+// Empty cells are ignored.
+func (g *groundGrid) morph(r int, max bool) *groundGrid {
+	better := func(a, b float32) bool {
+		if max {
+			return math.IsInf(float64(b), 1) || (!math.IsInf(float64(a), 1) && a > b)
+		}
+		return a < b
+	}
+	inf := float32(math.Inf(1))
+	pass := func(src []float32, n, m int, at func(i, j int) int) []float32 {
+		dst := make([]float32, len(src))
+		for j := 0; j < m; j++ {
+			for i := 0; i < n; i++ {
+				v := inf
+				for k := i - r; k <= i+r; k++ {
+					if k < 0 || k >= n {
+						continue
+					}
+					if s := src[at(k, j)]; better(s, v) {
+						v = s
+					}
+				}
+				dst[at(i, j)] = v
+			}
+		}
+		return dst
+	}
+	z := pass(g.z, g.nx, g.ny, func(x, y int) int { return x + y*g.nx })
+	z = pass(z, g.ny, g.nx, func(y, x int) int { return x + y*g.nx })
+	return &groundGrid{nx: g.nx, ny: g.ny, z: z}
+}
+
+// groundPoints returns true for the ground points extracted by the progressive morphological filter.
+// The window of the morphological opening is enlarged exponentially and the points higher than
+// the opened surface by the threshold depending on the slope and the window size are removed.
+// It fails if the grid covering the points exceeds maxGroundGridCells.
+func groundPoints(ra pc.Vec3RandomAccessor, p groundParam) ([]bool, error) {
+	n := ra.Len()
+	ground := make([]bool, n)
+	if n == 0 {
+		return ground, nil
+	}
+	min, max := ra.Vec3At(0), ra.Vec3At(0)
+	for i := 1; i < n; i++ {
+		v := ra.Vec3At(i)
+		min, max = vec3Min(min, v), vec3Max(max, v)
+	}
+	nx := math.Floor(float64((max[0]-min[0])/p.cell)) + 1
+	ny := math.Floor(float64((max[1]-min[1])/p.cell)) + 1
+	if nx*ny > maxGroundGridCells {
+		return nil, fmt.Errorf("ground grid of %.0fx%.0f cells exceeds %d cells, crop the area or enlarge the cell", nx, ny, maxGroundGridCells)
+	}
+	g := &groundGrid{nx: int(nx), ny: int(ny)}
+	g.z = make([]float32, g.nx*g.ny)
+	for i := range g.z {
+		g.z[i] = float32(math.Inf(1))
+	}
+	cells := make([]int, n)
+	for i := 0; i < n; i++ {
+		v := ra.Vec3At(i)
+		c := int((v[0]-min[0])/p.cell) + int((v[1]-min[1])/p.cell)*g.nx
+		cells[i] = c
+		if v[2] < g.z[c] {
+			g.z[c] = v[2]
+		}
+		ground[i] = true
+	}
+
+	wPrev := 1
+	for r := 1; float32(2*r+1)*p.cell <= p.window; r *= 2 {
+		w := 2*r + 1
+		g = g.morph(r, false).morph(r, true)
+		th := p.height + p.slope*float32(w-wPrev)*p.cell
+		for i := 0; i < n; i++ {
+			if ground[i] && ra.Vec3At(i)[2]-g.z[cells[i]] > th {
+				ground[i] = false
+			}
+		}
+		wPrev = w
+	}
+	return ground, nil
+}
+
+func (c *commandContext) GroundParam() groundParam {
+	return c.groundParam
+}
+
+func (c *commandContext) SetGroundParam(p groundParam) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	c.groundParam = p
+	return nil
+}
+
+// groundMask extracts the ground from the points in the crop box.
+// Selection mask must be updated before calling it to exclude the cropped points.
+func (c *commandContext) groundMask() ([]bool, error) {
+	if err := c.checkSelectMask(); err != nil {
+		return nil, err
+	}
+	it, err := c.editor.pp.Vec3Iterator()
+	if err != nil {
+		return nil, err
+	}
+	var indice []int
+	for i, m := range c.selectMask {
+		if m&selectBitmaskCropped == 0 {
+			indice = append(indice, i)
+		}
+	}
+	gs, err := groundPoints(pc.NewIndiceVec3RandomAccessor(it, indice), c.groundParam)
+	if err != nil {
+		return nil, err
+	}
+	ground := make([]bool, c.editor.pp.Points)
+	for i, g := range gs {
+		ground[indice[i]] = g
+	}
+	return ground, nil
+}
+
+// SelectGround selects the ground points in the crop box to preview the ground segmentation.
+// The selection is combined with the current selection by the select operation.
+func (c *commandContext) SelectGround() error {
+	if c.selectMode == selectModeInsert {
+		return errors.New("selection is not available in insert mode")
+	}
+	ground, err := c.groundMask()
+	if err != nil {
+		return err
+	}
+	c.beginMaskSelection()
+	for i, g := range ground {
+		if g {
+			c.selectMask[i] |= selectBitmaskSegmentSelected
+		}
+	}
+	c.endMaskSelection()
+	return nil
+}
+
+// LabelGround sets the label to the ground points in the crop box.
+func (c *commandContext) LabelGround(l uint32) error {
+	ground, err := c.groundMask()
+	if err != nil {
+		return err
+	}
+	p := c.groundParam
+	err = c.editor.label(
+		c.newJournal("label_ground", float32(l), p.cell, p.slope, p.height, p.window),
+		func(i int, _ mat.Vec3) (uint32, bool) {
+			return l, ground[i]
+		},
+	)
+	if err != nil {
+		return err
+	}
+	c.setPointCloudUpdated()
+	return nil
+}
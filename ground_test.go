@@ -0,0 +1,155 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+// groundTestTerrain returns the sloped and rippled terrain with a building and tree points.
+// The first nGround points are ground.
+func groundTestTerrain() (vs []mat.Vec3, nGround int) {
+	inBuilding := func(x, y float32) bool {
+		return 4 <= x && x < 6 && 4 <= y && y < 6
+	}
+	terrain := func(x, y float32) float32 {
+		return 0.1*x + 0.05*float32(math.Sin(float64(y)))
+	}
+	for x := float32(0); x < 10; x += 0.25 {
+		for y := float32(0); y < 10; y += 0.25 {
+			if !inBuilding(x, y) {
+				vs = append(vs, mat.Vec3{x, y, terrain(x, y)})
+			}
+		}
+	}
+	nGround = len(vs)
+	// Roof of the building
+	for x := float32(4); x < 6; x += 0.25 {
+		for y := float32(4); y < 6; y += 0.25 {
+			vs = append(vs, mat.Vec3{x, y, 3})
+		}
+	}
+	// Trees
+	for _, p := range [][2]float32{{2, 2}, {8, 1}, {1, 8.5}} {
+		vs = append(vs, mat.Vec3{p[0], p[1], terrain(p[0], p[1]) + 1.5})
+	}
+	return vs, nGround
+}
+
+func TestGroundPoints(t *testing.T) {
+	vs, nGround := groundTestTerrain()
+	pp := createXYZCloud(t, vs...)
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := defaultGroundParam
+	p.window = 8
+	ground, err := groundPoints(it, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range ground {
+		if expected := i < nGround; g != expected {
+			t.Errorf("Point %v: expected ground=%v, got %v", vs[i], expected, g)
+		}
+	}
+
+	p.window = 2 // smaller than the building
+	ground, err = groundPoints(it, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ground[nGround] {
+		t.Error("Building larger than the window must be kept as ground")
+	}
+
+	t.Run("TooLargeGrid", func(t *testing.T) {
+		pp := createXYZCloud(t, mat.Vec3{0, 0, 0}, mat.Vec3{10000, 10000, 0})
+		it, err := pp.Vec3Iterator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := groundPoints(it, defaultGroundParam); err == nil {
+			t.Error("Expected error on the grid exceeding the limit")
+		}
+	})
+}
+
+func TestGroundParam(t *testing.T) {
+	c := newCommandContext(&dummyPCDIO{}, nil)
+	for _, p := range []groundParam{
+		{cell: 0, slope: 0.3, height: 0.2, window: 8},
+		{cell: 1, slope: 0.3, height: 0.2, window: 0.5},
+		{cell: 1, slope: -1, height: 0.2, window: 8},
+		{cell: 1, slope: 0.3, height: -1, window: 8},
+	} {
+		if err := c.SetGroundParam(p); err == nil {
+			t.Errorf("Expected error on %+v", p)
+		}
+	}
+	if c.GroundParam() != defaultGroundParam {
+		t.Error("Parameter must not be changed on error")
+	}
+}
+
+func TestLabelGround(t *testing.T) {
+	vs, nGround := groundTestTerrain()
+	c := newTestConsole(t, vs...)
+	if _, err := c.Run("ground_param 0.5 0.3 0.2 8", noUpdate); err != nil {
+		t.Fatal(err)
+	}
+
+	// Crop the trees out
+	mask := make([]uint32, len(vs))
+	for i := len(vs) - 3; i < len(vs); i++ {
+		mask[i] = selectBitmaskCropped
+	}
+	c.cmd.SetSelectMask(mask)
+	if _, err := c.Run("ground_select", noUpdate); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for i, m := range c.cmd.SelectMask() {
+		if m&selectBitmaskSegmentSelected != 0 {
+			if i >= nGround {
+				t.Errorf("Point %v must not be selected", vs[i])
+			}
+			n++
+		}
+	}
+	if n != nGround {
+		t.Errorf("Expected %d ground points, got %d", nGround, n)
+	}
+
+	if _, err := c.Run("ground_label 3", noUpdate); err != nil {
+		t.Fatal(err)
+	}
+	lt, err := c.cmd.editor.pp.Uint32Iterator("label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range vs {
+		expected := uint32(0)
+		if i < nGround {
+			expected = 3
+		}
+		if l := lt.Uint32At(i); l != expected {
+			t.Fatalf("Expected label %d at %v, got %d", expected, vs[i], l)
+		}
+	}
+
+	if !c.cmd.Undo() {
+		t.Fatal("Undo failed")
+	}
+	lt, err = c.cmd.editor.pp.Uint32Iterator("label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range vs {
+		if l := lt.Uint32At(i); l != 0 {
+			t.Fatalf("Label must be restored by undo, got %d at %v", l, vs[i])
+		}
+	}
+}
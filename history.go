@@ -0,0 +1,518 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+var errHistoryMismatch = errors.New("history does not match the current point cloud")
+
+// delta is a reversible edit of the main point cloud.
+// apply and revert never modify the given point cloud.
+type delta interface {
+	apply(pp *pc.PointCloud) (*pc.PointCloud, error)
+	revert(pp *pc.PointCloud) (*pc.PointCloud, error)
+	release()
+}
+
+// historyBuffer holds a payload of the history entry.
+// It is stored outside of the Go heap if the platform allows.
+type historyBuffer interface {
+	Bytes() []byte
+	Release()
+}
+
+// journalEntry describes an edit recorded to the history.
+type journalEntry struct {
+	name        string
+	params      []float32
+	box         []mat.Vec3 // corners of the selection box if selected by box
+	pointsDelta int
+}
+
+func (j journalEntry) String() string {
+	var b strings.Builder
+	b.WriteString(j.name)
+	fmt.Fprintf(&b, " points=%+d", j.pointsDelta)
+	if len(j.params) > 0 {
+		b.WriteString(" params=")
+		for i, p := range j.params {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			fmt.Fprintf(&b, "%g", p)
+		}
+	}
+	if len(j.box) > 0 {
+		min, max := j.box[0], j.box[0]
+		for _, p := range j.box[1:] {
+			min, max = vec3Min(min, p), vec3Max(max, p)
+		}
+		fmt.Fprintf(&b, " box=(%.3f,%.3f,%.3f)-(%.3f,%.3f,%.3f)",
+			min[0], min[1], min[2], max[0], max[1], max[2],
+		)
+	}
+	return b.String()
+}
+
+type historyEntry struct {
+	delta
+	journal journalEntry
+}
+
+type deltaHistory struct {
+	entries    []historyEntry
+	pos        int // number of the applied entries
+	maxHistory int
+}
+
+func newHistory(n int) history {
+	return &deltaHistory{maxHistory: n}
+}
+
+func (h *deltaHistory) MaxHistory() int {
+	return h.maxHistory
+}
+
+func (h *deltaHistory) SetMaxHistory(m int) {
+	if m < 0 {
+		m = 0
+	}
+	h.maxHistory = m
+	h.trim()
+}
+
+func (h *deltaHistory) push(d delta, j journalEntry) {
+	for _, e := range h.entries[h.pos:] {
+		e.release()
+	}
+	h.entries = append(h.entries[:h.pos], historyEntry{delta: d, journal: j})
+	h.pos++
+	h.trim()
+}
+
+func (h *deltaHistory) trim() {
+	for len(h.entries) > h.maxHistory && h.pos > 0 {
+		h.entries[0].release()
+		h.entries[0] = historyEntry{}
+		h.entries = h.entries[1:]
+		h.pos--
+	}
+	for len(h.entries) > h.maxHistory {
+		n := len(h.entries) - 1
+		h.entries[n].release()
+		h.entries = h.entries[:n]
+	}
+}
+
+func (h *deltaHistory) undo(pp *pc.PointCloud) (*pc.PointCloud, bool) {
+	if h.pos == 0 || pp == nil {
+		return nil, false
+	}
+	out, err := h.entries[h.pos-1].revert(pp)
+	if err != nil {
+		return nil, false
+	}
+	h.pos--
+	return out, true
+}
+
+func (h *deltaHistory) redo(pp *pc.PointCloud) (*pc.PointCloud, bool) {
+	if h.pos == len(h.entries) || pp == nil {
+		return nil, false
+	}
+	out, err := h.entries[h.pos].apply(pp)
+	if err != nil {
+		return nil, false
+	}
+	h.pos++
+	return out, true
+}
+
+func (h *deltaHistory) journal() ([]journalEntry, int) {
+	js := make([]journalEntry, len(h.entries))
+	for i, e := range h.entries {
+		js[i] = e.journal
+	}
+	return js, h.pos
+}
+
+func (h *deltaHistory) clear() {
+	for _, e := range h.entries {
+		e.release()
+	}
+	h.entries = nil
+	h.pos = 0
+}
+
+// deleteDelta removes runs of points.
+type deleteDelta struct {
+	runs    historyBuffer // pairs of start index and length, in indices before deletion
+	removed historyBuffer
+	n       int
+}
+
+func newDeleteDelta(pp *pc.PointCloud, del func(int) bool) *deleteDelta {
+	stride := pp.Stride()
+	var runs []uint32
+	var removed []byte
+	var n int
+	start := -1
+	for i := 0; i <= pp.Points; i++ {
+		d := i < pp.Points && del(i)
+		switch {
+		case d && start < 0:
+			start = i
+		case !d && start >= 0:
+			runs = append(runs, uint32(start), uint32(i-start))
+			removed = append(removed, pp.Data[start*stride:i*stride]...)
+			n += i - start
+			start = -1
+		}
+	}
+	return &deleteDelta{
+		runs:    newHistoryBuffer(uint32sToBytes(runs)),
+		removed: newHistoryBuffer(removed),
+		n:       n,
+	}
+}
+
+func (d *deleteDelta) apply(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	if pp.Points < d.n {
+		return nil, errHistoryMismatch
+	}
+	runs := bytesToUint32s(d.runs.Bytes())
+	stride := pp.Stride()
+	out := newPointCloudLike(pp, pp.Points-d.n)
+
+	var src, dst int
+	for k := 0; k < len(runs); k += 2 {
+		s, n := int(runs[k]), int(runs[k+1])
+		if s < src || s+n > pp.Points {
+			return nil, errHistoryMismatch
+		}
+		dst += copy(out.Data[dst:], pp.Data[src*stride:s*stride])
+		src = s + n
+	}
+	copy(out.Data[dst:], pp.Data[src*stride:pp.Points*stride])
+	return out, nil
+}
+
+func (d *deleteDelta) revert(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	runs := bytesToUint32s(d.runs.Bytes())
+	removed := d.removed.Bytes()
+	stride := pp.Stride()
+	if len(removed) != d.n*stride {
+		return nil, errHistoryMismatch
+	}
+	out := newPointCloudLike(pp, pp.Points+d.n)
+
+	var src, dst, r int
+	for k := 0; k < len(runs); k += 2 {
+		s, n := int(runs[k]), int(runs[k+1])
+		kept := s - dst
+		if kept < 0 || src+kept > pp.Points {
+			return nil, errHistoryMismatch
+		}
+		copy(out.Data[dst*stride:], pp.Data[src*stride:(src+kept)*stride])
+		src += kept
+		r += copy(out.Data[s*stride:], removed[r:r+n*stride])
+		dst = s + n
+	}
+	if pp.Points-src != out.Points-dst {
+		return nil, errHistoryMismatch
+	}
+	copy(out.Data[dst*stride:], pp.Data[src*stride:pp.Points*stride])
+	return out, nil
+}
+
+func (d *deleteDelta) release() {
+	d.runs.Release()
+	d.removed.Release()
+}
+
+// labelDelta changes labels of the points.
+type labelDelta struct {
+	indices, before, after historyBuffer
+}
+
+// newLabelDelta creates labelDelta from the label function.
+// fn returns new label and true if the label of the point should be changed.
+func newLabelDelta(pp *pc.PointCloud, fn func(i int, l uint32) (uint32, bool)) (*labelDelta, error) {
+	lt, err := pp.Uint32Iterator("label")
+	if err != nil {
+		return nil, err
+	}
+	var indices, before, after []uint32
+	for i := 0; lt.IsValid(); i++ {
+		l := lt.Uint32()
+		if lNew, ok := fn(i, l); ok && lNew != l {
+			indices = append(indices, uint32(i))
+			before = append(before, l)
+			after = append(after, lNew)
+		}
+		lt.Incr()
+	}
+	return &labelDelta{
+		indices: newHistoryBuffer(uint32sToBytes(indices)),
+		before:  newHistoryBuffer(uint32sToBytes(before)),
+		after:   newHistoryBuffer(uint32sToBytes(after)),
+	}, nil
+}
+
+func (d *labelDelta) apply(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	return setLabels(pp, bytesToUint32s(d.indices.Bytes()), bytesToUint32s(d.after.Bytes()))
+}
+
+func (d *labelDelta) revert(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	return setLabels(pp, bytesToUint32s(d.indices.Bytes()), bytesToUint32s(d.before.Bytes()))
+}
+
+func (d *labelDelta) release() {
+	d.indices.Release()
+	d.before.Release()
+	d.after.Release()
+}
+
+func setLabels(pp *pc.PointCloud, indices, labels []uint32) (*pc.PointCloud, error) {
+	off, ok := fieldOffset(&pp.PointCloudHeader, "label")
+	if !ok {
+		return nil, errors.New("no label field")
+	}
+	out := newPointCloudLike(pp, pp.Points)
+	copy(out.Data, pp.Data)
+	out.Width, out.Height = pp.Width, pp.Height
+
+	stride := pp.Stride()
+	for k, i := range indices {
+		if int(i) >= pp.Points {
+			return nil, errHistoryMismatch
+		}
+		binary.LittleEndian.PutUint32(out.Data[int(i)*stride+off:], labels[k])
+	}
+	return out, nil
+}
+
+// moveDelta changes positions of the points.
+type moveDelta struct {
+	indices, before, after historyBuffer
+}
+
+// newMoveDelta creates moveDelta from the move function.
+// fn returns new position and true if the point should be moved.
+func newMoveDelta(pp *pc.PointCloud, fn func(i int, p mat.Vec3) (mat.Vec3, bool)) (*moveDelta, error) {
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		return nil, err
+	}
+	var indices, before, after []uint32
+	for i := 0; it.IsValid(); i++ {
+		p := it.Vec3()
+		if pNew, ok := fn(i, p); ok && pNew != p {
+			indices = append(indices, uint32(i))
+			for k := 0; k < 3; k++ {
+				before = append(before, math.Float32bits(p[k]))
+				after = append(after, math.Float32bits(pNew[k]))
+			}
+		}
+		it.Incr()
+	}
+	return &moveDelta{
+		indices: newHistoryBuffer(uint32sToBytes(indices)),
+		before:  newHistoryBuffer(uint32sToBytes(before)),
+		after:   newHistoryBuffer(uint32sToBytes(after)),
+	}, nil
+}
+
+func (d *moveDelta) apply(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	return setPositions(pp, bytesToUint32s(d.indices.Bytes()), d.after.Bytes())
+}
+
+func (d *moveDelta) revert(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	return setPositions(pp, bytesToUint32s(d.indices.Bytes()), d.before.Bytes())
+}
+
+func (d *moveDelta) release() {
+	d.indices.Release()
+	d.before.Release()
+	d.after.Release()
+}
+
+// setPositions sets x, y, z stored as 12 bytes per point.
+func setPositions(pp *pc.PointCloud, indices []uint32, positions []byte) (*pc.PointCloud, error) {
+	off, ok := fieldOffset(&pp.PointCloudHeader, "x")
+	if !ok {
+		return nil, errNoVec3Fields
+	}
+	out := newPointCloudLike(pp, pp.Points)
+	copy(out.Data, pp.Data)
+	out.Width, out.Height = pp.Width, pp.Height
+
+	stride := pp.Stride()
+	for k, i := range indices {
+		if int(i) >= pp.Points {
+			return nil, errHistoryMismatch
+		}
+		copy(out.Data[int(i)*stride+off:int(i)*stride+off+12], positions[k*12:])
+	}
+	return out, nil
+}
+
+// appendDelta adds points at the end of the cloud.
+type appendDelta struct {
+	added historyBuffer
+	n     int
+}
+
+func newAppendDelta(pp *pc.PointCloud) *appendDelta {
+	return &appendDelta{
+		added: newHistoryBuffer(pp.Data[:pp.Points*pp.Stride()]),
+		n:     pp.Points,
+	}
+}
+
+func (d *appendDelta) apply(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	added := d.added.Bytes()
+	stride := pp.Stride()
+	if len(added) != d.n*stride {
+		return nil, errHistoryMismatch
+	}
+	out := newPointCloudLike(pp, pp.Points+d.n)
+	n := copy(out.Data, pp.Data[:pp.Points*stride])
+	copy(out.Data[n:], added)
+	return out, nil
+}
+
+func (d *appendDelta) revert(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	if pp.Points < d.n {
+		return nil, errHistoryMismatch
+	}
+	n := pp.Points - d.n
+	l := n * pp.Stride()
+	out := &pc.PointCloud{
+		PointCloudHeader: pp.PointCloudHeader.Clone(),
+		Points:           n,
+		Data:             pp.Data[:l:l],
+	}
+	out.Width, out.Height = n, 1
+	return out, nil
+}
+
+func (d *appendDelta) release() {
+	d.added.Release()
+}
+
+// replaceDelta swaps whole point cloud.
+type replaceDelta struct {
+	before, after storedPointCloud
+	// schema and georef point the fields of the editor to be switched with the cloud.
+	schema *pc.PointCloudHeader
+	georef **lasGeoref
+}
+
+type storedPointCloud struct {
+	header pc.PointCloudHeader
+	schema pc.PointCloudHeader
+	georef *lasGeoref
+	points int
+	data   historyBuffer
+}
+
+func newStoredPointCloud(pp *pc.PointCloud) storedPointCloud {
+	return storedPointCloud{
+		header: pp.PointCloudHeader.Clone(),
+		points: pp.Points,
+		data:   newHistoryBuffer(pp.Data[:pp.Points*pp.Stride()]),
+	}
+}
+
+func (s storedPointCloud) pointCloud() *pc.PointCloud {
+	return &pc.PointCloud{
+		PointCloudHeader: s.header.Clone(),
+		Points:           s.points,
+		Data:             s.data.Bytes(),
+	}
+}
+
+func newReplaceDelta(before, after *pc.PointCloud) *replaceDelta {
+	return &replaceDelta{
+		before: newStoredPointCloud(before),
+		after:  newStoredPointCloud(after),
+	}
+}
+
+func (d *replaceDelta) apply(*pc.PointCloud) (*pc.PointCloud, error) {
+	if d.schema != nil {
+		*d.schema = d.after.schema.Clone()
+	}
+	if d.georef != nil {
+		*d.georef = d.after.georef
+	}
+	return d.after.pointCloud(), nil
+}
+
+func (d *replaceDelta) revert(*pc.PointCloud) (*pc.PointCloud, error) {
+	if d.schema != nil {
+		*d.schema = d.before.schema.Clone()
+	}
+	if d.georef != nil {
+		*d.georef = d.before.georef
+	}
+	return d.before.pointCloud(), nil
+}
+
+func (d *replaceDelta) release() {
+	d.before.data.Release()
+	d.after.data.Release()
+}
+
+// deltaSequence is a set of deltas recorded as a single history entry.
+type deltaSequence []delta
+
+func (s deltaSequence) apply(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	for _, d := range s {
+		var err error
+		if pp, err = d.apply(pp); err != nil {
+			return nil, err
+		}
+	}
+	return pp, nil
+}
+
+func (s deltaSequence) revert(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	for i := len(s) - 1; i >= 0; i-- {
+		var err error
+		if pp, err = s[i].revert(pp); err != nil {
+			return nil, err
+		}
+	}
+	return pp, nil
+}
+
+func (s deltaSequence) release() {
+	for _, d := range s {
+		d.release()
+	}
+}
+
+func uint32sToBytes(v []uint32) []byte {
+	b := make([]byte, len(v)*4)
+	for i, a := range v {
+		binary.LittleEndian.PutUint32(b[i*4:], a)
+	}
+	return b
+}
+
+func bytesToUint32s(b []byte) []uint32 {
+	v := make([]uint32, len(b)/4)
+	for i := range v {
+		v[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return v
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+func TestHistory(t *testing.T) {
+	newEditorWithCloud := func(t *testing.T) *editor {
+		t.Helper()
+		e := newEditor()
+		if err := e.SetPointCloud(createPointCloud(t, false), cloudMain); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	expectLabels := func(t *testing.T, pp *pc.PointCloud, expected []uint32) {
+		t.Helper()
+		lt, err := pp.Uint32Iterator("label")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var labels []uint32
+		for ; lt.IsValid(); lt.Incr() {
+			labels = append(labels, lt.Uint32())
+		}
+		if len(labels) != len(expected) {
+			t.Fatalf("Expected labels: %v, got: %v", expected, labels)
+		}
+		for i := range labels {
+			if labels[i] != expected[i] {
+				t.Fatalf("Expected labels: %v, got: %v", expected, labels)
+			}
+		}
+	}
+
+	t.Run("Delete", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		if err := e.passThrough(journalEntry{name: "delete"}, func(i int, _ mat.Vec3) bool { return i == 1 }); err != nil {
+			t.Fatal(err)
+		}
+		check(t, e.pp, []int{1})
+
+		if !e.Undo() {
+			t.Fatal("Undo must succeed")
+		}
+		check(t, e.pp, []int{0, 1, 2})
+		if e.Undo() {
+			t.Fatal("Undo must fail on the initial cloud")
+		}
+
+		if !e.Redo() {
+			t.Fatal("Redo must succeed")
+		}
+		check(t, e.pp, []int{1})
+		if e.Redo() {
+			t.Fatal("Redo must fail on the latest cloud")
+		}
+	})
+	t.Run("DeleteByMask", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		if err := e.passThroughByMask(journalEntry{name: "delete"}, []uint32{0, 1, 0}, 1, 0); err != nil {
+			t.Fatal(err)
+		}
+		check(t, e.pp, []int{0, 2})
+		e.Undo()
+		check(t, e.pp, []int{0, 1, 2})
+		e.Redo()
+		check(t, e.pp, []int{0, 2})
+	})
+	t.Run("Label", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		if err := e.label(journalEntry{name: "label"}, func(i int, _ mat.Vec3) (uint32, bool) { return 5, i != 0 }); err != nil {
+			t.Fatal(err)
+		}
+		expectLabels(t, e.pp, []uint32{0, 5, 5})
+		if err := e.relabelPointsInLabelRange(journalEntry{name: "relabel"}, 5, 5, 7); err != nil {
+			t.Fatal(err)
+		}
+		expectLabels(t, e.pp, []uint32{0, 7, 7})
+
+		e.Undo()
+		expectLabels(t, e.pp, []uint32{0, 5, 5})
+		e.Undo()
+		expectLabels(t, e.pp, []uint32{0, 1, 2})
+		e.Redo()
+		expectLabels(t, e.pp, []uint32{0, 5, 5})
+	})
+	t.Run("Move", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		if err := e.move(journalEntry{name: "flatten"}, func(i int, p mat.Vec3) (mat.Vec3, bool) {
+			return mat.Vec3{p[0], p[1], 0}, i != 1
+		}); err != nil {
+			t.Fatal(err)
+		}
+		moved := []mat.Vec3{{1, 2, 0}, {4, 5, 6}, {7, 8, 0}}
+		expectPointCloud(t, e.pp, moved)
+		expectLabels(t, e.pp, []uint32{0, 1, 2})
+
+		e.Undo()
+		expectPointCloud(t, e.pp, vecs)
+		e.Redo()
+		expectPointCloud(t, e.pp, moved)
+	})
+	t.Run("MergeAndReplace", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		if err := e.merge(journalEntry{name: "merge"}, createPointCloud(t, false)); err != nil {
+			t.Fatal(err)
+		}
+		check(t, e.pp, []int{0, 1, 2, 0, 1, 2})
+
+		pp, err := passThrough(e.pp, func(i int, _ mat.Vec3) bool { return i == 2 })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.SetPointCloud(pp, cloudMain); err != nil {
+			t.Fatal(err)
+		}
+		check(t, e.pp, []int{2})
+
+		e.Undo()
+		check(t, e.pp, []int{0, 1, 2, 0, 1, 2})
+		e.Undo()
+		check(t, e.pp, []int{0, 1, 2})
+		e.Redo()
+		e.Redo()
+		check(t, e.pp, []int{2})
+	})
+	t.Run("PassThroughAndMerge", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		pp, err := passThrough(e.pp, func(i int, _ mat.Vec3) bool { return i == 0 })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := e.passThroughAndMerge(journalEntry{name: "voxel_filter"}, func(i int, _ mat.Vec3) bool { return i != 0 }, pp); err != nil {
+			t.Fatal(err)
+		}
+		check(t, e.pp, []int{1, 2, 0})
+		e.Undo()
+		check(t, e.pp, []int{0, 1, 2})
+	})
+	t.Run("PushDiscardsRedo", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		e.passThrough(journalEntry{name: "delete"}, func(i int, _ mat.Vec3) bool { return i != 0 })
+		e.Undo()
+		e.passThrough(journalEntry{name: "delete"}, func(i int, _ mat.Vec3) bool { return i != 2 })
+		if e.Redo() {
+			t.Fatal("Redo must fail after new edit")
+		}
+		check(t, e.pp, []int{0, 1})
+	})
+	t.Run("MaxHistory", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		e.SetMaxHistory(2)
+		for i := 0; i < 3; i++ {
+			e.label(journalEntry{name: "label"}, func(int, mat.Vec3) (uint32, bool) { return uint32(i + 10), true })
+		}
+		if !e.Undo() || !e.Undo() {
+			t.Fatal("Undo must succeed twice")
+		}
+		if e.Undo() {
+			t.Fatal("Undo must fail after MaxHistory steps")
+		}
+		expectLabels(t, e.pp, []uint32{10, 10, 10})
+
+		e.SetMaxHistory(1)
+		if !e.Redo() {
+			t.Fatal("Redo must succeed")
+		}
+		if e.Redo() {
+			t.Fatal("Redo entries exceeding MaxHistory must be dropped")
+		}
+		expectLabels(t, e.pp, []uint32{11, 11, 11})
+	})
+	t.Run("Journal", func(t *testing.T) {
+		e := newEditorWithCloud(t)
+		box := []mat.Vec3{{0, 0, 0}, {1, 2, 3}}
+		e.passThrough(journalEntry{name: "delete", box: box}, func(i int, _ mat.Vec3) bool { return i != 0 })
+		e.merge(journalEntry{name: "add_surface", params: []float32{0.1}}, createPointCloud(t, false))
+		e.label(journalEntry{name: "label", params: []float32{3}}, func(int, mat.Vec3) (uint32, bool) { return 3, true })
+
+		js, pos := e.journal()
+		if pos != 3 {
+			t.Fatalf("Expected position: 3, got: %d", pos)
+		}
+		expected := []string{
+			"delete points=-1 box=(0.000,0.000,0.000)-(1.000,2.000,3.000)",
+			"add_surface points=+3 params=0.1",
+			"label points=+0 params=3",
+		}
+		if len(js) != len(expected) {
+			t.Fatalf("Expected %d entries, got: %d", len(expected), len(js))
+		}
+		for i := range js {
+			if s := js[i].String(); s != expected[i] {
+				t.Errorf("Expected journal[%d]: %s, got: %s", i, expected[i], s)
+			}
+		}
+
+		if e.UndoTo(4) {
+			t.Error("UndoTo must fail for the entry not applied")
+		}
+		if !e.UndoTo(1) {
+			t.Fatal("UndoTo must succeed")
+		}
+		check(t, e.pp, []int{1, 2})
+		if _, pos := e.journal(); pos != 1 {
+			t.Errorf("Expected position: 1, got: %d", pos)
+		}
+		if !e.UndoTo(0) {
+			t.Fatal("UndoTo must succeed")
+		}
+		check(t, e.pp, []int{0, 1, 2})
+	})
+}
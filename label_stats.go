@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+type statsScope int
+
+const (
+	statsScopeAll statsScope = iota
+	statsScopeSelected
+	statsScopeCrop
+)
+
+var statsScopeNames = []string{"all", "selected", "crop"}
+
+var errNoSelection = errors.New("no points are selected")
+
+// labelStat is the statistics of the points having the label.
+type labelStat struct {
+	label    uint32
+	count    int
+	min, max mat.Vec3
+	sum      [3]float64
+}
+
+func (s *labelStat) centroid() mat.Vec3 {
+	if s.count == 0 {
+		return mat.Vec3{}
+	}
+	n := float64(s.count)
+	return mat.Vec3{float32(s.sum[0] / n), float32(s.sum[1] / n), float32(s.sum[2] / n)}
+}
+
+// row returns the statistics as [label count minX minY minZ maxX maxY maxZ cX cY cZ].
+func (s *labelStat) row() []float32 {
+	c := s.centroid()
+	return []float32{
+		float32(s.label), float32(s.count),
+		s.min[0], s.min[1], s.min[2],
+		s.max[0], s.max[1], s.max[2],
+		c[0], c[1], c[2],
+	}
+}
+
+// labelStats calculates the statistics of each label over the points passing fn.
+// The result is sorted by the label.
+func labelStats(pp *pc.PointCloud, fn func(int, mat.Vec3) bool) ([]labelStat, error) {
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		return nil, err
+	}
+	lt, err := pp.Uint32Iterator("label")
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[uint32]*labelStat)
+	for i := 0; lt.IsValid(); i++ {
+		p := it.Vec3()
+		l := lt.Uint32()
+		it.Incr()
+		lt.Incr()
+		if !fn(i, p) {
+			continue
+		}
+		s, ok := stats[l]
+		if !ok {
+			s = &labelStat{label: l, min: p, max: p}
+			stats[l] = s
+		}
+		s.count++
+		s.min = vec3Min(s.min, p)
+		s.max = vec3Max(s.max, p)
+		for k := range s.sum {
+			s.sum[k] += float64(p[k])
+		}
+	}
+	out := make([]labelStat, 0, len(stats))
+	for _, s := range stats {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].label < out[j].label
+	})
+	return out, nil
+}
+
+// LabelStats returns the statistics of each label in the scope.
+// If labels are given, the statistics of the labels are returned in the given order
+// and the labels having no points are returned with zero count.
+func (c *commandContext) LabelStats(scope statsScope, labels []uint32) ([]labelStat, error) {
+	if c.editor.pp == nil {
+		return nil, errors.New("no pointcloud")
+	}
+	var fn func(int, mat.Vec3) bool
+	switch scope {
+	case statsScopeAll:
+		fn = func(int, mat.Vec3) bool { return true }
+	case statsScopeSelected:
+		switch c.SelectMode() {
+		case selectModeRect:
+			fn = c.baseFilter(true)
+		case selectModeMask:
+			fn = c.baseFilterByMask(true)
+		default:
+			return nil, errNoSelection
+		}
+		if len(c.selectMask) != c.editor.pp.Points {
+			return nil, errNoSelection
+		}
+	case statsScopeCrop:
+		m := c.editor.cropMatrix
+		fn = func(_ int, p mat.Vec3) bool {
+			cp := m.TransformAffine(p)
+			return 0 <= cp[0] && cp[0] <= 1 && 0 <= cp[1] && cp[1] <= 1 && 0 <= cp[2] && cp[2] <= 1
+		}
+	}
+	stats, err := labelStats(c.editor.pp, fn)
+	if err != nil || len(labels) == 0 {
+		return stats, err
+	}
+	out := make([]labelStat, len(labels))
+	for i, l := range labels {
+		out[i].label = l
+		for _, s := range stats {
+			if s.label == l {
+				out[i] = s
+				break
+			}
+		}
+	}
+	return out, nil
+}
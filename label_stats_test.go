@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestConsole_LabelStats(t *testing.T) {
+	c := &console{
+		cmd: newCommandContext(nil, nil),
+	}
+	if _, err := c.Run("label_stats", nil); err == nil {
+		t.Error("Expected error without point cloud")
+	}
+	if err := c.cmd.editor.SetPointCloud(createPointCloud(t, false), cloudMain); err != nil {
+		t.Fatal(err)
+	}
+	c.cmd.SetSelectMask([]uint32{0, selectBitmaskSelected, selectBitmaskSelected})
+	c.cmd.editor.label(journalEntry{}, func(i int, _ mat.Vec3) (uint32, bool) {
+		return 1, i > 0
+	})
+
+	testCases := map[string]struct {
+		cmd      string
+		expected [][]float32
+	}{
+		"All": {
+			cmd: "label_stats",
+			expected: [][]float32{
+				{0, 1, 1, 2, 3, 1, 2, 3, 1, 2, 3},
+				{1, 2, 4, 5, 6, 7, 8, 9, 5.5, 6.5, 7.5},
+			},
+		},
+		"Selected": {
+			cmd: "label_stats selected 1 7",
+			expected: [][]float32{
+				{1, 2, 4, 5, 6, 7, 8, 9, 5.5, 6.5, 7.5},
+				{7, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			},
+		},
+		"Crop": {
+			cmd: "label_stats scope=crop",
+			expected: [][]float32{
+				{0, 1, 1, 2, 3, 1, 2, 3, 1, 2, 3},
+			},
+		},
+	}
+	c.cmd.editor.Crop(mat.Scale(0.2, 0.2, 0.2))
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			res, err := c.Run(tt.cmd, noUpdate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.expected, res) {
+				t.Errorf("Expected %v, got: %v", tt.expected, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// labelPaletteSize is the number of the colors in the palette texture.
+// Labels out of the palette are colored by the label modulo labelPaletteSize.
+const labelPaletteSize = 256
+
+var defaultLabelColors = [][3]uint8{
+	{128, 128, 128},
+	{60, 180, 75},
+	{230, 25, 75},
+	{255, 225, 25},
+	{67, 99, 216},
+	{245, 130, 49},
+	{145, 30, 180},
+	{70, 240, 240},
+	{240, 50, 230},
+	{188, 246, 12},
+	{250, 190, 190},
+	{0, 128, 128},
+	{230, 190, 255},
+	{154, 99, 36},
+	{255, 250, 200},
+	{128, 0, 0},
+	{170, 255, 195},
+	{128, 128, 0},
+	{255, 216, 177},
+	{0, 0, 117},
+}
+
+var errLabelTableEmpty = errors.New("no labels defined")
+
+// labelDef is a label defined in the label table.
+type labelDef struct {
+	ID    uint32 `yaml:"id" json:"id"`
+	Name  string `yaml:"name" json:"name"`
+	Color string `yaml:"color" json:"color"` // #rrggbb, or empty to use the default palette
+	Key   string `yaml:"key" json:"key"`     // KeyboardEvent.code (or a digit/letter) to label the selected points
+}
+
+// labelTable maps the label IDs to the names, colors and hotkeys.
+//
+//	labels:
+//	  - id: 1
+//	    name: road
+//	    color: "#3cb44b"
+//	    key: Digit1
+type labelTable struct {
+	Labels []labelDef `yaml:"labels" json:"labels"`
+}
+
+// defaultLabelTable returns the table of the default palette
+// with the hotkeys to label 0 and 1.
+func defaultLabelTable() *labelTable {
+	return &labelTable{
+		Labels: []labelDef{
+			{ID: 0, Key: "Digit0"},
+			{ID: 1, Key: "Digit1"},
+		},
+	}
+}
+
+// parseLabelTable parses the label table written in YAML or JSON.
+func parseLabelTable(b []byte) (*labelTable, error) {
+	t := &labelTable{}
+	if s := bytes.TrimSpace(b); len(s) > 0 && s[0] == '{' {
+		if err := json.Unmarshal(s, t); err != nil {
+			return nil, err
+		}
+	} else if err := yaml.Unmarshal(b, t); err != nil {
+		return nil, err
+	}
+	if len(t.Labels) == 0 {
+		return nil, errLabelTableEmpty
+	}
+	ids := make(map[uint32]bool)
+	keys := make(map[string]uint32)
+	for i := range t.Labels {
+		l := &t.Labels[i]
+		l.Key = normalizeKeyCode(l.Key)
+		if ids[l.ID] {
+			return nil, fmt.Errorf("duplicated label ID %d", l.ID)
+		}
+		ids[l.ID] = true
+		if l.ID >= labelPaletteSize && l.Color != "" {
+			return nil, fmt.Errorf("color of label %d is out of the palette (must be <%d)", l.ID, labelPaletteSize)
+		}
+		if l.Color != "" {
+			if _, err := parseColorCode(l.Color); err != nil {
+				return nil, fmt.Errorf("label %d: %w", l.ID, err)
+			}
+		}
+		if l.Key != "" {
+			if id, ok := keys[l.Key]; ok {
+				return nil, fmt.Errorf("key %s is assigned to both label %d and %d", l.Key, id, l.ID)
+			}
+			keys[l.Key] = l.ID
+		}
+	}
+	sort.Slice(t.Labels, func(i, j int) bool {
+		return t.Labels[i].ID < t.Labels[j].ID
+	})
+	return t, nil
+}
+
+// normalizeKeyCode converts a digit or a letter to KeyboardEvent.code.
+func normalizeKeyCode(k string) string {
+	if len(k) != 1 {
+		return k
+	}
+	switch c := k[0]; {
+	case '0' <= c && c <= '9':
+		return "Digit" + k
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		return "Key" + strings.ToUpper(k)
+	}
+	return k
+}
+
+func parseColorCode(s string) ([3]uint8, error) {
+	if len(s) != 7 || s[0] != '#' {
+		return [3]uint8{}, fmt.Errorf("invalid color %q (must be #rrggbb)", s)
+	}
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return [3]uint8{}, fmt.Errorf("invalid color %q (must be #rrggbb)", s)
+	}
+	return [3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// color returns the color of the label.
+func (t *labelTable) color(id uint32) [3]uint8 {
+	id %= labelPaletteSize
+	for _, l := range t.Labels {
+		if l.ID == id && l.Color != "" {
+			c, _ := parseColorCode(l.Color)
+			return c
+		}
+	}
+	return defaultLabelColors[id%uint32(len(defaultLabelColors))]
+}
+
+// palette returns RGBA colors of the labels from 0 to labelPaletteSize-1.
+func (t *labelTable) palette() []byte {
+	out := make([]byte, 4*labelPaletteSize)
+	for i := 0; i < labelPaletteSize; i++ {
+		c := t.color(uint32(i))
+		copy(out[4*i:], c[:])
+		out[4*i+3] = 255
+	}
+	return out
+}
+
+// byKey returns the label assigned to the KeyboardEvent.code.
+func (t *labelTable) byKey(code string) (uint32, bool) {
+	for _, l := range t.Labels {
+		if l.Key != "" && l.Key == code {
+			return l.ID, true
+		}
+	}
+	return 0, false
+}
+
+// lines returns the labels formatted as "ID NAME #rrggbb [KEY]".
+func (t *labelTable) lines() []string {
+	out := make([]string, len(t.Labels))
+	for i, l := range t.Labels {
+		c := t.color(l.ID)
+		s := fmt.Sprintf("%d %s #%02x%02x%02x", l.ID, quoteIfNeeded(l.Name), c[0], c[1], c[2])
+		if l.Key != "" {
+			s += " " + l.Key
+		}
+		out[i] = s
+	}
+	return out
+}
+
+func quoteIfNeeded(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"'#") {
+		return strconv.Quote(s)
+	}
+	return s
+}
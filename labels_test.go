@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabelTable(t *testing.T) {
+	expected := &labelTable{
+		Labels: []labelDef{
+			{ID: 0, Name: "unlabeled"},
+			{ID: 1, Name: "road", Color: "#3cb44b", Key: "Digit1"},
+			{ID: 12, Name: "traffic sign", Color: "#FF0000", Key: "KeyR"},
+		},
+	}
+	testCases := map[string]string{
+		"YAML": `
+labels:
+  - id: 12
+    name: traffic sign
+    color: "#FF0000"
+    key: r
+  - id: 0
+    name: unlabeled
+  - id: 1
+    name: road
+    color: "#3cb44b"
+    key: 1
+`,
+		"JSON": `{"labels": [
+	{"id": 12, "name": "traffic sign", "color": "#FF0000", "key": "KeyR"},
+	{"id": 0, "name": "unlabeled"},
+	{"id": 1, "name": "road", "color": "#3cb44b", "key": "Digit1"}
+]}`,
+	}
+	for name, src := range testCases {
+		src := src
+		t.Run(name, func(t *testing.T) {
+			lt, err := parseLabelTable([]byte(src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(expected, lt) {
+				t.Errorf("Expected:\n%+v\nGot:\n%+v", expected, lt)
+			}
+		})
+	}
+
+	errCases := map[string]string{
+		"Empty":         "labels: []",
+		"DuplicatedID":  "labels: [{id: 1}, {id: 1}]",
+		"DuplicatedKey": "labels: [{id: 1, key: Digit1}, {id: 2, key: 1}]",
+		"InvalidColor":  "labels: [{id: 1, color: red}]",
+		"OutOfPalette":  "labels: [{id: 256, color: '#000000'}]",
+	}
+	for name, src := range errCases {
+		src := src
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseLabelTable([]byte(src)); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+func TestLabelTable(t *testing.T) {
+	lt, err := parseLabelTable([]byte("labels: [{id: 1, name: road, color: '#010203', key: Digit1}, {id: 300, name: pole}]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Palette", func(t *testing.T) {
+		p := lt.palette()
+		if len(p) != 4*labelPaletteSize {
+			t.Fatalf("Expected palette size %d, got: %d", 4*labelPaletteSize, len(p))
+		}
+		if c := p[4:8]; !reflect.DeepEqual([]byte{1, 2, 3, 255}, c) {
+			t.Errorf("Expected defined color, got: %v", c)
+		}
+		if c := p[4*22 : 4*22+4]; !reflect.DeepEqual([]byte{230, 25, 75, 255}, c) {
+			t.Errorf("Expected default color of label 2, got: %v", c)
+		}
+	})
+	t.Run("ByKey", func(t *testing.T) {
+		if l, ok := lt.byKey("Digit1"); !ok || l != 1 {
+			t.Errorf("Expected label 1, got: %d (%v)", l, ok)
+		}
+		if _, ok := lt.byKey("Digit0"); ok {
+			t.Error("Digit0 must not be assigned")
+		}
+	})
+	t.Run("Lines", func(t *testing.T) {
+		expected := []string{
+			"1 road #010203 Digit1",
+			"300 pole #4363d8",
+		}
+		if lines := lt.lines(); !reflect.DeepEqual(expected, lines) {
+			t.Errorf("Expected %v, got: %v", expected, lines)
+		}
+	})
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+var (
+	errLASHeader        = errors.New("invalid LAS header")
+	errLASCompressed    = errors.New("compressed LAS (LAZ) is not supported, decompress it by laszip before loading")
+	errLASPointFormat   = errors.New("unsupported LAS point data format")
+	errLASLabelTooLarge = errors.New("label must be <=255 to be stored in LAS classification")
+	errLASOutOfRange    = errors.New("coordinates exceed the range of the LAS scale and offset")
+)
+
+const (
+	lasHeaderSize12 = 227
+	lasHeaderSize14 = 375
+)
+
+// lasPointFormat is the layout of the LAS point data record format.
+// Offsets of the optional fields are -1 if not available.
+type lasPointFormat struct {
+	size           int // minimum size of the record
+	classification int
+	classMask      byte
+	gpsTime        int
+	rgb            int
+}
+
+var lasPointFormats = []lasPointFormat{
+	0:  {size: 20, classification: 15, classMask: 0x1F, gpsTime: -1, rgb: -1},
+	1:  {size: 28, classification: 15, classMask: 0x1F, gpsTime: 20, rgb: -1},
+	2:  {size: 26, classification: 15, classMask: 0x1F, gpsTime: -1, rgb: 20},
+	3:  {size: 34, classification: 15, classMask: 0x1F, gpsTime: 20, rgb: 28},
+	4:  {size: 57, classification: 15, classMask: 0x1F, gpsTime: 20, rgb: -1},
+	5:  {size: 63, classification: 15, classMask: 0x1F, gpsTime: 20, rgb: 28},
+	6:  {size: 30, classification: 16, classMask: 0xFF, gpsTime: 22, rgb: -1},
+	7:  {size: 36, classification: 16, classMask: 0xFF, gpsTime: 22, rgb: 30},
+	8:  {size: 38, classification: 16, classMask: 0xFF, gpsTime: 22, rgb: 30},
+	9:  {size: 59, classification: 16, classMask: 0xFF, gpsTime: 22, rgb: -1},
+	10: {size: 67, classification: 16, classMask: 0xFF, gpsTime: 22, rgb: 30},
+}
+
+var lasMagic = []byte("LASF")
+
+// lasGeoref is the scale and the offset of the LAS coordinates.
+// 4 bytes float doesn't have enough precision for georeferenced coordinates
+// like UTM, so the points are kept relative to the offset.
+type lasGeoref struct {
+	scale, offset [3]float64
+}
+
+// origin returns the offset, or zero if g is nil.
+func (g *lasGeoref) origin() [3]float64 {
+	if g == nil {
+		return [3]float64{}
+	}
+	return g.offset
+}
+
+// translatePointCloud translates the points of pp by d in place.
+func translatePointCloud(pp *pc.PointCloud, d [3]float64) error {
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		return err
+	}
+	for ; it.IsValid(); it.Incr() {
+		v := it.Vec3()
+		for k := range v {
+			v[k] = float32(float64(v[k]) + d[k])
+		}
+		it.SetVec3(v)
+	}
+	return nil
+}
+
+func isLAS(head []byte) bool {
+	return bytes.HasPrefix(head, lasMagic)
+}
+
+// unmarshalLAS reads LAS 1.0-1.4 file.
+// Classification is stored as label, and intensity, GPS time and RGB are
+// stored as intensity, gps_time, red, green and blue fields.
+// Coordinates are stored as 4 bytes float as same as PCD.
+// If georef is not nil, it is filled with the scale and the offset of the file
+// and the coordinates are loaded relative to the offset.
+// It fails if the points exceed maxBytes.
+func unmarshalLAS(r io.Reader, maxBytes int, georef *lasGeoref) (*pc.PointCloud, error) {
+	h := make([]byte, lasHeaderSize12)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return nil, err
+	}
+	if !isLAS(h) || h[24] != 1 {
+		return nil, errLASHeader
+	}
+	headerSize := int(binary.LittleEndian.Uint16(h[94:]))
+	dataOffset := int(binary.LittleEndian.Uint32(h[96:]))
+	if headerSize < lasHeaderSize12 || dataOffset < headerSize {
+		return nil, errLASHeader
+	}
+	if headerSize > lasHeaderSize12 {
+		h = append(h, make([]byte, headerSize-lasHeaderSize12)...)
+		if _, err := io.ReadFull(r, h[lasHeaderSize12:]); err != nil {
+			return nil, err
+		}
+	}
+	formatID := h[104]
+	if formatID&0xC0 != 0 {
+		return nil, errLASCompressed
+	}
+	if int(formatID) >= len(lasPointFormats) {
+		return nil, fmt.Errorf("%w: %d", errLASPointFormat, formatID)
+	}
+	format := lasPointFormats[formatID]
+	recordSize := int(binary.LittleEndian.Uint16(h[105:]))
+	if recordSize < format.size {
+		return nil, errLASHeader
+	}
+	n := int(binary.LittleEndian.Uint32(h[107:]))
+	if h[25] >= 4 && headerSize >= lasHeaderSize14 {
+		if n64 := binary.LittleEndian.Uint64(h[247:]); n64 != 0 {
+			n = int(n64)
+		}
+	}
+	var scale, offset [3]float64
+	for i := range scale {
+		scale[i] = math.Float64frombits(binary.LittleEndian.Uint64(h[131+8*i:]))
+		offset[i] = math.Float64frombits(binary.LittleEndian.Uint64(h[155+8*i:]))
+	}
+	origin := offset
+	if georef != nil {
+		*georef = lasGeoref{scale: scale, offset: offset}
+		origin = [3]float64{}
+	}
+
+	// Skip variable length records
+	if _, err := io.CopyN(io.Discard, r, int64(dataOffset-headerSize)); err != nil {
+		return nil, err
+	}
+
+	pp := &pc.PointCloud{
+		PointCloudHeader: pc.PointCloudHeader{
+			Version:   0.7,
+			Fields:    []string{"x", "y", "z", "intensity", "label"},
+			Size:      []int{4, 4, 4, 2, 4},
+			Type:      []string{"F", "F", "F", "U", "U"},
+			Count:     []int{1, 1, 1, 1, 1},
+			Width:     n,
+			Height:    1,
+			Viewpoint: []float32{0, 0, 0, 1, 0, 0, 0},
+		},
+		Points: n,
+	}
+	if format.gpsTime >= 0 {
+		pp.Fields = append(pp.Fields, "gps_time")
+		pp.Size = append(pp.Size, 8)
+		pp.Type = append(pp.Type, "F")
+		pp.Count = append(pp.Count, 1)
+	}
+	if format.rgb >= 0 {
+		pp.Fields = append(pp.Fields, "red", "green", "blue")
+		pp.Size = append(pp.Size, 2, 2, 2)
+		pp.Type = append(pp.Type, "U", "U", "U")
+		pp.Count = append(pp.Count, 1, 1, 1)
+	}
+	stride := pp.Stride()
+	if err := checkPointCloudBytes(n, stride, maxBytes); err != nil {
+		return nil, err
+	}
+	pp.Data = make([]byte, n*stride)
+
+	rec := make([]byte, recordSize)
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(r, rec); err != nil {
+			return nil, err
+		}
+		p := pp.Data[i*stride : (i+1)*stride]
+		for k := 0; k < 3; k++ {
+			v := float64(int32(binary.LittleEndian.Uint32(rec[4*k:])))*scale[k] + origin[k]
+			binary.LittleEndian.PutUint32(p[4*k:], math.Float32bits(float32(v)))
+		}
+		copy(p[12:14], rec[12:14])
+		binary.LittleEndian.PutUint32(p[14:], uint32(rec[format.classification]&format.classMask))
+		off := 18
+		if format.gpsTime >= 0 {
+			copy(p[off:off+8], rec[format.gpsTime:])
+			off += 8
+		}
+		if format.rgb >= 0 {
+			copy(p[off:off+6], rec[format.rgb:])
+		}
+	}
+	return pp, nil
+}
+
+// marshalLAS writes the cloud as LAS 1.2 file,
+// or LAS 1.4 if the cloud has labels larger than 31.
+// Point data record format is selected by the availability of gps_time and red/green/blue fields.
+// If georef is not nil, the points are relative to its offset and written with its scale and offset.
+func marshalLAS(pp *pc.PointCloud, w io.Writer, georef *lasGeoref) error {
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		return err
+	}
+	type field struct {
+		off     int
+		typ     string
+		size    int
+		present bool
+	}
+	lookup := func(name string) field {
+		i := fieldIndex(&pp.PointCloudHeader, name, 0)
+		if i < 0 || !isNumericType(pp.Type[i], pp.Size[i]) {
+			return field{}
+		}
+		off, _ := fieldOffsetAt(&pp.PointCloudHeader, i)
+		return field{off: off, typ: pp.Type[i], size: pp.Size[i], present: true}
+	}
+	label := lookup("label")
+	if !label.present {
+		return errors.New("label field is required")
+	}
+	intensity := lookup("intensity")
+	gpsTime := lookup("gps_time")
+	rgb := [3]field{lookup("red"), lookup("green"), lookup("blue")}
+	hasRGB := rgb[0].present && rgb[1].present && rgb[2].present
+
+	stride := pp.Stride()
+	var maxLabel float64
+	for i := 0; i < pp.Points; i++ {
+		maxLabel = math.Max(maxLabel, readNumber(pp.Data[i*stride+label.off:], label.typ, label.size))
+	}
+	if maxLabel > 255 {
+		return errLASLabelTooLarge
+	}
+	v14 := maxLabel > 31
+
+	var formatID byte
+	switch {
+	case v14 && hasRGB:
+		formatID = 7
+	case v14:
+		formatID = 6
+	case gpsTime.present && hasRGB:
+		formatID = 3
+	case hasRGB:
+		formatID = 2
+	case gpsTime.present:
+		formatID = 1
+	}
+	format := lasPointFormats[formatID]
+
+	minPt, maxPt, err := pc.MinMaxVec3(it)
+	if err != nil && pp.Points > 0 {
+		return err
+	}
+	scale := [3]float64{0.001, 0.001, 0.001}
+	var offset, origin [3]float64
+	if georef != nil {
+		scale, offset, origin = georef.scale, georef.offset, georef.offset
+	} else {
+		for k := range offset {
+			offset[k] = math.Floor(float64(minPt[k]))
+		}
+	}
+	quantize := func(v float32, k int) float64 {
+		return math.Round((float64(v) + origin[k] - offset[k]) / scale[k])
+	}
+	for k := 0; k < 3 && pp.Points > 0; k++ {
+		for _, v := range []float32{minPt[k], maxPt[k]} {
+			if q := quantize(v, k); q < math.MinInt32 || q > math.MaxInt32 {
+				return errLASOutOfRange
+			}
+		}
+	}
+
+	headerSize := lasHeaderSize12
+	if v14 {
+		headerSize = lasHeaderSize14
+	}
+	h := make([]byte, headerSize)
+	copy(h, lasMagic)
+	h[24] = 1
+	h[25] = 2
+	if v14 {
+		h[25] = 4
+		h[6] = 0x10 // WKT bit is required by the point formats 6-10
+	}
+	copy(h[26:58], "pcdeditor")
+	copy(h[58:90], "pcdeditor")
+	binary.LittleEndian.PutUint16(h[94:], uint16(headerSize))
+	binary.LittleEndian.PutUint32(h[96:], uint32(headerSize))
+	h[104] = formatID
+	binary.LittleEndian.PutUint16(h[105:], uint16(format.size))
+	if v14 {
+		binary.LittleEndian.PutUint64(h[247:], uint64(pp.Points))
+		binary.LittleEndian.PutUint64(h[255:], uint64(pp.Points))
+	} else {
+		binary.LittleEndian.PutUint32(h[107:], uint32(pp.Points))
+		binary.LittleEndian.PutUint32(h[111:], uint32(pp.Points))
+	}
+	for k := 0; k < 3; k++ {
+		binary.LittleEndian.PutUint64(h[131+8*k:], math.Float64bits(scale[k]))
+		binary.LittleEndian.PutUint64(h[155+8*k:], math.Float64bits(offset[k]))
+		binary.LittleEndian.PutUint64(h[179+16*k:], math.Float64bits(float64(maxPt[k])+origin[k]))
+		binary.LittleEndian.PutUint64(h[187+16*k:], math.Float64bits(float64(minPt[k])+origin[k]))
+	}
+	if _, err := w.Write(h); err != nil {
+		return err
+	}
+
+	rec := make([]byte, format.size)
+	for i := 0; i < pp.Points; i++ {
+		for k := range rec {
+			rec[k] = 0
+		}
+		p := pp.Data[i*stride : (i+1)*stride]
+		v := it.Vec3At(i)
+		for k := 0; k < 3; k++ {
+			binary.LittleEndian.PutUint32(rec[4*k:], uint32(int32(quantize(v[k], k))))
+		}
+		if intensity.present {
+			binary.LittleEndian.PutUint16(rec[12:], uint16(readNumber(p[intensity.off:], intensity.typ, intensity.size)))
+		}
+		// Single return
+		if v14 {
+			rec[14] = 0x11
+		} else {
+			rec[14] = 0x09
+		}
+		rec[format.classification] = byte(readNumber(p[label.off:], label.typ, label.size))
+		if format.gpsTime >= 0 && gpsTime.present {
+			binary.LittleEndian.PutUint64(rec[format.gpsTime:], math.Float64bits(readNumber(p[gpsTime.off:], gpsTime.typ, gpsTime.size)))
+		}
+		if format.rgb >= 0 {
+			for k, f := range rgb {
+				binary.LittleEndian.PutUint16(rec[format.rgb+2*k:], uint16(readNumber(p[f.off:], f.typ, f.size)))
+			}
+		}
+		if _, err := w.Write(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seqsense/pcdeditor/pcd"
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+func createLASTestCloud(t *testing.T, labels []uint32) *pc.PointCloud {
+	t.Helper()
+	pp := &pc.PointCloud{
+		PointCloudHeader: pc.PointCloudHeader{
+			Version:   0.7,
+			Fields:    []string{"x", "y", "z", "intensity", "label", "gps_time", "red", "green", "blue"},
+			Size:      []int{4, 4, 4, 2, 4, 8, 2, 2, 2},
+			Type:      []string{"F", "F", "F", "U", "U", "F", "U", "U", "U"},
+			Count:     []int{1, 1, 1, 1, 1, 1, 1, 1, 1},
+			Width:     len(labels),
+			Height:    1,
+			Viewpoint: []float32{0, 0, 0, 1, 0, 0, 0},
+		},
+		Points: len(labels),
+	}
+	stride := pp.Stride()
+	pp.Data = make([]byte, len(labels)*stride)
+	for i, l := range labels {
+		p := pp.Data[i*stride:]
+		v := mat.Vec3{float32(i) + 0.125, -float32(i)*2.5 - 1, 100.75}
+		for k := range v {
+			writeNumber(p[4*k:], "F", 4, float64(v[k]))
+		}
+		writeNumber(p[12:], "U", 2, float64(100*i))
+		writeNumber(p[14:], "U", 4, float64(l))
+		writeNumber(p[18:], "F", 8, 1e9+float64(i)*0.001)
+		writeNumber(p[26:], "U", 2, 65535)
+		writeNumber(p[28:], "U", 2, float64(256*i))
+		writeNumber(p[30:], "U", 2, 1)
+	}
+	return pp
+}
+
+func TestLAS(t *testing.T) {
+	testCases := map[string]struct {
+		labels  []uint32
+		version byte
+		format  byte
+	}{
+		"LAS12": {labels: []uint32{0, 2, 31}, version: 2, format: 3},
+		"LAS14": {labels: []uint32{0, 2, 200}, version: 4, format: 7},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			pp := createLASTestCloud(t, tt.labels)
+			var buf bytes.Buffer
+			if err := marshalPointCloud(pp, &buf, formatOptions{format: formatLAS}); err != nil {
+				t.Fatal(err)
+			}
+			b := buf.Bytes()
+			if b[25] != tt.version || b[104] != tt.format {
+				t.Errorf("Expected LAS 1.%d format %d, got: LAS 1.%d format %d", tt.version, tt.format, b[25], b[104])
+			}
+
+			out, err := unmarshalPointCloud(bytes.NewReader(b), formatOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pp.PointCloudHeader, out.PointCloudHeader) {
+				t.Fatalf("Expected header:\n%+v\nGot:\n%+v", pp.PointCloudHeader, out.PointCloudHeader)
+			}
+			if !bytes.Equal(pp.Data, out.Data) {
+				t.Errorf("Expected data:\n%v\nGot:\n%v", pp.Data, out.Data)
+			}
+		})
+	}
+
+	t.Run("SkipVLR", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{1, 2})
+		var buf bytes.Buffer
+		if err := marshalLAS(pp, &buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		vlr := make([]byte, 54)
+		b = append(b[:lasHeaderSize12:lasHeaderSize12], append(vlr, b[lasHeaderSize12:]...)...)
+		binary.LittleEndian.PutUint32(b[96:], lasHeaderSize12+54)
+		binary.LittleEndian.PutUint32(b[100:], 1)
+
+		out, err := unmarshalLAS(bytes.NewReader(b), 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pp.Data, out.Data) {
+			t.Errorf("Expected data:\n%v\nGot:\n%v", pp.Data, out.Data)
+		}
+	})
+	t.Run("Compressed", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{1})
+		var buf bytes.Buffer
+		if err := marshalLAS(pp, &buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		b[104] |= 0x80
+		if _, err := unmarshalLAS(bytes.NewReader(b), 0, nil); !errors.Is(err, errLASCompressed) {
+			t.Errorf("Expected %v, got: %v", errLASCompressed, err)
+		}
+	})
+	t.Run("TooLarge", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{1})
+		var buf bytes.Buffer
+		if err := marshalLAS(pp, &buf, nil); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		binary.LittleEndian.PutUint32(b[107:], 0xFFFFFFFF)
+		if _, err := unmarshalPointCloud(bytes.NewReader(b), formatOptions{}); !errors.Is(err, pcd.ErrTooLarge) {
+			t.Errorf("Expected %v, got: %v", pcd.ErrTooLarge, err)
+		}
+	})
+	t.Run("LabelTooLarge", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{256})
+		if err := marshalLAS(pp, &bytes.Buffer{}, nil); !errors.Is(err, errLASLabelTooLarge) {
+			t.Errorf("Expected %v, got: %v", errLASLabelTooLarge, err)
+		}
+	})
+	t.Run("Georef", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{1, 2})
+		georef := &lasGeoref{
+			scale:  [3]float64{0.001, 0.001, 0.01},
+			offset: [3]float64{500000.5, 4000000, -50},
+		}
+		var buf bytes.Buffer
+		if err := marshalPointCloud(pp, &buf, formatOptions{format: formatLAS, georef: georef}); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		if minX := math.Float64frombits(binary.LittleEndian.Uint64(b[187:])); minX != 500000.625 {
+			t.Errorf("Expected min x 500000.625, got: %v", minX)
+		}
+
+		var loaded lasGeoref
+		out, err := unmarshalPointCloud(bytes.NewReader(b), formatOptions{georef: &loaded})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded != *georef {
+			t.Errorf("Expected georef %+v, got: %+v", *georef, loaded)
+		}
+		if !bytes.Equal(pp.Data, out.Data) {
+			t.Errorf("Expected data:\n%v\nGot:\n%v", pp.Data, out.Data)
+		}
+
+		buf.Reset()
+		if err := marshalPointCloud(pp, &buf, formatOptions{format: formatXYZ, precision: 10, georef: georef}); err != nil {
+			t.Fatal(err)
+		}
+		if line, _ := buf.ReadString('\n'); !strings.HasPrefix(line, "500000.625 3999999 50.75") {
+			t.Errorf("Expected absolute coordinates, got: %q", line)
+		}
+	})
+	t.Run("GeorefOutOfRange", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{1})
+		georef := &lasGeoref{scale: [3]float64{1e-6, 1e-6, 1e-6}}
+		writeNumber(pp.Data, "F", 4, 10000)
+		if err := marshalLAS(pp, &bytes.Buffer{}, georef); !errors.Is(err, errLASOutOfRange) {
+			t.Errorf("Expected %v, got: %v", errLASOutOfRange, err)
+		}
+	})
+	t.Run("DetectPCD", func(t *testing.T) {
+		pp := createPointCloud(t, false)
+		var buf bytes.Buffer
+		if err := marshalPointCloud(pp, &buf, formatOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := unmarshalPointCloud(&buf, formatOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(pp.Data, out.Data) {
+			t.Errorf("Expected data:\n%v\nGot:\n%v", pp.Data, out.Data)
+		}
+	})
+}
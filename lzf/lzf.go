@@ -0,0 +1,128 @@
+// Package lzf implements LZF compression used by binary_compressed PCD files.
+package lzf
+
+import (
+	"errors"
+)
+
+// ErrCorrupted is returned if the compressed data is broken.
+var ErrCorrupted = errors.New("corrupted LZF data")
+
+const (
+	hashLog    = 14
+	maxLiteral = 1 << 5
+	maxOffset  = 1 << 13
+	maxRef     = (1 << 8) + (1 << 3)
+)
+
+// Compress compresses the data.
+func Compress(in []byte) []byte {
+	var table [1 << hashLog]int // position+1 of the last appearance of the hash
+	out := make([]byte, 0, len(in)+len(in)/maxLiteral+1)
+
+	var lit int
+	ctrl := len(out)
+	out = append(out, 0)
+	literal := func(b byte) {
+		out = append(out, b)
+		lit++
+		if lit == maxLiteral {
+			out[ctrl] = byte(lit - 1)
+			ctrl = len(out)
+			out = append(out, 0)
+			lit = 0
+		}
+	}
+
+	i := 0
+	for i+2 < len(in) {
+		h := (uint32(in[i])<<16 | uint32(in[i+1])<<8 | uint32(in[i+2])) * 2654435761 >> (32 - hashLog)
+		ref := table[h] - 1
+		table[h] = i + 1
+		off := i - ref - 1
+		if ref < 0 || off >= maxOffset ||
+			in[ref] != in[i] || in[ref+1] != in[i+1] || in[ref+2] != in[i+2] {
+			literal(in[i])
+			i++
+			continue
+		}
+		n := 3
+		maxN := len(in) - i
+		if maxN > maxRef {
+			maxN = maxRef
+		}
+		for n < maxN && in[ref+n] == in[i+n] {
+			n++
+		}
+
+		// Close the literal run
+		if lit > 0 {
+			out[ctrl] = byte(lit - 1)
+		} else {
+			out = out[:ctrl]
+		}
+		if l := n - 2; l < 7 {
+			out = append(out, byte(l<<5|off>>8))
+		} else {
+			out = append(out, byte(7<<5|off>>8), byte(l-7))
+		}
+		out = append(out, byte(off))
+		i += n
+
+		ctrl = len(out)
+		out = append(out, 0)
+		lit = 0
+	}
+	for ; i < len(in); i++ {
+		literal(in[i])
+	}
+	if lit > 0 {
+		out[ctrl] = byte(lit - 1)
+	} else {
+		out = out[:ctrl]
+	}
+	return out
+}
+
+// Decompress decompresses the data to n bytes.
+func Decompress(in []byte, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < maxLiteral {
+			l := ctrl + 1
+			if i+l > len(in) || len(out)+l > n {
+				return nil, ErrCorrupted
+			}
+			out = append(out, in[i:i+l]...)
+			i += l
+			continue
+		}
+		l := ctrl >> 5
+		if l == 7 {
+			if i >= len(in) {
+				return nil, ErrCorrupted
+			}
+			l += int(in[i])
+			i++
+		}
+		l += 2
+		if i >= len(in) {
+			return nil, ErrCorrupted
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+l > n {
+			return nil, ErrCorrupted
+		}
+		// Reference may overlap the output
+		for k := 0; k < l; k++ {
+			out = append(out, out[ref+k])
+		}
+	}
+	if len(out) != n {
+		return nil, ErrCorrupted
+	}
+	return out, nil
+}
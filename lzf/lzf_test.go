@@ -0,0 +1,68 @@
+package lzf
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 10000)
+	rnd.Read(random)
+	repeated := bytes.Repeat([]byte{1, 2, 3, 4, 5}, 2000)
+	sparse := make([]byte, 20000)
+	for i := range sparse {
+		if rnd.Intn(10) == 0 {
+			sparse[i] = byte(rnd.Intn(4))
+		}
+	}
+
+	testCases := map[string][]byte{
+		"Empty":    {},
+		"Short":    {1, 2},
+		"Random":   random,
+		"Repeated": repeated,
+		"Sparse":   sparse,
+		"Zero":     make([]byte, 100000),
+	}
+	for name, in := range testCases {
+		in := in
+		t.Run(name, func(t *testing.T) {
+			c := Compress(in)
+			out, err := Decompress(c, len(in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(in, out) {
+				t.Error("Decompressed data differs from the original")
+			}
+		})
+	}
+
+	if c := Compress(repeated); len(c) > len(repeated)/10 {
+		t.Errorf("Repeated data is expected to be compressed well, got %d bytes from %d bytes", len(c), len(repeated))
+	}
+}
+
+func TestDecompress_Corrupted(t *testing.T) {
+	testCases := map[string]struct {
+		in []byte
+		n  int
+	}{
+		"ShortLiteral":  {in: []byte{3, 1, 2}, n: 4},
+		"InvalidRef":    {in: []byte{0, 1, 0x20, 5}, n: 4},
+		"TooLong":       {in: []byte{1, 1, 2}, n: 1},
+		"SizeMismatch":  {in: []byte{1, 1, 2}, n: 3},
+		"MissingOffset": {in: []byte{0, 1, 0x20}, n: 4},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			if _, err := Decompress(tt.in, tt.n); !errors.Is(err, ErrCorrupted) {
+				t.Errorf("Expected %v, got %v", ErrCorrupted, err)
+			}
+		})
+	}
+}
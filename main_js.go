@@ -4,11 +4,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"runtime"
+	"strings"
 	"syscall/js"
 	"time"
 
+	"github.com/seqsense/pcdeditor/blob"
 	"github.com/seqsense/pcgol/mat"
 	"github.com/seqsense/pcgol/pc"
 	webgl "github.com/seqsense/webgl-go"
@@ -50,10 +53,16 @@ type pcdeditor struct {
 	chImportPCD         chan promiseCommand
 	chImportSubPCD      chan promiseCommand
 	chImport2D          chan promiseCommand
+	chImportLabels      chan promiseCommand
+	chImportSelections  chan promiseCommand
+	chExportSelections  chan promiseCommand
 	chExportPCD         chan promiseCommand
 	chExportSelectedPCD chan promiseCommand
+	chImportTiles       chan promiseCommand
+	chExportTiles       chan promiseCommand
 	chReset             chan promiseCommand
 	chCommand           chan promiseCommand
+	chScript            chan promiseCommand
 	chWheel             chan webgl.WheelEvent
 	chClick             chan webgl.MouseEvent
 	chMouseDown         chan webgl.MouseEvent
@@ -71,6 +80,9 @@ type pcdeditor struct {
 	cs  *console
 
 	onKeyDownHook func(webgl.KeyboardEvent)
+
+	fetchTile      js.Value
+	tileUpdateHeld bool // errTileUpdateHeld is already logged
 }
 
 func newPCDEditor(this js.Value, args []js.Value) interface{} {
@@ -83,10 +95,16 @@ func newPCDEditor(this js.Value, args []js.Value) interface{} {
 		chImportPCD:         make(chan promiseCommand, 1),
 		chImportSubPCD:      make(chan promiseCommand, 1),
 		chImport2D:          make(chan promiseCommand, 1),
+		chImportLabels:      make(chan promiseCommand, 1),
+		chImportSelections:  make(chan promiseCommand, 1),
+		chExportSelections:  make(chan promiseCommand, 1),
 		chExportPCD:         make(chan promiseCommand, 1),
 		chExportSelectedPCD: make(chan promiseCommand, 1),
+		chImportTiles:       make(chan promiseCommand, 1),
+		chExportTiles:       make(chan promiseCommand, 1),
 		chReset:             make(chan promiseCommand, 1),
 		chCommand:           make(chan promiseCommand, 1),
+		chScript:            make(chan promiseCommand, 1),
 		chWheel:             make(chan webgl.WheelEvent, 10),
 		chClick:             make(chan webgl.MouseEvent, 10),
 		chMouseDown:         make(chan webgl.MouseEvent, 10),
@@ -123,23 +141,41 @@ func newPCDEditor(this js.Value, args []js.Value) interface{} {
 
 	return js.ValueOf(map[string]interface{}{
 		"importPCD": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-			return newCommandPromise(pe.chImportPCD, args[0])
+			return newCommandPromise(pe.chImportPCD, [2]js.Value{args[0], optionalArg(args, 1)})
 		}),
 		"importSubPCD": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-			return newCommandPromise(pe.chImportSubPCD, args[0])
+			return newCommandPromise(pe.chImportSubPCD, [2]js.Value{args[0], optionalArg(args, 1)})
 		}),
 		"import2D": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 			return newCommandPromise(pe.chImport2D, [2]js.Value{args[0], args[1]})
 		}),
+		"importLabels": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return newCommandPromise(pe.chImportLabels, args[0])
+		}),
+		"importSelections": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return newCommandPromise(pe.chImportSelections, args[0])
+		}),
+		"exportSelections": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return newCommandPromise(pe.chExportSelections, nil)
+		}),
 		"exportPCD": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-			return newCommandPromise(pe.chExportPCD, nil)
+			return newCommandPromise(pe.chExportPCD, optionalArg(args, 0))
 		}),
 		"exportSelectedPCD": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
-			return newCommandPromise(pe.chExportSelectedPCD, nil)
+			return newCommandPromise(pe.chExportSelectedPCD, optionalArg(args, 0))
+		}),
+		"importTiles": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return newCommandPromise(pe.chImportTiles, [2]js.Value{args[0], args[1]})
+		}),
+		"exportTiles": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return newCommandPromise(pe.chExportTiles, optionalArg(args, 0))
 		}),
 		"command": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 			return newCommandPromise(pe.chCommand, args[0].String())
 		}),
+		"run_script": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+			return newCommandPromise(pe.chScript, args[0].String())
+		}),
 		"show2D": js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 			return newCommandPromise(pe.ch2D, args[0].Bool())
 		}),
@@ -153,28 +189,161 @@ func newPCDEditor(this js.Value, args []js.Value) interface{} {
 	})
 }
 
+func resultToJS(res interface{}) interface{} {
+	switch r := res.(type) {
+	case [][]float32:
+		jm := js.Global().Get("Array").New(len(r))
+		for i, vec := range r {
+			jv := js.Global().Get("Array").New(len(vec))
+			for j, val := range vec {
+				jv.SetIndex(j, js.ValueOf(val))
+			}
+			jm.SetIndex(i, jv)
+		}
+		return jm
+	case []string:
+		ja := js.Global().Get("Array").New(len(r))
+		for i, str := range r {
+			ja.SetIndex(i, str)
+		}
+		return ja
+	case []interface{}:
+		ja := js.Global().Get("Array").New(len(r))
+		for i, v := range r {
+			ja.SetIndex(i, resultToJS(v))
+		}
+		return ja
+	default:
+		return res
+	}
+}
+
+// optionalArg returns i-th argument or undefined if not given.
+func optionalArg(args []js.Value, i int) js.Value {
+	if len(args) <= i {
+		return js.Undefined()
+	}
+	return args[i]
+}
+
+// formatOptionsFromJS parses the point cloud format given as a format name string
+// or an object like {format: 'csv', columns: ['x', 'y', 'z', '_', 'label'], delimiter: ',', skipRows: 1}
+// or {format: 'pcd', encoding: 'binary_compressed', fields: ['x', 'y', 'z'], precision: 6, viewpoint: [0, 0, 0, 1, 0, 0, 0]}
+// or {onProgress: (loaded, total) => {}, signal: abortController.signal, maxBytes: 1073741824}.
+// signal is not parsed here, use abortContextFromJS.
+func formatOptionsFromJS(v js.Value) (formatOptions, error) {
+	var opts formatOptions
+	var err error
+	switch v.Type() {
+	case js.TypeUndefined, js.TypeNull:
+		return opts, nil
+	case js.TypeString:
+		opts.format, err = parsePointCloudFormat(v.String())
+		return opts, err
+	case js.TypeObject:
+	default:
+		return opts, errors.New("format must be a string or an object")
+	}
+	if f := v.Get("format"); f.Type() == js.TypeString {
+		if opts.format, err = parsePointCloudFormat(f.String()); err != nil {
+			return opts, err
+		}
+	}
+	opts.text.columns = stringsFromJS(v.Get("columns"))
+	if d := v.Get("delimiter"); d.Type() == js.TypeString {
+		opts.text.delimiter = d.String()
+	}
+	if n := v.Get("skipRows"); n.Type() == js.TypeNumber {
+		opts.text.skipRows = n.Int()
+	}
+	if fn := v.Get("onProgress"); fn.Type() == js.TypeFunction {
+		opts.progress = func(loaded, total int) {
+			fn.Invoke(loaded, total)
+		}
+	}
+	if n := v.Get("maxBytes"); n.Type() == js.TypeNumber {
+		opts.maxBytes = n.Int()
+	}
+	if e := v.Get("encoding"); e.Type() == js.TypeString {
+		opts.encoding = e.String()
+	}
+	opts.fields = stringsFromJS(v.Get("fields"))
+	if n := v.Get("precision"); n.Type() == js.TypeNumber {
+		opts.precision = n.Int()
+	}
+	if vp := v.Get("viewpoint"); vp.Type() == js.TypeObject {
+		opts.viewpoint = make([]float32, vp.Length())
+		for i := range opts.viewpoint {
+			opts.viewpoint[i] = float32(vp.Index(i).Float())
+		}
+	}
+	return opts, nil
+}
+
+// abortContextFromJS returns the context canceled by the signal of the format options, or nil.
+// release must be called after loading to remove the listener from the signal.
+func abortContextFromJS(v js.Value) (ctx context.Context, release func()) {
+	if v.Type() != js.TypeObject {
+		return nil, func() {}
+	}
+	signal := v.Get("signal")
+	if signal.Type() != js.TypeObject {
+		return nil, func() {}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if signal.Get("aborted").Bool() {
+		cancel()
+	}
+	onAbort := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		cancel()
+		return nil
+	})
+	signal.Call("addEventListener", "abort", onAbort)
+	return ctx, func() {
+		signal.Call("removeEventListener", "abort", onAbort)
+		onAbort.Release()
+		cancel()
+	}
+}
+
+// stringsFromJS returns the array of strings or the comma separated string as a slice.
+func stringsFromJS(v js.Value) []string {
+	switch v.Type() {
+	case js.TypeString:
+		return strings.Split(v.String(), ",")
+	case js.TypeObject:
+		s := make([]string, v.Length())
+		for i := range s {
+			s[i] = v.Index(i).String()
+		}
+		return s
+	}
+	return nil
+}
+
+// readTextOrBlob reads the content of the string or the Blob.
+func readTextOrBlob(v js.Value) ([]byte, error) {
+	if v.Type() == js.TypeString {
+		return []byte(v.String()), nil
+	}
+	b, err := blob.JS(v)
+	if err != nil {
+		return nil, err
+	}
+	r, err := b.Reader()
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
 func newCommandPromise(ch chan promiseCommand, data interface{}) js.Value {
 	promise := js.Global().Get("Promise")
 	return promise.New(js.FuncOf(func(this js.Value, args []js.Value) interface{} {
 		resolve, reject := args[0], args[1]
 		cmd := promiseCommand{
-			data: data,
-			resolved: func(res interface{}) {
-				switch r := res.(type) {
-				case [][]float32:
-					jm := js.Global().Get("Array").New(len(r))
-					for i, vec := range r {
-						jv := js.Global().Get("Array").New(len(vec))
-						for j, val := range vec {
-							jv.SetIndex(j, js.ValueOf(val))
-						}
-						jm.SetIndex(i, jv)
-					}
-					resolve.Invoke(jm)
-				default:
-					resolve.Invoke(res)
-				}
-			},
+			data:     data,
+			resolved: func(res interface{}) { resolve.Invoke(resultToJS(res)) },
 			rejected: func(err error) { reject.Invoke(errorToJS(err)) },
 		}
 		select {
@@ -428,6 +597,12 @@ func (pe *pcdeditor) runImpl(ctx context.Context) error {
 	uUseSelectMask := gl.GetUniformLocation(program, "uUseSelectMask")
 	uMinLabel := gl.GetUniformLocation(program, "uMinLabel")
 	uMaxLabel := gl.GetUniformLocation(program, "uMaxLabel")
+	uColorMode := gl.GetUniformLocation(program, "uColorMode")
+	uColormap := gl.GetUniformLocation(program, "uColormap")
+	uIntensityMin := gl.GetUniformLocation(program, "uIntensityMin")
+	uIntensityRange := gl.GetUniformLocation(program, "uIntensityRange")
+	uLabelPalette := gl.GetUniformLocation(program, "uLabelPalette")
+	uLabelPaletteSize := gl.GetUniformLocation(program, "uLabelPaletteSize")
 
 	uProjectionMatrixLocationSub := gl.GetUniformLocation(programSub, "uProjectionMatrix")
 	uModelViewMatrixLocationSub := gl.GetUniformLocation(programSub, "uModelViewMatrix")
@@ -458,8 +633,12 @@ func (pe *pcdeditor) runImpl(ctx context.Context) error {
 	selectResultBuf := gl.CreateBuffer()
 	selectMaskBuf := gl.CreateBuffer()
 	toolBuf := gl.CreateBuffer()
+	polygonBuf := gl.CreateBuffer()
 	var selectResultJS js.Value
 	var selectResultGo []byte
+	var renderBuf, renderSubBuf []byte
+	var layout, layoutSub renderLayout
+	var renderColorMode colorMode
 
 	tick := time.NewTicker(time.Second / 8)
 	defer tick.Stop()
@@ -474,6 +653,7 @@ func (pe *pcdeditor) runImpl(ctx context.Context) error {
 	var vib3DX float32
 
 	var nRectPoints int
+	var nPolygonPoints int
 
 	// Result of the last selection scan, reusable while the scan inputs are unchanged
 	type scanState struct {
@@ -494,12 +674,14 @@ func (pe *pcdeditor) runImpl(ctx context.Context) error {
 		aVertexLabel     = 1
 		aTextureCoordMap = 1
 		aSelectMask      = 2
+		aColorField      = 3
 	)
 
 	devicePixelRatioJS := js.Global().Get("window").Get("devicePixelRatio")
 	wheelNormalizer := &wheelNormalizer{}
 
 	texture := gl.CreateTexture()
+	paletteTexture := gl.CreateTexture()
 	mapRect := &pc.PointCloud{
 		PointCloudHeader: pc.PointCloudHeader{
 			Fields: []string{"x", "y", "z", "u", "v"},
@@ -531,7 +713,18 @@ func (pe *pcdeditor) runImpl(ctx context.Context) error {
 				pe.logPrint("CRASHED (export command is available)")
 				pe.logPrint("!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!!")
 				for promise := range pe.chExportPCD {
-					blob, err := pe.cmd.pcdIO.exportPCD(pp)
+					opts, err := formatOptionsFromJS(promise.data.(js.Value))
+					if err != nil {
+						promise.rejected(err)
+						continue
+					}
+					exp, err := pe.cmd.editor.exportable(pp)
+					if err != nil {
+						promise.rejected(err)
+						continue
+					}
+					opts.georef = pe.cmd.editor.georef
+					blob, err := pe.cmd.pcdIO.exportPCD(exp, opts)
 					if err != nil {
 						promise.rejected(err)
 						continue
@@ -637,6 +830,38 @@ L_MAIN:
 			}
 		}
 
+		if polygon, updated := pe.cmd.Polygon(); updated || forceReload {
+			// Send vertices of the polygon being drawn to GPU
+			buf := make([]float32, 0, len(polygon)*3)
+			for _, p := range polygon {
+				buf = append(buf, p[0], p[1], p[2])
+			}
+			nPolygonPoints = len(polygon)
+			if nPolygonPoints > 0 {
+				gl.BindBuffer(gl.ARRAY_BUFFER, polygonBuf)
+				gl.BufferData(gl.ARRAY_BUFFER, webgl.Float32ArrayBuffer(buf), gl.STATIC_DRAW)
+			}
+		}
+
+		if palette, updated := pe.cmd.LabelPalette(); updated || forceReload {
+			// Send label palette texture to GPU
+			data := js.Global().Get("Uint8ClampedArray").New(len(palette))
+			js.CopyBytesToJS(data, palette)
+			img := js.Global().Get("ImageData").New(data, len(palette)/4, 1)
+			gl.ActiveTexture(gl.TEXTURE0 + 1)
+			gl.BindTexture(gl.TEXTURE_2D, paletteTexture)
+			gl.TexImage2D(gl.TEXTURE_2D, 0, gl.RGBA, gl.RGBA, gl.UNSIGNED_BYTE, img)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MIN_FILTER, gl.NEAREST)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_MAG_FILTER, gl.NEAREST)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_S, gl.CLAMP_TO_EDGE)
+			gl.TexParameteri(gl.TEXTURE_2D, gl.TEXTURE_WRAP_T, gl.CLAMP_TO_EDGE)
+			gl.ActiveTexture(gl.TEXTURE0)
+
+			gl.UseProgram(program)
+			gl.Uniform1i(uLabelPalette, 1)
+			gl.Uniform1ui(uLabelPaletteSize, uint32(len(palette)/4))
+		}
+
 		mi, img, mapUpdated, has2D := pe.cmd.Map()
 		if has2D && (mapUpdated || forceReload) {
 			// Send 2D map texture to GPU
@@ -689,11 +914,15 @@ L_MAIN:
 			gl.BufferData(gl.ARRAY_BUFFER, selectMaskData, gl.STATIC_DRAW)
 		}
 
+		colorMode := pe.cmd.ColorMode()
 		pp, updatedPointCloud, hasPointCloud := pe.cmd.PointCloud()
-		if hasPointCloud && (updatedPointCloud || forceReload) && pp.Points > 0 {
+		if hasPointCloud && (updatedPointCloud || forceReload || colorMode != renderColorMode) && pp.Points > 0 {
 			// Send PointCloud vertices to GPU
+			var vertices []byte
+			vertices, layout = renderBuffer(&renderBuf, pp, colorMode)
+			renderColorMode = colorMode
 			gl.BindBuffer(gl.ARRAY_BUFFER, posBuf)
-			gl.BufferData(gl.ARRAY_BUFFER, webgl.ByteArrayBuffer(pp.Data), gl.STATIC_DRAW)
+			gl.BufferData(gl.ARRAY_BUFFER, webgl.ByteArrayBuffer(vertices), gl.STATIC_DRAW)
 
 			// Re-allocate buffer only when pointcloud size is changed
 			if nBuf := pp.Points * 4; nBuf != len(selectResultGo) {
@@ -714,8 +943,10 @@ L_MAIN:
 		ppSub, updatedSubPointCloud, hasSubPointCloud := pe.cmd.SubPointCloud()
 		if hasSubPointCloud && (updatedSubPointCloud || forceReload) && ppSub.Points > 0 {
 			// Send PointCloud vertices to GPU
+			var vertices []byte
+			vertices, layoutSub = renderBuffer(&renderSubBuf, ppSub, colorModeZ)
 			gl.BindBuffer(gl.ARRAY_BUFFER, posSubBuf)
-			gl.BufferData(gl.ARRAY_BUFFER, webgl.ByteArrayBuffer(ppSub.Data), gl.STATIC_DRAW)
+			gl.BufferData(gl.ARRAY_BUFFER, webgl.ByteArrayBuffer(vertices), gl.STATIC_DRAW)
 		}
 
 		render := func() {
@@ -730,29 +961,37 @@ L_MAIN:
 				maxStride := 4
 				if hasPointCloud && pp.Points > 0 {
 					totalPoints += pp.Points
-					maxStride = max(pp.Stride(), maxStride)
+					maxStride = max(layout.stride, maxStride)
 				}
 				if hasSubPointCloud && ppSub.Points > 0 && selectMode == selectModeInsert {
 					totalPoints += ppSub.Points
-					maxStride = max(ppSub.Stride(), maxStride)
-				}
-				samplingRatio = 1 + totalPoints/pe.cmd.NumFastRenderPoints()
-				// make sure the stride used in gl.VertexAttribIPointer is <= 255
-				if samplingRatio*maxStride > 255 {
-					samplingRatio = int(255.0 / maxStride)
+					maxStride = max(layoutSub.stride, maxStride)
 				}
+				samplingRatio = renderSamplingRatio(totalPoints, pe.cmd.NumFastRenderPoints(), maxStride)
 			}
 
 			if hasPointCloud && pp.Points > 0 {
 				// Render PointCloud
 				gl.UseProgram(program)
-				clean := enableVertexAttribs(gl, aVertexPosition, aVertexLabel, aSelectMask)
+				colorMode := renderColorMode
+				cf, hasColorField := layout.color, layout.hasColor
+				if !hasColorField && colorMode != colorModeZ {
+					colorMode = colorModeLabel
+				}
+				attrs := []int{aVertexPosition, aVertexLabel, aSelectMask}
+				if hasColorField {
+					attrs = append(attrs, aColorField)
+				}
+				clean := enableVertexAttribs(gl, attrs...)
 
-				switch selectMode {
-				case selectModeRect, selectModeInsert:
-					gl.Uniform1i(uUseSelectMask, 0)
-				case selectModeMask:
+				switch {
+				case selectMode == selectModeMask:
 					gl.Uniform1i(uUseSelectMask, 1)
+				case selectMode == selectModeRect && pe.cmd.HasMaskSelection():
+					// Show the mask selection to be combined with the select box
+					gl.Uniform1i(uUseSelectMask, 2)
+				default:
+					gl.Uniform1i(uUseSelectMask, 0)
 				}
 
 				renderLabelMin, renderLabelMax := pe.cmd.RenderLabelRange()
@@ -760,9 +999,12 @@ L_MAIN:
 				gl.Uniform1ui(uMaxLabel, renderLabelMax)
 
 				gl.BindBuffer(gl.ARRAY_BUFFER, posBuf)
-				sampledStride := pp.Stride() * samplingRatio
+				sampledStride := layout.stride * samplingRatio
 				gl.VertexAttribPointer(aVertexPosition, 3, gl.FLOAT, false, sampledStride, 0)
-				gl.VertexAttribIPointer(aVertexLabel, 1, gl.UNSIGNED_INT, sampledStride, 3*4)
+				gl.VertexAttribIPointer(aVertexLabel, 1, gl.UNSIGNED_INT, sampledStride, renderOffsetLabel)
+				if hasColorField {
+					gl.VertexAttribPointer(aColorField, cf.count, colorFieldGLType(gl, cf), cf.normalized, sampledStride, cf.offset)
+				}
 				gl.UniformMatrix4fv(uModelViewMatrixLocation, false, modelViewMatrix)
 				gl.UniformMatrix4fv(uCropMatrixLocation, false, pe.cmd.CropMatrix())
 
@@ -773,6 +1015,12 @@ L_MAIN:
 				gl.Uniform1f(uZMinLocation, zMin)
 				gl.Uniform1f(uZRangeLocation, zMax-zMin)
 
+				gl.Uniform1i(uColorMode, int(colorMode))
+				gl.Uniform1i(uColormap, int(pe.cmd.Colormap()))
+				iMin, iMax := pe.cmd.IntensityRange()
+				gl.Uniform1f(uIntensityMin, iMin)
+				gl.Uniform1f(uIntensityRange, iMax-iMin)
+
 				mSel, _ := pe.cmd.SelectMatrix()
 				gl.UniformMatrix4fv(uSelectMatrixLocation, false, mSel)
 
@@ -794,7 +1042,7 @@ L_MAIN:
 				gl.UseProgram(programSub)
 				clean := enableVertexAttribs(gl, aVertexPosition)
 				gl.BindBuffer(gl.ARRAY_BUFFER, posSubBuf)
-				gl.VertexAttribPointer(aVertexPosition, 3, gl.FLOAT, false, ppSub.Stride()*samplingRatio, 0)
+				gl.VertexAttribPointer(aVertexPosition, 3, gl.FLOAT, false, layoutSub.stride*samplingRatio, 0)
 				trans := cursorsToTrans(cursors)
 				gl.UniformMatrix4fv(
 					uModelViewMatrixLocationSub, false,
@@ -833,6 +1081,22 @@ L_MAIN:
 				clean()
 			}
 
+			if nPolygonPoints > 0 {
+				// Render polygon being drawn
+				gl.Enable(gl.BLEND)
+				gl.BlendFunc(gl.SRC_ALPHA, gl.ONE_MINUS_SRC_ALPHA)
+				gl.UseProgram(programSel)
+				clean := enableVertexAttribs(gl, aVertexPosition)
+				gl.BindBuffer(gl.ARRAY_BUFFER, polygonBuf)
+				gl.VertexAttribPointer(aVertexPosition, 3, gl.FLOAT, false, 3*4, 0)
+				gl.UniformMatrix4fv(uModelViewMatrixLocationSel, false, modelViewMatrix)
+				gl.Uniform1f(uPointSizeBaseSel, pointSize)
+				gl.DrawArrays(gl.LINE_LOOP, 0, nPolygonPoints)
+				gl.DrawArrays(gl.POINTS, 0, nPolygonPoints)
+				gl.Disable(gl.BLEND)
+				clean()
+			}
+
 			if show2D && has2D {
 				// Render 2D map
 				gl.Enable(gl.BLEND)
@@ -879,7 +1143,7 @@ L_MAIN:
 				defer clean()
 
 				gl.BindBuffer(gl.ARRAY_BUFFER, posBuf)
-				gl.VertexAttribPointer(aVertexPosition, 3, gl.FLOAT, false, pp.Stride(), 0)
+				gl.VertexAttribPointer(aVertexPosition, 3, gl.FLOAT, false, layout.stride, 0)
 				gl.BindBuffer(gl.ARRAY_BUFFER, selectMaskBuf)
 				gl.VertexAttribIPointer(aSelectMask, 1, gl.UNSIGNED_INT, 4, 0)
 
@@ -956,6 +1220,12 @@ L_MAIN:
 		scanSelectionWithCursor := func(x, y int) bool {
 			return scanSelectionImpl(x, y, true)
 		}
+		updateSelection := func() error {
+			if scanSelection() {
+				return nil
+			}
+			return errors.New("failed to scan selected points")
+		}
 
 		// Check the cursor is on select box vertices
 		cursorOnSelect := func(e webgl.MouseEvent) (*mat.Vec3, bool) {
@@ -976,7 +1246,17 @@ L_MAIN:
 			select {
 			case promise := <-pe.chImportPCD:
 				pe.logPrint("importing pcd")
-				if err := pe.cmd.ImportPCD(promise.data); err != nil {
+				data := promise.data.([2]js.Value)
+				opts, err := formatOptionsFromJS(data[1])
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				ctx, release := abortContextFromJS(data[1])
+				opts.ctx = ctx
+				err = pe.cmd.ImportPCD(data[0], opts)
+				release()
+				if err != nil {
 					promise.rejected(err)
 					break
 				}
@@ -984,7 +1264,17 @@ L_MAIN:
 				promise.resolved("loaded")
 			case promise := <-pe.chImportSubPCD:
 				pe.logPrint("importing sub pcd")
-				if err := pe.cmd.ImportSubPCD(promise.data); err != nil {
+				data := promise.data.([2]js.Value)
+				opts, err := formatOptionsFromJS(data[1])
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				ctx, release := abortContextFromJS(data[1])
+				opts.ctx = ctx
+				err = pe.cmd.ImportSubPCD(data[0], opts)
+				release()
+				if err != nil {
 					promise.rejected(err)
 					break
 				}
@@ -999,9 +1289,45 @@ L_MAIN:
 				}
 				pe.logPrint("2D map loaded")
 				promise.resolved("loaded")
+			case promise := <-pe.chImportLabels:
+				b, err := readTextOrBlob(promise.data.(js.Value))
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				if err := pe.cmd.ImportLabelTable(b); err != nil {
+					promise.rejected(err)
+					break
+				}
+				pe.logPrint("label table loaded")
+				promise.resolved("loaded")
+			case promise := <-pe.chImportSelections:
+				b, err := readTextOrBlob(promise.data.(js.Value))
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				if err := pe.cmd.ImportSelections(b); err != nil {
+					promise.rejected(err)
+					break
+				}
+				pe.logPrint("selections loaded")
+				promise.resolved("loaded")
+			case promise := <-pe.chExportSelections:
+				b, err := pe.cmd.ExportSelections()
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				promise.resolved(string(b))
 			case promise := <-pe.chExportPCD:
 				pe.logPrint("exporting pcd")
-				blob, err := pe.cmd.ExportPCD()
+				opts, err := formatOptionsFromJS(promise.data.(js.Value))
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				blob, err := pe.cmd.ExportPCD(opts)
 				if err != nil {
 					promise.rejected(err)
 					break
@@ -1013,23 +1339,53 @@ L_MAIN:
 				if !scanSelection() {
 					promise.rejected(errors.New("failed to scan selected points"))
 				}
-				blob, err := pe.cmd.ExportSelectedPCD()
+				opts, err := formatOptionsFromJS(promise.data.(js.Value))
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				blob, err := pe.cmd.ExportSelectedPCD(opts)
 				if err != nil {
 					promise.rejected(err)
 					break
 				}
 				pe.logPrint("pcd exported")
 				promise.resolved(blob)
+			case promise := <-pe.chImportTiles:
+				pe.logPrint("importing tiles")
+				data := promise.data.([2]js.Value)
+				if err := pe.importTiles(data[0], data[1]); err != nil {
+					promise.rejected(err)
+					break
+				}
+				pe.logPrint("tiles loaded")
+				promise.resolved("loaded")
+			case promise := <-pe.chExportTiles:
+				pe.logPrint("exporting tiles")
+				opts, err := formatOptionsFromJS(promise.data.(js.Value))
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				tiles, err := pe.exportTiles(opts)
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				pe.logPrint("tiles exported")
+				promise.resolved(tiles)
 			case promise := <-pe.chReset:
 				pe.cmd.Reset()
 				promise.resolved("resetted")
 			case promise := <-pe.chCommand:
-				res, err := pe.cs.Run(promise.data.(string), func() error {
-					if scanSelection() {
-						return nil
-					}
-					return errors.New("failed to scan selected points")
-				})
+				res, err := pe.cs.Run(promise.data.(string), updateSelection)
+				if err != nil {
+					promise.rejected(err)
+					break
+				}
+				promise.resolved(res)
+			case promise := <-pe.chScript:
+				res, err := pe.cs.RunScript(promise.data.(string), updateSelection)
 				if err != nil {
 					promise.rejected(err)
 					break
@@ -1198,6 +1554,7 @@ L_MAIN:
 					}
 				case e.AltKey:
 					if projectionType != ProjectionPerspective {
+						pe.cmd.AddPolygonVertex(*p)
 						break
 					}
 					if ok := scanSelectionWithCursor(scaled(e.OffsetX), scaled(e.OffsetY)); ok {
@@ -1233,30 +1590,31 @@ L_MAIN:
 						pe.cmd.UnsetCursors()
 					}
 				case "Enter":
+					// Selection mask is required to select the polygon
+					scanSelection()
 					if err := pe.cmd.FinalizeCurrentMode(); err != nil {
 						pe.logPrint("Failed: " + err.Error())
 					}
-				case "Delete", "Backspace", "Digit0", "Digit1":
-					switch e.Code {
-					case "Delete", "Backspace":
-						if ok := scanSelection(); ok {
-							pe.cmd.Delete()
-							if !e.ShiftKey && !e.CtrlKey {
-								pe.cmd.UnsetCursors()
-							}
+				case "Delete", "Backspace":
+					if ok := scanSelection(); ok {
+						if err := pe.cmd.Delete(); err != nil {
+							pe.logPrint("Failed: " + err.Error())
 						}
-					case "Digit0", "Digit1":
-						var l uint32
-						if e.Code == "Digit1" {
-							l = 1
-						}
-						if ok := scanSelection(); ok {
-							pe.cmd.Label(l)
+						if !e.ShiftKey && !e.CtrlKey {
+							pe.cmd.UnsetCursors()
 						}
 					}
 				case "KeyZ":
 					if e.CtrlKey {
-						pe.cmd.Undo()
+						if e.ShiftKey {
+							pe.cmd.Redo()
+						} else {
+							pe.cmd.Undo()
+						}
+					}
+				case "KeyY":
+					if e.CtrlKey {
+						pe.cmd.Redo()
 					}
 				case "KeyU":
 					pe.cmd.Undo()
@@ -1335,10 +1693,23 @@ L_MAIN:
 					pe.vi.SnapPitch()
 				case "KeyP":
 					vib3D = !vib3D
+				default:
+					// Keep the shortcuts with modifier keys like Ctrl+C
+					if e.CtrlKey || e.JS().Get("metaKey").Truthy() {
+						break
+					}
+					if l, ok := pe.cmd.LabelTable().byKey(e.Code); ok {
+						if ok := scanSelection(); ok {
+							pe.cmd.Label(l)
+						}
+					}
 				}
 			case <-pe.chContextLost:
 				return errContextLostEvent
 			case <-tick.C:
+				if pe.updateTiles() {
+					break
+				}
 				if vib3D {
 					if vib3DX < 0 {
 						vib3DX = vib3DXAmp
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+// namedSelection is the selection saved by name.
+// Either the cursors of the rectangle/box selection or
+// the index ranges of the selected points is stored.
+type namedSelection struct {
+	Cursors [][3]float32 `json:"cursors,omitempty"`
+	Range   float32      `json:"range,omitempty"` // thickness of the rectangle selection
+
+	// Points is the number of the points of the cloud on which the selection is made.
+	Points int `json:"points,omitempty"`
+	// Indices is the list of the [begin, end) ranges of the selected point indices.
+	Indices [][2]int `json:"indices,omitempty"`
+	// Hash is the hash of the coordinates of the selected points
+	// to detect that the points are moved or the indices are shifted by the edits.
+	Hash string `json:"hash,omitempty"`
+}
+
+type namedSelections map[string]*namedSelection
+
+func (s *namedSelection) isMask() bool {
+	return s.Cursors == nil
+}
+
+func (s *namedSelection) String() string {
+	if !s.isMask() {
+		return strconv.Itoa(len(s.Cursors)) + " cursors"
+	}
+	var n int
+	for _, r := range s.Indices {
+		n += r[1] - r[0]
+	}
+	return strconv.Itoa(n) + " points"
+}
+
+// maskRanges returns the ranges of the indices where the bit of the mask is set.
+func maskRanges(mask []uint32, bit uint32) [][2]int {
+	var out [][2]int
+	begin := -1
+	for i, m := range mask {
+		switch {
+		case m&bit != 0 && begin < 0:
+			begin = i
+		case m&bit == 0 && begin >= 0:
+			out = append(out, [2]int{begin, i})
+			begin = -1
+		}
+	}
+	if begin >= 0 {
+		out = append(out, [2]int{begin, len(mask)})
+	}
+	return out
+}
+
+// selectionHash returns the hash of the coordinates of the points in the index ranges.
+// x, y and z are placed at the beginning of the editor record.
+func selectionHash(pp *pc.PointCloud, ranges [][2]int) string {
+	h := fnv.New64a()
+	stride := pp.Stride()
+	for _, r := range ranges {
+		for i := r[0]; i < r[1]; i++ {
+			h.Write(pp.Data[i*stride : i*stride+12])
+		}
+	}
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+func parseNamedSelections(b []byte) (namedSelections, error) {
+	var s namedSelections
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	for name, sel := range s {
+		if name == "" {
+			return nil, errors.New("selection name must not be empty")
+		}
+		if sel == nil {
+			return nil, fmt.Errorf("selection %s is empty", name)
+		}
+		if !sel.isMask() {
+			if n := len(sel.Cursors); n < 1 || n > 4 {
+				return nil, fmt.Errorf("selection %s: number of cursors must be 1-4", name)
+			}
+			continue
+		}
+		for _, r := range sel.Indices {
+			if r[0] < 0 || r[0] >= r[1] || r[1] > sel.Points {
+				return nil, fmt.Errorf("selection %s: invalid index range %v", name, r)
+			}
+		}
+		if sel.Hash == "" {
+			return nil, fmt.Errorf("selection %s: hash of the points is missing", name)
+		}
+	}
+	return s, nil
+}
+
+// SaveSelection saves the current selection by the name.
+// Selection mask must be updated before calling it to save the mask selection.
+func (c *commandContext) SaveSelection(name string) error {
+	if name == "" {
+		return errors.New("selection name must not be empty")
+	}
+	var sel *namedSelection
+	switch {
+	case c.selectMode == selectModeMask:
+		if err := c.checkSelectMask(); err != nil {
+			return err
+		}
+		indices := maskRanges(c.selectMask, selectBitmaskSegmentSelected)
+		sel = &namedSelection{
+			Points:  c.editor.pp.Points,
+			Indices: indices,
+			Hash:    selectionHash(c.editor.pp, indices),
+		}
+	case c.selectMode == selectModeRect && len(c.selected) > 0:
+		sel = &namedSelection{Range: *c.selectRange}
+		for _, p := range c.selected {
+			sel.Cursors = append(sel.Cursors, [3]float32(p))
+		}
+	default:
+		return errors.New("nothing is selected")
+	}
+	if c.selections == nil {
+		c.selections = make(namedSelections)
+	}
+	c.selections[name] = sel
+	return nil
+}
+
+// LoadSelection restores the selection saved by the name.
+// The point selection is combined with the current selection by the select operation.
+// Selection mask must be updated before calling it to load the point selection.
+func (c *commandContext) LoadSelection(name string) error {
+	sel, ok := c.selections[name]
+	if !ok {
+		return fmt.Errorf("selection %s is not found", name)
+	}
+	if c.selectMode == selectModeInsert {
+		return errors.New("selection is not available in insert mode")
+	}
+	if !sel.isMask() {
+		c.UnsetCursors()
+		for i, p := range sel.Cursors {
+			c.SetCursor(i, mat.Vec3(p))
+		}
+		if sel.Range > 0 {
+			c.SetSelectRange(rangeTypeAuto, sel.Range)
+		}
+		return nil
+	}
+	if err := c.checkSelectMask(); err != nil {
+		return err
+	}
+	if sel.Points != c.editor.pp.Points {
+		return fmt.Errorf("selection %s is made on the cloud of %d points but current cloud has %d points",
+			name, sel.Points, c.editor.pp.Points)
+	}
+	if selectionHash(c.editor.pp, sel.Indices) != sel.Hash {
+		return fmt.Errorf("selected points of %s are modified", name)
+	}
+	c.beginMaskSelection()
+	for _, r := range sel.Indices {
+		for i := r[0]; i < r[1]; i++ {
+			c.selectMask[i] |= selectBitmaskSegmentSelected
+		}
+	}
+	c.endMaskSelection()
+	return nil
+}
+
+func (c *commandContext) DeleteSelection(name string) error {
+	if _, ok := c.selections[name]; !ok {
+		return fmt.Errorf("selection %s is not found", name)
+	}
+	delete(c.selections, name)
+	return nil
+}
+
+// SelectionList returns the names and the sizes of the saved selections.
+func (c *commandContext) SelectionList() []string {
+	names := make([]string, 0, len(c.selections))
+	for name := range c.selections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]string, len(names))
+	for i, name := range names {
+		out[i] = name + ": " + c.selections[name].String()
+	}
+	return out
+}
+
+// ExportSelections returns the saved selections in JSON.
+func (c *commandContext) ExportSelections() ([]byte, error) {
+	if c.selections == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c.selections)
+}
+
+// ImportSelections adds the selections given in JSON.
+// Selections of the same names are overwritten.
+func (c *commandContext) ImportSelections(b []byte) error {
+	s, err := parseNamedSelections(b)
+	if err != nil {
+		return err
+	}
+	if c.selections == nil {
+		c.selections = make(namedSelections)
+	}
+	for name, sel := range s {
+		c.selections[name] = sel
+	}
+	return nil
+}
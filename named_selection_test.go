@@ -0,0 +1,143 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestMaskRanges(t *testing.T) {
+	testCases := map[string]struct {
+		mask     []uint32
+		expected [][2]int
+	}{
+		"Empty":    {[]uint32{0, 0, 0}, nil},
+		"All":      {[]uint32{1, 1, 1}, [][2]int{{0, 3}}},
+		"Split":    {[]uint32{1, 0, 1, 1, 0}, [][2]int{{0, 1}, {2, 4}}},
+		"OtherBit": {[]uint32{2, 3, 1}, [][2]int{{1, 3}}},
+	}
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			if r := maskRanges(tt.mask, 1); !reflect.DeepEqual(tt.expected, r) {
+				t.Errorf("Expected %v, got %v", tt.expected, r)
+			}
+		})
+	}
+}
+
+func TestNamedSelection(t *testing.T) {
+	c := &console{cmd: newCommandContext(&dummyPCDIO{}, nil)}
+	if err := c.cmd.editor.SetPointCloud(createPointCloud(t, false), cloudMain); err != nil {
+		t.Fatal(err)
+	}
+	run := func(cmd string) interface{} {
+		t.Helper()
+		res, err := c.Run(cmd, noUpdate)
+		if err != nil {
+			t.Fatalf("%s: %v", cmd, err)
+		}
+		return res
+	}
+	selected := func() []int {
+		t.Helper()
+		if c.cmd.SelectMode() != selectModeMask {
+			t.Fatal("Select mode must be mask")
+		}
+		var ids []int
+		for i, m := range c.cmd.SelectMask() {
+			if m&selectBitmaskSegmentSelected != 0 {
+				ids = append(ids, i)
+			}
+		}
+		return ids
+	}
+
+	if _, err := c.Run("sel_save empty", noUpdate); err == nil {
+		t.Error("Expected error without selection")
+	}
+
+	cursors := []mat.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}}
+	for i, p := range cursors {
+		c.cmd.SetCursor(i, p)
+	}
+	c.cmd.SetSelectRange(rangeTypeAuto, 2)
+	run("sel_save box")
+
+	c.cmd.SetSelectMask([]uint32{selectBitmaskSegmentSelected, 0, selectBitmaskSegmentSelected})
+	c.cmd.selectMode = selectModeMask
+	c.cmd.hasMaskSelection = true
+	run("sel_save points")
+
+	if l := run("sel_list"); !reflect.DeepEqual([]string{"box: 3 cursors", "points: 2 points"}, l) {
+		t.Errorf("Unexpected list: %v", l)
+	}
+
+	b, err := c.cmd.ExportSelections()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.cmd.UnsetCursors()
+	run("sel_load box")
+	if c.cmd.SelectMode() != selectModeRect {
+		t.Error("Select mode must be rect")
+	}
+	if cs := c.cmd.Cursors(); !reflect.DeepEqual(cursors, cs) {
+		t.Errorf("Expected cursors %v, got %v", cursors, cs)
+	}
+	if r := c.cmd.SelectRange(rangeTypeAuto); r != 2 {
+		t.Errorf("Expected select range 2, got %f", r)
+	}
+
+	run("sel_load points")
+	if ids := selected(); !reflect.DeepEqual([]int{0, 2}, ids) {
+		t.Errorf("Expected [0 2], got %v", ids)
+	}
+	run("select_op intersect")
+	c.cmd.SelectMask()[0] &= ^uint32(selectBitmaskSegmentSelected)
+	c.cmd.SelectMask()[1] |= selectBitmaskSegmentSelected
+	run("sel_load points")
+	if ids := selected(); !reflect.DeepEqual([]int{2}, ids) {
+		t.Errorf("Loaded selection must be combined, expected [2], got %v", ids)
+	}
+
+	// Move the selected point keeping the number of the points
+	err = c.cmd.editor.move(journalEntry{name: "test"}, func(i int, v mat.Vec3) (mat.Vec3, bool) {
+		return v.Add(mat.Vec3{1, 0, 0}), i == 2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.cmd.setPointCloudUpdated()
+	if _, err := c.Run("sel_load points", noUpdate); err == nil {
+		t.Error("Expected error on the modified points")
+	}
+	run("undo")
+	run("sel_load points")
+
+	run("sel_delete points")
+	if _, err := c.Run("sel_load points", noUpdate); err == nil {
+		t.Error("Expected error on deleted selection")
+	}
+
+	if err := c.cmd.ImportSelections(b); err != nil {
+		t.Fatal(err)
+	}
+	c.cmd.Delete()
+	if _, err := c.Run("sel_load points", noUpdate); err == nil {
+		t.Error("Expected error on the cloud of different number of points")
+	}
+
+	for name, in := range map[string]string{
+		"InvalidJSON":    `{`,
+		"EmptyName":      `{"": {"cursors": [[0, 0, 0]]}}`,
+		"TooManyCursors": `{"a": {"cursors": [[0, 0, 0], [0, 0, 0], [0, 0, 0], [0, 0, 0], [0, 0, 0]]}}`,
+		"OutOfRange":     `{"a": {"points": 3, "indices": [[2, 4]], "hash": "0"}}`,
+		"NoHash":         `{"a": {"points": 3, "indices": [[1, 2]]}}`,
+	} {
+		if err := c.cmd.ImportSelections([]byte(in)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"math"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+	"github.com/seqsense/pcgol/pc/storage/kdtree"
+)
+
+const (
+	defaultOutlierSORNeighbors    = 8
+	defaultOutlierSORStddev       = 1.0
+	defaultOutlierRadius          = 0.2
+	defaultOutlierRadiusNeighbors = 2
+)
+
+// sorOutliers returns true for the points whose mean distance to k nearest neighbors
+// is larger than the average of the mean distances plus stddev times its standard deviation.
+func sorOutliers(ra pc.Vec3RandomAccessor, k int, stddev float32) []bool {
+	kdt := kdtree.New(ra)
+	n := ra.Len()
+	dists := make([]float64, n)
+	valid := make([]bool, n)
+	var sum, sumSq float64
+	var cnt int
+	for i := 0; i < n; i++ {
+		var d float64
+		var m int
+		for _, nb := range kdt.KNN(ra.Vec3At(i), k+1, math.MaxFloat32) {
+			if nb.ID == i {
+				continue
+			}
+			if m == k {
+				break
+			}
+			d += math.Sqrt(float64(nb.DistSq))
+			m++
+		}
+		if m == 0 {
+			continue
+		}
+		d /= float64(m)
+		dists[i], valid[i] = d, true
+		sum += d
+		sumSq += d * d
+		cnt++
+	}
+
+	out := make([]bool, n)
+	if cnt < 2 {
+		return out
+	}
+	mean := sum / float64(cnt)
+	variance := (sumSq - sum*mean) / float64(cnt-1)
+	th := mean + float64(stddev)*math.Sqrt(math.Max(variance, 0))
+	for i := range out {
+		out[i] = valid[i] && dists[i] > th
+	}
+	return out
+}
+
+// radiusOutliers returns true for the points having less than minNeighbors
+// other points within the radius.
+func radiusOutliers(ra pc.Vec3RandomAccessor, radius float32, minNeighbors int) []bool {
+	kdt := kdtree.New(ra)
+	n := ra.Len()
+	out := make([]bool, n)
+	for i := 0; i < n; i++ {
+		var m int
+		for _, nb := range kdt.Range(ra.Vec3At(i), radius) {
+			if nb.ID != i {
+				m++
+			}
+		}
+		out[i] = m < minNeighbors
+	}
+	return out
+}
+
+// filterOutliers detects the outliers in the selected points, or the whole cloud if nothing is selected,
+// and deletes them or sets the label if label is not nil.
+// It returns the number of the outliers.
+func (c *commandContext) filterOutliers(j journalEntry, label *uint32, detect func(pc.Vec3RandomAccessor) []bool) (int, error) {
+	if c.editor.pp == nil {
+		return 0, errors.New("no pointcloud")
+	}
+	var filter func(int, mat.Vec3) bool
+	switch c.SelectMode() {
+	case selectModeRect:
+		if _, ok := c.SelectMatrix(); ok {
+			filter = c.baseFilter(true)
+		}
+	case selectModeMask:
+		filter = c.baseFilterByMask(true)
+	default:
+		return 0, errors.New("outlier removal is not supported in insert mode")
+	}
+	if filter != nil {
+		if err := c.checkSelectMask(); err != nil {
+			return 0, err
+		}
+	}
+
+	it, err := c.editor.pp.Vec3Iterator()
+	if err != nil {
+		return 0, err
+	}
+	var ra pc.Vec3RandomAccessor = it
+	var indice []int
+	if filter != nil {
+		for i := 0; i < c.editor.pp.Points; i++ {
+			if filter(i, it.Vec3At(i)) {
+				indice = append(indice, i)
+			}
+		}
+		ra = pc.NewIndiceVec3RandomAccessor(it, indice)
+	}
+
+	outliers := make([]bool, c.editor.pp.Points)
+	var n int
+	for i, o := range detect(ra) {
+		if !o {
+			continue
+		}
+		if indice != nil {
+			i = indice[i]
+		}
+		outliers[i] = true
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	if label != nil {
+		if err := c.editor.label(j, func(i int, _ mat.Vec3) (uint32, bool) {
+			return *label, outliers[i]
+		}); err != nil {
+			return 0, err
+		}
+	} else {
+		if err := c.editor.passThrough(j, func(i int, _ mat.Vec3) bool {
+			return !outliers[i]
+		}); err != nil {
+			return 0, err
+		}
+		// indices are changed
+		if c.selectMode == selectModeMask {
+			c.clearMaskSelection()
+		}
+		c.hasMaskSelection = false
+	}
+	c.setPointCloudUpdated()
+	return n, nil
+}
+
+// RemoveOutliersSOR removes the outliers by the statistical outlier removal.
+// Outliers are labeled instead of deleted if label is not nil.
+func (c *commandContext) RemoveOutliersSOR(k int, stddev float32, label *uint32) (int, error) {
+	if k < 1 {
+		return 0, errors.New("number of the neighbors must be positive")
+	}
+	params := []float32{float32(k), stddev}
+	if label != nil {
+		params = append(params, float32(*label))
+	}
+	return c.filterOutliers(c.newJournal("outlier_sor", params...), label, func(ra pc.Vec3RandomAccessor) []bool {
+		return sorOutliers(ra, k, stddev)
+	})
+}
+
+// RemoveOutliersRadius removes the points having less than minNeighbors neighbors within the radius.
+// Outliers are labeled instead of deleted if label is not nil.
+func (c *commandContext) RemoveOutliersRadius(radius float32, minNeighbors int, label *uint32) (int, error) {
+	if radius <= 0 {
+		return 0, errors.New("radius must be positive")
+	}
+	params := []float32{radius, float32(minNeighbors)}
+	if label != nil {
+		params = append(params, float32(*label))
+	}
+	return c.filterOutliers(c.newJournal("outlier_radius", params...), label, func(ra pc.Vec3RandomAccessor) []bool {
+		return radiusOutliers(ra, radius, minNeighbors)
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+// outlierTestCloud returns 3x3 grid points of 0.1m interval and an isolated point.
+func outlierTestCloud() []mat.Vec3 {
+	var vs []mat.Vec3
+	for x := 0; x < 3; x++ {
+		for y := 0; y < 3; y++ {
+			vs = append(vs, mat.Vec3{float32(x) * 0.1, float32(y) * 0.1, 0})
+		}
+	}
+	return append(vs, mat.Vec3{5, 5, 0})
+}
+
+func TestSOROutliers(t *testing.T) {
+	pp := createXYZCloud(t, outlierTestCloud()...)
+	vt, err := pp.Vec3Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	outliers := sorOutliers(vt, 3, 1)
+	expected := make([]bool, 10)
+	expected[9] = true
+	if !reflect.DeepEqual(expected, outliers) {
+		t.Errorf("Expected %v, got %v", expected, outliers)
+	}
+}
+
+func TestRadiusOutliers(t *testing.T) {
+	pp := createXYZCloud(t, outlierTestCloud()...)
+	vt, err := pp.Vec3Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		radius       float32
+		minNeighbors int
+		expected     []int
+	}{
+		"Isolated": {radius: 0.15, minNeighbors: 2, expected: []int{9}},
+		// Corners have 3 neighbors and edges have 5 neighbors within 0.15m
+		"Corners": {radius: 0.15, minNeighbors: 4, expected: []int{0, 2, 6, 8, 9}},
+		"Zero":    {radius: 0.15, minNeighbors: 0, expected: nil},
+	}
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var ids []int
+			for i, o := range radiusOutliers(vt, tt.radius, tt.minNeighbors) {
+				if o {
+					ids = append(ids, i)
+				}
+			}
+			if !reflect.DeepEqual(tt.expected, ids) {
+				t.Errorf("Expected %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+}
+
+func TestRemoveOutliers(t *testing.T) {
+	vs := outlierTestCloud()
+
+	t.Run("Delete", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		res, err := c.Run("outlier_radius 0.15 2", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual([][]float32{{1}}, res) {
+			t.Errorf("Expected [[1]], got %v", res)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, vs[:9])
+
+		if !c.cmd.Undo() {
+			t.Fatal("Undo failed")
+		}
+		expectPointCloud(t, c.cmd.editor.pp, vs)
+	})
+	t.Run("Label", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		if _, err := c.Run("outlier_sor 3 1 7", noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, vs)
+		lt, err := c.cmd.editor.pp.Uint32Iterator("label")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range vs {
+			expected := uint32(0)
+			if i == 9 {
+				expected = 7
+			}
+			if l := lt.Uint32At(i); l != expected {
+				t.Errorf("Expected label %d at %d, got %d", expected, i, l)
+			}
+		}
+	})
+	t.Run("Selection", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		// Select the first row (x = 0) and the isolated point
+		c.cmd.SetSelectMask(make([]uint32, len(vs)))
+		if _, err := c.Run("select_where x < 0.05 or x > 1", noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		// Points in the selection have 1 neighbor (row end) or 2 neighbors (row center) within 0.15m
+		if _, err := c.Run("outlier_radius 0.15 2", noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, []mat.Vec3{
+			vs[1], vs[3], vs[4], vs[5], vs[6], vs[7], vs[8],
+		})
+		if c.cmd.SelectMode() != selectModeRect {
+			t.Error("Mask selection must be cleared after deleting")
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/seqsense/pcdeditor/lzf"
+	"github.com/seqsense/pcgol/pc"
+)
+
+var pcdEncodings = []string{"ascii", "binary", "binary_compressed"}
+
+// marshalPCD writes the cloud as PCD in the data encoding (binary if empty).
+// precision is the number of significant digits of floats in ascii,
+// or 0 for the shortest representation.
+func marshalPCD(pp *pc.PointCloud, w io.Writer, encoding string, precision int) error {
+	if encoding == "" {
+		encoding = "binary"
+	}
+	if indexOf(pcdEncodings, encoding) < 0 {
+		return fmt.Errorf("unsupported PCD encoding %q", encoding)
+	}
+	width, height := pp.Width, pp.Height
+	if width*height != pp.Points {
+		width, height = pp.Points, 1
+	}
+	vp := []float32{0, 0, 0, 1, 0, 0, 0}
+	if len(pp.Viewpoint) == 7 {
+		vp = pp.Viewpoint
+	}
+	joinInts := func(a []int) string {
+		s := make([]string, len(a))
+		for i, v := range a {
+			s[i] = strconv.Itoa(v)
+		}
+		return strings.Join(s, " ")
+	}
+	vps := make([]string, len(vp))
+	for i, v := range vp {
+		vps[i] = strconv.FormatFloat(float64(v), 'g', -1, 32)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# .PCD v0.7 - Point Cloud Data file format\nVERSION 0.7\n")
+	fmt.Fprintf(bw, "FIELDS %s\n", strings.Join(pp.Fields, " "))
+	fmt.Fprintf(bw, "SIZE %s\n", joinInts(pp.Size))
+	fmt.Fprintf(bw, "TYPE %s\n", strings.Join(pp.Type, " "))
+	fmt.Fprintf(bw, "COUNT %s\n", joinInts(pp.Count))
+	fmt.Fprintf(bw, "WIDTH %d\nHEIGHT %d\n", width, height)
+	fmt.Fprintf(bw, "VIEWPOINT %s\n", strings.Join(vps, " "))
+	fmt.Fprintf(bw, "POINTS %d\nDATA %s\n", pp.Points, encoding)
+
+	stride := pp.Stride()
+	data := pp.Data[:pp.Points*stride]
+	switch encoding {
+	case "binary":
+		if _, err := bw.Write(data); err != nil {
+			return err
+		}
+	case "binary_compressed":
+		// Values are stored field by field before compression
+		soa := make([]byte, 0, len(data))
+		for i := range pp.Fields {
+			off, _ := fieldOffsetAt(&pp.PointCloudHeader, i)
+			size := pp.Size[i] * pp.Count[i]
+			for j := 0; j < pp.Points; j++ {
+				soa = append(soa, data[j*stride+off:j*stride+off+size]...)
+			}
+		}
+		compressed := lzf.Compress(soa)
+		var sizes [8]byte
+		binary.LittleEndian.PutUint32(sizes[0:], uint32(len(compressed)))
+		binary.LittleEndian.PutUint32(sizes[4:], uint32(len(soa)))
+		bw.Write(sizes[:])
+		if _, err := bw.Write(compressed); err != nil {
+			return err
+		}
+	case "ascii":
+		var buf []byte
+		for j := 0; j < pp.Points; j++ {
+			p := data[j*stride:]
+			buf = buf[:0]
+			var off int
+			for i := range pp.Fields {
+				for k := 0; k < pp.Count[i]; k++ {
+					if len(buf) > 0 {
+						buf = append(buf, ' ')
+					}
+					buf = appendNumber(buf, p[off:], pp.Type[i], pp.Size[i], precision)
+					off += pp.Size[i]
+				}
+			}
+			buf = append(buf, '\n')
+			if _, err := bw.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
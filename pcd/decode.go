@@ -0,0 +1,365 @@
+// Package pcd implements the chunked PCD decoder reporting the progress.
+package pcd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/seqsense/pcdeditor/lzf"
+	"github.com/seqsense/pcgol/pc"
+)
+
+var (
+	// ErrHeader is returned if the PCD header is broken.
+	ErrHeader = errors.New("invalid PCD header")
+	// ErrTooLarge is returned if the point data exceeds the memory budget.
+	ErrTooLarge = errors.New("point cloud exceeds the memory budget")
+)
+
+// DefaultChunkPoints is the default number of points decoded at once.
+const DefaultChunkPoints = 1 << 16
+
+// Options is the options of Decode.
+type Options struct {
+	// MaxBytes is the memory budget of the point data.
+	// Decode fails before allocating the data if POINTS exceeds it.
+	// 0 means unlimited.
+	MaxBytes int
+	// ChunkPoints is the number of points decoded at once.
+	// DefaultChunkPoints is used if 0.
+	ChunkPoints int
+	// Progress is called after decoding each chunk if not nil.
+	Progress func(loaded, total int)
+}
+
+// Header is the PCD header.
+type Header struct {
+	pc.PointCloudHeader
+	Points int
+	Data   string // ascii, binary or binary_compressed
+}
+
+// Decode decodes the PCD in chunks.
+// Decoding is aborted and ctx.Err() is returned if ctx is canceled.
+func Decode(ctx context.Context, r io.Reader, opts Options) (*pc.PointCloud, error) {
+	br := bufio.NewReader(r)
+	h, err := ReadHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	stride := h.Stride()
+	if stride == 0 {
+		return nil, ErrHeader
+	}
+	if opts.MaxBytes > 0 && h.Points > opts.MaxBytes/stride {
+		return nil, fmt.Errorf("%w: %d points require %d bytes but the budget is %d bytes",
+			ErrTooLarge, h.Points, int64(h.Points)*int64(stride), opts.MaxBytes)
+	}
+	if opts.ChunkPoints <= 0 {
+		opts.ChunkPoints = DefaultChunkPoints
+	}
+	if opts.Progress == nil {
+		opts.Progress = func(int, int) {}
+	}
+
+	pp := &pc.PointCloud{
+		PointCloudHeader: h.PointCloudHeader,
+		Points:           h.Points,
+		Data:             make([]byte, h.Points*stride),
+	}
+	switch h.Data {
+	case "binary":
+		err = decodeBinary(ctx, br, pp, opts)
+	case "ascii":
+		err = decodeASCII(ctx, br, pp, opts)
+	case "binary_compressed":
+		err = decodeBinaryCompressed(ctx, br, pp, opts)
+	default:
+		err = fmt.Errorf("unsupported DATA type %s", h.Data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pp, nil
+}
+
+// ReadHeader reads the PCD header until DATA line.
+func ReadHeader(br *bufio.Reader) (*Header, error) {
+	h := &Header{Points: -1}
+	h.Viewpoint = []float32{0, 0, 0, 1, 0, 0, 0}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("%w: no DATA line", ErrHeader)
+			}
+			return nil, err
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 || strings.HasPrefix(f[0], "#") {
+			continue
+		}
+		args := f[1:]
+		switch f[0] {
+		case "VERSION":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+			}
+			v, err := strconv.ParseFloat(args[0], 32)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+			}
+			h.Version = float32(v)
+		case "FIELDS":
+			h.Fields = args
+		case "SIZE":
+			if h.Size, err = parseInts(args); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+			}
+		case "TYPE":
+			h.Type = args
+		case "COUNT":
+			if h.Count, err = parseInts(args); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+			}
+		case "WIDTH", "HEIGHT", "POINTS":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+			}
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+			}
+			switch f[0] {
+			case "WIDTH":
+				h.Width = n
+			case "HEIGHT":
+				h.Height = n
+			default:
+				h.Points = n
+			}
+		case "VIEWPOINT":
+			if len(args) != 7 {
+				return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+			}
+			for i, s := range args {
+				v, err := strconv.ParseFloat(s, 32)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+				}
+				h.Viewpoint[i] = float32(v)
+			}
+		case "DATA":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("%w: %s", ErrHeader, line)
+			}
+			h.Data = args[0]
+			return h, h.validate()
+		}
+	}
+}
+
+func (h *Header) validate() error {
+	if h.Count == nil {
+		h.Count = make([]int, len(h.Fields))
+		for i := range h.Count {
+			h.Count[i] = 1
+		}
+	}
+	n := len(h.Fields)
+	if n == 0 || len(h.Size) != n || len(h.Type) != n || len(h.Count) != n {
+		return fmt.Errorf("%w: number of FIELDS, SIZE, TYPE and COUNT must be same", ErrHeader)
+	}
+	for i := range h.Fields {
+		if !isValidType(h.Type[i], h.Size[i]) || h.Count[i] <= 0 {
+			return fmt.Errorf("%w: unsupported field %s (TYPE %s, SIZE %d, COUNT %d)",
+				ErrHeader, h.Fields[i], h.Type[i], h.Size[i], h.Count[i])
+		}
+	}
+	if h.Points < 0 {
+		h.Points = h.Width * h.Height
+	}
+	return nil
+}
+
+func parseInts(s []string) ([]int, error) {
+	out := make([]int, len(s))
+	for i := range s {
+		var err error
+		if out[i], err = strconv.Atoi(s[i]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func isValidType(t string, size int) bool {
+	switch t {
+	case "U", "I":
+		return size == 1 || size == 2 || size == 4 || size == 8
+	case "F":
+		return size == 4 || size == 8
+	}
+	return false
+}
+
+func decodeBinary(ctx context.Context, r io.Reader, pp *pc.PointCloud, opts Options) error {
+	stride := pp.Stride()
+	for i := 0; i < pp.Points; i += opts.ChunkPoints {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(opts.ChunkPoints, pp.Points-i)
+		if _, err := io.ReadFull(r, pp.Data[i*stride:(i+n)*stride]); err != nil {
+			return err
+		}
+		opts.Progress(i+n, pp.Points)
+	}
+	return nil
+}
+
+func decodeASCII(ctx context.Context, br *bufio.Reader, pp *pc.PointCloud, opts Options) error {
+	type value struct {
+		typ  string
+		size int
+	}
+	var values []value
+	for i := range pp.Fields {
+		for k := 0; k < pp.Count[i]; k++ {
+			values = append(values, value{pp.Type[i], pp.Size[i]})
+		}
+	}
+	stride := pp.Stride()
+	for i := 0; i < pp.Points; i++ {
+		if i%opts.ChunkPoints == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if i > 0 {
+				opts.Progress(i, pp.Points)
+			}
+		}
+		line, err := br.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		tokens := strings.Fields(line)
+		if len(tokens) < len(values) {
+			return fmt.Errorf("point %d: %d values are required but got %d", i, len(values), len(tokens))
+		}
+		p := pp.Data[i*stride:]
+		for k, v := range values {
+			if err := putASCII(p, v.typ, v.size, tokens[k]); err != nil {
+				return fmt.Errorf("point %d: %w", i, err)
+			}
+			p = p[v.size:]
+		}
+	}
+	opts.Progress(pp.Points, pp.Points)
+	return nil
+}
+
+func decodeBinaryCompressed(ctx context.Context, r io.Reader, pp *pc.PointCloud, opts Options) error {
+	var sizes [8]byte
+	if _, err := io.ReadFull(r, sizes[:]); err != nil {
+		return err
+	}
+	compressedSize := int(binary.LittleEndian.Uint32(sizes[0:]))
+	size := int(binary.LittleEndian.Uint32(sizes[4:]))
+	if size != len(pp.Data) {
+		return fmt.Errorf("uncompressed size %d doesn't match POINTS (%d bytes)", size, len(pp.Data))
+	}
+	if opts.MaxBytes > 0 && compressedSize > opts.MaxBytes {
+		return ErrTooLarge
+	}
+
+	// Progress is reported by the ratio of the read compressed data
+	compressed := make([]byte, compressedSize)
+	chunk := opts.ChunkPoints * pp.Stride()
+	for pos := 0; pos < compressedSize; pos += chunk {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(chunk, compressedSize-pos)
+		if _, err := io.ReadFull(r, compressed[pos:pos+n]); err != nil {
+			return err
+		}
+		if pos+n < compressedSize {
+			opts.Progress(int(int64(pp.Points)*int64(pos+n)/int64(compressedSize)), pp.Points)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	soa, err := lzf.Decompress(compressed, size)
+	if err != nil {
+		return err
+	}
+
+	// Values are stored field by field
+	stride := pp.Stride()
+	var src, off int
+	for i := range pp.Fields {
+		n := pp.Size[i] * pp.Count[i]
+		for j := 0; j < pp.Points; j++ {
+			copy(pp.Data[j*stride+off:j*stride+off+n], soa[src:src+n])
+			src += n
+		}
+		off += n
+	}
+	opts.Progress(pp.Points, pp.Points)
+	return nil
+}
+
+func putASCII(b []byte, typ string, size int, s string) error {
+	switch typ {
+	case "F":
+		v, err := strconv.ParseFloat(s, size*8)
+		if err != nil {
+			return err
+		}
+		if size == 4 {
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(v)))
+		} else {
+			binary.LittleEndian.PutUint64(b, math.Float64bits(v))
+		}
+		return nil
+	case "I":
+		v, err := strconv.ParseInt(s, 10, size*8)
+		if err != nil {
+			return err
+		}
+		putUint(b, size, uint64(v))
+		return nil
+	default:
+		v, err := strconv.ParseUint(s, 10, size*8)
+		if err != nil {
+			return err
+		}
+		putUint(b, size, v)
+		return nil
+	}
+}
+
+func putUint(b []byte, size int, v uint64) {
+	switch size {
+	case 1:
+		b[0] = byte(v)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(v))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	default:
+		binary.LittleEndian.PutUint64(b, v)
+	}
+}
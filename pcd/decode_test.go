@@ -0,0 +1,178 @@
+package pcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/seqsense/pcdeditor/lzf"
+	"github.com/seqsense/pcgol/pc"
+)
+
+const testHeader = `# .PCD v0.7 - Point Cloud Data file format
+VERSION 0.7
+FIELDS x y z label
+SIZE 4 4 4 4
+TYPE F F F U
+COUNT 1 1 1 1
+WIDTH 5
+HEIGHT 1
+VIEWPOINT 1 2 3 1 0 0 0
+POINTS 5
+`
+
+func testCloud() *pc.PointCloud {
+	pp := &pc.PointCloud{
+		PointCloudHeader: pc.PointCloudHeader{
+			Version:   0.7,
+			Fields:    []string{"x", "y", "z", "label"},
+			Size:      []int{4, 4, 4, 4},
+			Type:      []string{"F", "F", "F", "U"},
+			Count:     []int{1, 1, 1, 1},
+			Width:     5,
+			Height:    1,
+			Viewpoint: []float32{1, 2, 3, 1, 0, 0, 0},
+		},
+		Points: 5,
+		Data:   make([]byte, 5*16),
+	}
+	for i := 0; i < 5; i++ {
+		p := pp.Data[i*16:]
+		binary.LittleEndian.PutUint32(p[0:], math.Float32bits(float32(i)+0.5))
+		binary.LittleEndian.PutUint32(p[4:], math.Float32bits(-float32(i)))
+		binary.LittleEndian.PutUint32(p[8:], math.Float32bits(10))
+		binary.LittleEndian.PutUint32(p[12:], uint32(i*100))
+	}
+	return pp
+}
+
+func testFiles() map[string][]byte {
+	pp := testCloud()
+
+	ascii := testHeader + "DATA ascii\n"
+	for i := 0; i < 5; i++ {
+		ascii += strings.Join([]string{
+			strconv.FormatFloat(float64(i)+0.5, 'g', -1, 32),
+			strconv.FormatFloat(-float64(i), 'g', -1, 32),
+			"10",
+			strconv.Itoa(i * 100),
+		}, " ") + "\n"
+	}
+
+	soa := make([]byte, 0, len(pp.Data))
+	for f := 0; f < 4; f++ {
+		for i := 0; i < 5; i++ {
+			soa = append(soa, pp.Data[i*16+f*4:i*16+f*4+4]...)
+		}
+	}
+	compressed := lzf.Compress(soa)
+	var sizes [8]byte
+	binary.LittleEndian.PutUint32(sizes[0:], uint32(len(compressed)))
+	binary.LittleEndian.PutUint32(sizes[4:], uint32(len(soa)))
+
+	return map[string][]byte{
+		"Binary": append([]byte(testHeader+"DATA binary\n"), pp.Data...),
+		"ASCII":  []byte(ascii),
+		"BinaryCompressed": append(
+			append([]byte(testHeader+"DATA binary_compressed\n"), sizes[:]...),
+			compressed...,
+		),
+	}
+}
+
+func TestDecode(t *testing.T) {
+	expected := testCloud()
+	for name, b := range testFiles() {
+		b := b
+		t.Run(name, func(t *testing.T) {
+			var progress [][2]int
+			pp, err := Decode(context.Background(), bytes.NewReader(b), Options{
+				ChunkPoints: 2,
+				Progress: func(loaded, total int) {
+					progress = append(progress, [2]int{loaded, total})
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(expected.PointCloudHeader, pp.PointCloudHeader) {
+				t.Fatalf("Expected header:\n%+v\nGot:\n%+v", expected.PointCloudHeader, pp.PointCloudHeader)
+			}
+			if !bytes.Equal(expected.Data, pp.Data) {
+				t.Errorf("Expected data:\n%v\nGot:\n%v", expected.Data, pp.Data)
+			}
+			if len(progress) == 0 || progress[len(progress)-1] != [2]int{5, 5} {
+				t.Fatalf("Progress must be finished by 5/5, got %v", progress)
+			}
+			for i := 1; i < len(progress); i++ {
+				if progress[i][0] < progress[i-1][0] {
+					t.Errorf("Progress must be increased, got %v", progress)
+				}
+			}
+		})
+	}
+}
+
+func TestDecode_Cancel(t *testing.T) {
+	for name, b := range testFiles() {
+		b := b
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			_, err := Decode(ctx, bytes.NewReader(b), Options{
+				ChunkPoints: 1,
+				Progress: func(loaded, total int) {
+					cancel()
+				},
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Expected %v, got %v", context.Canceled, err)
+			}
+		})
+	}
+}
+
+func TestDecode_MaxBytes(t *testing.T) {
+	// Only the header is given to ensure that the budget is checked before reading data
+	header := testHeader + "DATA binary\n"
+	_, err := Decode(context.Background(), strings.NewReader(header), Options{MaxBytes: 79})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected %v, got %v", ErrTooLarge, err)
+	}
+
+	huge := strings.Replace(header, "POINTS 5", "POINTS 9223372036854775807", 1)
+	_, err = Decode(context.Background(), strings.NewReader(huge), Options{MaxBytes: 1 << 30})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected %v, got %v", ErrTooLarge, err)
+	}
+
+	b := append([]byte(header), testCloud().Data...)
+	if _, err := Decode(context.Background(), bytes.NewReader(b), Options{MaxBytes: 80}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+}
+
+func TestReadHeader_Error(t *testing.T) {
+	testCases := map[string]string{
+		"NoData":        "FIELDS x\nSIZE 4\nTYPE F\nPOINTS 1\n",
+		"SizeMismatch":  "FIELDS x y\nSIZE 4\nTYPE F F\nPOINTS 1\nDATA binary\n",
+		"InvalidType":   "FIELDS x\nSIZE 3\nTYPE F\nPOINTS 1\nDATA binary\n",
+		"InvalidPoints": "FIELDS x\nSIZE 4\nTYPE F\nPOINTS -1\nDATA binary\n",
+		"InvalidView":   "FIELDS x\nSIZE 4\nTYPE F\nVIEWPOINT 0 0 0\nDATA binary\n",
+	}
+	for name, h := range testCases {
+		h := h
+		t.Run(name, func(t *testing.T) {
+			_, err := Decode(context.Background(), strings.NewReader(h), Options{})
+			if !errors.Is(err, ErrHeader) {
+				t.Errorf("Expected %v, got %v", ErrHeader, err)
+			}
+		})
+	}
+}
@@ -7,18 +7,17 @@ import (
 	"github.com/seqsense/pcgol/pc"
 )
 
+// blobChunkSize is the size of the chunk to load the point cloud file.
+const blobChunkSize = 16 << 20
+
 type pcdIOImpl struct{}
 
-func (*pcdIOImpl) importPCD(b interface{}) (*pc.PointCloud, error) {
+func (*pcdIOImpl) importPCD(b interface{}, opts formatOptions) (*pc.PointCloud, error) {
 	bj, err := blob.JS(b)
 	if err != nil {
 		return nil, err
 	}
-	r, err := bj.Reader()
-	if err != nil {
-		return nil, err
-	}
-	pp, err := pc.Unmarshal(r)
+	pp, err := unmarshalPointCloud(bj.ChunkReader(blobChunkSize), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -26,10 +25,10 @@ func (*pcdIOImpl) importPCD(b interface{}) (*pc.PointCloud, error) {
 	return pp, nil
 }
 
-func (*pcdIOImpl) exportPCD(pp *pc.PointCloud) (interface{}, error) {
+func (*pcdIOImpl) exportPCD(pp *pc.PointCloud, opts formatOptions) (interface{}, error) {
 	var buf bytes.Buffer
-	if err := pc.Marshal(pp, &buf); err != nil {
+	if err := marshalPointCloud(pp, &buf, opts); err != nil {
 		return nil, err
 	}
-	return blob.New(buf.Bytes(), "application/x-pcd").JS(), nil
+	return blob.New(buf.Bytes(), opts.format.mimeType()).JS(), nil
 }
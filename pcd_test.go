@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seqsense/pcdeditor/lzf"
+	"github.com/seqsense/pcgol/pc"
+)
+
+func TestMarshalPCD(t *testing.T) {
+	for _, encoding := range []string{"", "binary", "ascii"} {
+		encoding := encoding
+		t.Run("RoundTrip_"+encoding, func(t *testing.T) {
+			pp := createLASTestCloud(t, []uint32{0, 2, 300})
+			var buf bytes.Buffer
+			if err := marshalPointCloud(pp, &buf, formatOptions{format: formatPCD, encoding: encoding}); err != nil {
+				t.Fatal(err)
+			}
+			out, err := pc.Unmarshal(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameFields(&pp.PointCloudHeader, &out.PointCloudHeader) ||
+				pp.Width != out.Width || pp.Height != out.Height ||
+				!reflect.DeepEqual(pp.Viewpoint, out.Viewpoint) {
+				t.Fatalf("Expected header:\n%+v\nGot:\n%+v", pp.PointCloudHeader, out.PointCloudHeader)
+			}
+			if !bytes.Equal(pp.Data, out.Data) {
+				t.Errorf("Expected data:\n%v\nGot:\n%v", pp.Data, out.Data)
+			}
+		})
+	}
+
+	t.Run("BinaryCompressed", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{0, 2, 300, 4})
+		var buf bytes.Buffer
+		if err := marshalPointCloud(pp, &buf, formatOptions{encoding: "binary_compressed"}); err != nil {
+			t.Fatal(err)
+		}
+		br := bufio.NewReader(&buf)
+		for {
+			l, err := br.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasPrefix(l, "DATA") {
+				if l != "DATA binary_compressed\n" {
+					t.Fatalf("Unexpected DATA line %q", l)
+				}
+				break
+			}
+		}
+		var sizes [8]byte
+		if _, err := io.ReadFull(br, sizes[:]); err != nil {
+			t.Fatal(err)
+		}
+		compressed := make([]byte, binary.LittleEndian.Uint32(sizes[0:]))
+		if _, err := io.ReadFull(br, compressed); err != nil {
+			t.Fatal(err)
+		}
+		soa, err := lzf.Decompress(compressed, int(binary.LittleEndian.Uint32(sizes[4:])))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Restore the point-major layout
+		stride := pp.Stride()
+		data := make([]byte, len(soa))
+		var pos int
+		for i := range pp.Fields {
+			off, _ := fieldOffsetAt(&pp.PointCloudHeader, i)
+			size := pp.Size[i] * pp.Count[i]
+			for j := 0; j < pp.Points; j++ {
+				copy(data[j*stride+off:], soa[pos:pos+size])
+				pos += size
+			}
+		}
+		if !bytes.Equal(pp.Data, data) {
+			t.Errorf("Expected data:\n%v\nGot:\n%v", pp.Data, data)
+		}
+	})
+
+	t.Run("Precision", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{1})
+		var buf bytes.Buffer
+		opts := formatOptions{encoding: "ascii", precision: 2, fields: []string{"x", "y", "label"}}
+		if err := marshalPointCloud(pp, &buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		s := buf.String()
+		if !strings.Contains(s, "\nFIELDS x y label\n") {
+			t.Errorf("Fields must be extracted:\n%s", s)
+		}
+		if !strings.HasSuffix(s, "\n0.12 -1 1\n") {
+			t.Errorf("Values must be written in 2 digits:\n%s", s)
+		}
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{5, 6})
+		vp := []float32{1, 2, 3, 0, 0, 0, 1}
+		var buf bytes.Buffer
+		opts := formatOptions{fields: []string{"label", "x", "y", "z"}, viewpoint: vp}
+		if err := marshalPointCloud(pp, &buf, opts); err != nil {
+			t.Fatal(err)
+		}
+		if len(pp.Fields) != 9 || pp.Viewpoint[3] != 1 {
+			t.Fatal("Original cloud must not be modified")
+		}
+		out, err := pc.Unmarshal(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(opts.fields, out.Fields) {
+			t.Errorf("Expected fields %v, got %v", opts.fields, out.Fields)
+		}
+		if !reflect.DeepEqual(vp, out.Viewpoint) {
+			t.Errorf("Expected viewpoint %v, got %v", vp, out.Viewpoint)
+		}
+		for i := 0; i < 2; i++ {
+			p := out.Data[i*out.Stride():]
+			if l := binary.LittleEndian.Uint32(p); l != uint32(5+i) {
+				t.Errorf("Expected label %d, got %d", 5+i, l)
+			}
+			if !bytes.Equal(p[4:16], pp.Data[i*pp.Stride():i*pp.Stride()+12]) {
+				t.Errorf("Expected xyz %v, got %v", pp.Data[i*pp.Stride():i*pp.Stride()+12], p[4:16])
+			}
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{1})
+		testCases := map[string]formatOptions{
+			"UnknownEncoding":  {encoding: "gzip"},
+			"UnknownField":     {fields: []string{"x", "foo"}},
+			"DuplicatedField":  {fields: []string{"x", "x"}},
+			"InvalidViewpoint": {viewpoint: []float32{0, 0, 0}},
+			"PLYCompressed":    {format: formatPLY, encoding: "binary_compressed"},
+		}
+		for name, opts := range testCases {
+			if err := marshalPointCloud(pp, &bytes.Buffer{}, opts); err == nil {
+				t.Errorf("%s: expected error", name)
+			}
+		}
+	})
+}
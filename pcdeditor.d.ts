@@ -7,13 +7,45 @@ interface PCDEditorOptions {
   onKeyDownHook?: (KeyboardEvent) => void
 }
 
+type PointCloudFormat = 'auto' | 'pcd' | 'las' | 'ply' | 'xyz' | 'csv'
+
+interface PointCloudFormatOptions {
+  format?: PointCloudFormat
+  // Field names of the text columns ('_' to ignore)
+  columns?: string[] | string
+  delimiter?: string
+  skipRows?: number
+  // Called during loading with the number of loaded points
+  onProgress?: (loaded: number, total: number) => void
+  // Cancels loading when aborted
+  signal?: AbortSignal
+  // Memory budget of the point data in bytes (default: 1.5GiB)
+  maxBytes?: number
+  // Data encoding of the exported file (binary_compressed is available for PCD)
+  encoding?: 'ascii' | 'binary' | 'binary_compressed'
+  // Fields to be exported
+  fields?: string[] | string
+  // Significant digits of floats in text encodings
+  precision?: number
+  // tx ty tz qw qx qy qz
+  viewpoint?: number[]
+}
+
+interface ExportedTile {
+  // Path in the tile index (extension is replaced if exported in the other format)
+  path: string
+  blob: Blob
+}
+
 declare class PCDEditor {
   constructor(opts: PCDEditorOptions)
   attach(): Promise<null>
   appendDefaultMenuboxTo(selector: string): void
-  loadPCD(path: string): Promise<null>
-  loadSubPCD(path: string): Promise<null>
+  loadPCD(path: string, format?: PointCloudFormat | PointCloudFormatOptions): Promise<null>
+  loadSubPCD(path: string, format?: PointCloudFormat | PointCloudFormatOptions): Promise<null>
+  loadTiles(indexPath: string): Promise<null>
   load2D(yamlPath: string, imgPath: string): Promise<null>
+  loadLabels(path: string): Promise<null>
 
   logger(any): void
   private qs: (q: string) => Element
@@ -21,12 +53,18 @@ declare class PCDEditor {
 
   pcdeditor: {
     reset(): Promise<string>
-    importPCD(a: Blob): Promise<string>
-    importSubPCD(a: Blob): Promise<string>
+    importPCD(a: Blob, format?: PointCloudFormat | PointCloudFormatOptions): Promise<string>
+    importSubPCD(a: Blob, format?: PointCloudFormat | PointCloudFormatOptions): Promise<string>
     import2D(a, b: Blob): Promise<string>
-    exportPCD(): Promise<Blob>
-    exportSelectedPCD(): Promise<Blob>
-    command(cmd: string): Promise<number[][]>
+    importLabels(a: Blob | string): Promise<string>
+    importSelections(a: Blob | string): Promise<string>
+    exportSelections(): Promise<string>
+    exportPCD(format?: PointCloudFormat | PointCloudFormatOptions): Promise<Blob>
+    exportSelectedPCD(format?: PointCloudFormat | PointCloudFormatOptions): Promise<Blob>
+    importTiles(index: Blob | string, fetchTile: (path: string) => Promise<Blob> | Blob): Promise<string>
+    exportTiles(format?: PointCloudFormat | PointCloudFormatOptions): Promise<ExportedTile[]>
+    command(cmd: string): Promise<number[][] | string[]>
+    run_script(script: string): Promise<Array<number[][] | string[]>>
     show2D(show: boolean): Promise<string>
     exit(): void
   }
@@ -37,7 +75,7 @@ declare class PCDEditor {
 
   log: HTMLDivElement
 
-  localClipboard: Blob
+  clipboardText: string
 }
 
 export default PCDEditor
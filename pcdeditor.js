@@ -18,7 +18,11 @@ class PCDEditor {
         if (e.ctrlKey) {
           switch (e.code) {
           case 'KeyC':
-            this.qs('#clipboardCopy').click()
+            if (e.shiftKey) {
+              this.qs('#clipboardCopyPCD').click()
+            } else {
+              this.qs('#clipboardCopy').click()
+            }
             break
           case 'KeyV':
             this.qs('#clipboardPaste').click()
@@ -43,7 +47,8 @@ class PCDEditor {
       }
     }
 
-    this.localClipboard = new Blob()
+    // Token written to the system clipboard to paste the points copied in this window
+    this.clipboardToken = `pcdeditor-clipboard:${Math.random().toString(36).slice(2)}`
   }
 
   wrapId(q) {
@@ -84,9 +89,10 @@ class PCDEditor {
       const setupControls = async (pcdeditor) => {
         this.qs('#exportPCD').onclick = async () => {
           try {
-            const blob = await pcdeditor.exportPCD()
+            const format = this.qs('#exportFormat').value
+            const blob = await pcdeditor.exportPCD(format)
             const a = document.createElement('a')
-            a.download = 'exported.pcd'
+            a.download = `exported.${format}`
             a.href = URL.createObjectURL(blob)
             a.dataset.downloadurl = [
               'application/octet-stream',
@@ -105,8 +111,12 @@ class PCDEditor {
               .then((res) => {
                 let str = ''
                 for (const vec of res) {
-                  for (const val of vec) {
-                    str += `${val.toFixed(3)} `
+                  if (typeof vec === 'string') {
+                    str += vec
+                  } else {
+                    for (const val of vec) {
+                      str += `${val.toFixed(3)} `
+                    }
                   }
                   str += '\n'
                 }
@@ -121,6 +131,39 @@ class PCDEditor {
           if (e.keyCode === 27) {
             this.canvas.focus()
           }
+          if (e.keyCode === 9) {
+            e.preventDefault()
+            const line = e.target.value
+            const quoted = line.replace(/\\/g, '\\\\').replace(/"/g, '\\"')
+            pcdeditor
+              .command(`complete "${quoted}"`)
+              .then(async (candidates) => {
+                if (candidates.length === 0) {
+                  return
+                }
+                let common = candidates[0]
+                for (const c of candidates) {
+                  while (!c.startsWith(common)) {
+                    common = common.slice(0, -1)
+                  }
+                }
+                const head = line.replace(/[^\s]*$/, '')
+                const word = line.slice(head.length)
+                if (common.length > word.length) {
+                  e.target.value = head + common
+                }
+                if (candidates.length === 1 && !common.endsWith('=')) {
+                  e.target.value += ' '
+                  if (head === '') {
+                    const usage = await pcdeditor.command(`help ${common}`)
+                    this.logger(usage.join('\n'))
+                  }
+                } else if (candidates.length > 1) {
+                  this.logger(candidates.join(' '))
+                }
+              })
+              .catch(this.logger)
+          }
         }
         this.qs('#show2D').onchange = (e) =>
           pcdeditor.show2D(e.target.checked).catch(this.logger)
@@ -155,6 +198,17 @@ class PCDEditor {
         pointSizeInput.onchange = (e) => onPointSizeChange(e.target)
         onPointSizeChange(pointSizeInput)
 
+        const colorModeSelect = this.qs('#colorMode')
+        colorModeSelect.onchange = async (e) => {
+          try {
+            await pcdeditor.command(`color_mode ${e.target.value}`)
+          } catch (err) {
+            this.logger(err)
+            const mode = await pcdeditor.command('color_mode')
+            colorModeSelect.value = mode[0]
+          }
+        }
+
         fovDecButton.onclick = () =>
           pcdeditor.command('fov -1').catch(this.logger)
         fovIncButton.onclick = () =>
@@ -224,6 +278,8 @@ class PCDEditor {
 
         this.qs('#undo').onclick = () =>
           pcdeditor.command('undo').catch(this.logger)
+        this.qs('#redo').onclick = () =>
+          pcdeditor.command('redo').catch(this.logger)
         this.qs('#createSurface').onclick = () => {
           const grid = surfaceGridInput.value
           pcdeditor.command(`add_surface ${grid}`).catch(this.logger)
@@ -248,18 +304,30 @@ class PCDEditor {
         this.qs('#clipboardCopy').onclick = async () => {
           this.canvas.focus()
           try {
-            const blob = await pcdeditor.exportSelectedPCD()
-            // Clipboard can't be used on insecure context
-            this.localClipboard = blob
+            // Points are kept in the editor to be pasted in this window
+            await pcdeditor.command('copy')
 
+            // Clipboard can't be used on insecure context
+            if (navigator?.clipboard?.writeText) {
+              await navigator.clipboard.writeText(this.clipboardToken)
+            }
+          } catch (e) {
+            this.logger(e)
+          }
+        }
+        this.qs('#clipboardCopyPCD').onclick = async () => {
+          this.canvas.focus()
+          try {
             if (!navigator?.clipboard?.writeText) {
-              this.logger('clipped data is available only in this window')
+              this.logger('clipboard is not available')
               return
             }
+            // Encoded to paste in the other windows
+            const blob = await pcdeditor.exportSelectedPCD()
             const fr = new FileReader()
             fr.onload = () => {
               navigator.clipboard.writeText(fr.result)
-                .catch(() => this.logger('clipped data is available only in this window'))
+                .catch(() => this.logger('failed to write clipboard'))
             }
             fr.onabort = () => {
               this.logger('failed to encode data')
@@ -272,12 +340,15 @@ class PCDEditor {
         this.qs('#clipboardPaste').onclick = async () => {
           this.canvas.focus()
           try {
-            if (!navigator?.clipboard?.readText) {
-              // Fallback to the local data
-              await this.loadSubPCD(URL.createObjectURL(this.localClipboard))
+            // Fallback to the points copied in this window
+            let text = this.clipboardToken
+            if (navigator?.clipboard?.readText) {
+              text = await navigator.clipboard.readText()
+            }
+            if (text === this.clipboardToken) {
+              await pcdeditor.command('paste')
               return
             }
-            const text = await navigator.clipboard.readText()
             if (text.startsWith('data:application/x-pcd;base64,')) {
               await this.loadSubPCD(text)
             }
@@ -370,7 +441,7 @@ class PCDEditor {
     })
   }
 
-  loadPCD(path) {
+  loadPCD(path, format) {
     return new Promise((resolve, reject) => {
       fetch(path, fetchOpts)
         .then((resp) => {
@@ -381,7 +452,7 @@ class PCDEditor {
           return resp.blob()
         })
         .then((blob) => {
-          return this.pcdeditor.importPCD(blob)
+          return this.pcdeditor.importPCD(blob, format)
         })
         .then(() => {
           resolve()
@@ -392,7 +463,7 @@ class PCDEditor {
     })
   }
 
-  loadSubPCD(path) {
+  loadSubPCD(path, format) {
     return new Promise((resolve, reject) => {
       fetch(path, fetchOpts)
         .then((resp) => {
@@ -403,7 +474,37 @@ class PCDEditor {
           return resp.blob()
         })
         .then((blob) => {
-          return this.pcdeditor.importSubPCD(blob)
+          return this.pcdeditor.importSubPCD(blob, format)
+        })
+        .then(() => {
+          resolve()
+        })
+        .catch((e) => {
+          reject(e)
+        })
+    })
+  }
+
+  loadTiles(indexPath) {
+    const base = new URL(indexPath, document.baseURI)
+    const fetchTile = async (path) => {
+      const resp = await fetch(new URL(path, base), fetchOpts)
+      if (!resp.ok) {
+        throw new Error(`failed to load tile ${path}: ${resp.statusText}`)
+      }
+      return resp.blob()
+    }
+    return new Promise((resolve, reject) => {
+      fetch(indexPath, fetchOpts)
+        .then((resp) => {
+          if (!resp.ok) {
+            reject(new Error(`failed to load tile index: ${resp.statusText}`))
+            return undefined
+          }
+          return resp.blob()
+        })
+        .then((blob) => {
+          return this.pcdeditor.importTiles(blob, fetchTile)
         })
         .then(() => {
           resolve()
@@ -442,6 +543,28 @@ class PCDEditor {
     })
   }
 
+  loadLabels(path) {
+    return new Promise((resolve, reject) => {
+      fetch(path, fetchOpts)
+        .then((resp) => {
+          if (!resp.ok) {
+            reject(new Error(`failed to load label table: ${resp.statusText}`))
+            return undefined
+          }
+          return resp.blob()
+        })
+        .then((blob) => {
+          return this.pcdeditor.importLabels(blob)
+        })
+        .then(() => {
+          resolve()
+        })
+        .catch((e) => {
+          reject(e)
+        })
+    })
+  }
+
   reset() {
     return this.pcdeditor.reset()
   }
@@ -626,7 +749,14 @@ class PCDEditor {
   }
 </style>
 <button id="${id('exportPCD')}">export</button>
-<input type="text" id="${id('command')}" placeholder="command" />
+<select id="${id('exportFormat')}">
+  <option value="pcd">PCD</option>
+  <option value="las">LAS</option>
+  <option value="ply">PLY</option>
+  <option value="xyz">XYZ</option>
+  <option value="csv">CSV</option>
+</select>
+<input type="text" id="${id('command')}" placeholder="command (Tab to complete)" />
 <span>
   <input type="checkbox" checked id="${id('show2D')}" />
   <label for="${id('show2D')}">2D</label>
@@ -677,6 +807,20 @@ class PCDEditor {
       />
     </div>
     <hr />
+    <div class="${id('foldMenuElem')}">
+      <label
+        for="${id('colorMode')}"
+        class="${id('inputLabel')}"
+      >Color</label>
+      <select id="${id('colorMode')}">
+        <option value="label">Label</option>
+        <option value="z">Z</option>
+        <option value="intensity">Intensity</option>
+        <option value="rgb">RGB</option>
+        <option value="normal">Normal</option>
+      </select>
+    </div>
+    <hr />
     <div class="${id('foldMenuElem')}">
       <label class="${id('inputLabel')}">Depth</label>
       <button id="${id('fovInc')}">
@@ -764,6 +908,7 @@ class PCDEditor {
     </span><span class="${id('foldMenuHeader')}">Edit</span>
     <div class="${id('foldMenuElem')}">
       <button id="${id('undo')}">Undo</button>
+      <button id="${id('redo')}">Redo</button>
     </div>
     <hr/>
     <div class="${id('foldMenuElem')}">
@@ -811,7 +956,7 @@ class PCDEditor {
       <input
         id="${id('insertSubPcdFile')}"
         type="file"
-        accept=".pcd"
+        accept=".pcd,.las,.ply,.xyz,.txt,.csv"
         style="display: none;"
       />
       <button id="${id('insertSubPcd')}">Select file</button>
@@ -820,6 +965,7 @@ class PCDEditor {
     <div class="${id('foldMenuElem')}">
       <label class="${id('inputLabel')}">Clipboard</label>
       <button id="${id('clipboardCopy')}">Copy</button>
+      <button id="${id('clipboardCopyPCD')}">Copy as PCD</button>
       <button id="${id('clipboardPaste')}">Paste</button>
     </div>
     <hr/>
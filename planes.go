@@ -0,0 +1,319 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+const (
+	defaultPlaneDistance   = 0.05
+	defaultPlaneMaxPlanes  = 6
+	defaultPlaneMinInliers = 100
+
+	planeIterations     = 200
+	planeMaxSamples     = 10000 // number of the points to evaluate the candidates
+	planeAngleTolerance = 10 * math.Pi / 180
+)
+
+type planeClass int
+
+const (
+	planeOther planeClass = iota
+	planeFloor
+	planeCeiling
+	planeWall
+)
+
+// plane is the plane normal·p + d = 0 and its inliers.
+type plane struct {
+	normal  mat.Vec3
+	d       float32
+	inliers []int
+	class   planeClass
+}
+
+func (p *plane) distance(v mat.Vec3) float32 {
+	return float32(math.Abs(float64(p.normal.Dot(v) + p.d)))
+}
+
+// row returns the plane as [a b c d inliers class].
+func (p *plane) row() []float32 {
+	return []float32{p.normal[0], p.normal[1], p.normal[2], p.d, float32(len(p.inliers)), float32(p.class)}
+}
+
+// planeLabels is the labels of the classified planes.
+// Label 0 means the planes of the class are not labeled.
+type planeLabels struct {
+	floor, ceiling, wall uint32
+}
+
+func (l planeLabels) of(c planeClass) uint32 {
+	switch c {
+	case planeFloor:
+		return l.floor
+	case planeCeiling:
+		return l.ceiling
+	case planeWall:
+		return l.wall
+	}
+	return 0
+}
+
+// planeFrom3Points returns the plane passing through the points.
+// false is returned if the points are on a line.
+func planeFrom3Points(a, b, c mat.Vec3) (plane, bool) {
+	n := b.Sub(a).Cross(c.Sub(a))
+	if n.NormSq() < 1e-12 {
+		return plane{}, false
+	}
+	n = n.Normalized()
+	return plane{normal: n, d: -n.Dot(a)}, true
+}
+
+// refinePlane fits the plane to the points by the principal component analysis.
+func refinePlane(ra pc.Vec3RandomAccessor, indice []int) (plane, bool) {
+	var mean [3]float64
+	for _, i := range indice {
+		v := ra.Vec3At(i)
+		for k := range mean {
+			mean[k] += float64(v[k])
+		}
+	}
+	for k := range mean {
+		mean[k] /= float64(len(indice))
+	}
+	var cov [3][3]float64
+	for _, i := range indice {
+		v := ra.Vec3At(i)
+		d := [3]float64{float64(v[0]) - mean[0], float64(v[1]) - mean[1], float64(v[2]) - mean[2]}
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				cov[r][c] += d[r] * d[c]
+			}
+		}
+	}
+	// The normal is the eigenvector of the smallest eigenvalue of cov,
+	// which is the eigenvector of the largest eigenvalue of (trace(cov) I - cov).
+	// Power iteration is started from each axis since the start orthogonal to the normal
+	// converges to the other eigenvector.
+	tr := cov[0][0] + cov[1][1] + cov[2][2]
+	if tr == 0 {
+		return plane{}, false
+	}
+	var m [3][3]float64
+	for r := 0; r < 3; r++ {
+		for c := 0; c < 3; c++ {
+			m[r][c] = -cov[r][c]
+		}
+		m[r][r] += tr
+	}
+	mul := func(a [3][3]float64, n [3]float64) [3]float64 {
+		var out [3]float64
+		for r := 0; r < 3; r++ {
+			out[r] = a[r][0]*n[0] + a[r][1]*n[1] + a[r][2]*n[2]
+		}
+		return out
+	}
+	var normal [3]float64
+	minVar := math.Inf(1)
+	for axis := 0; axis < 3; axis++ {
+		var n [3]float64
+		n[axis] = 1
+		for iter := 0; iter < 100; iter++ {
+			next := mul(m, n)
+			norm := math.Sqrt(next[0]*next[0] + next[1]*next[1] + next[2]*next[2])
+			if norm == 0 {
+				break
+			}
+			for r := range n {
+				n[r] = next[r] / norm
+			}
+		}
+		cn := mul(cov, n)
+		if v := n[0]*cn[0] + n[1]*cn[1] + n[2]*cn[2]; v < minVar {
+			normal, minVar = n, v
+		}
+	}
+	nv := mat.Vec3{float32(normal[0]), float32(normal[1]), float32(normal[2])}
+	center := mat.Vec3{float32(mean[0]), float32(mean[1]), float32(mean[2])}
+	return plane{normal: nv, d: -nv.Dot(center)}, true
+}
+
+// orient flips the plane to make the normal face upward, or toward +x/+y for vertical planes.
+func (p *plane) orient() {
+	n := p.normal
+	if n[2] < 0 || (n[2] == 0 && (n[0] < 0 || (n[0] == 0 && n[1] < 0))) {
+		p.normal, p.d = n.Mul(-1), -p.d
+	}
+}
+
+// extractPlanes extracts the dominant planes one by one by RANSAC.
+// Extraction stops when the plane has less than minInliers inliers.
+func extractPlanes(ra pc.Vec3RandomAccessor, distance float32, maxPlanes, minInliers int) []plane {
+	rnd := rand.New(rand.NewSource(1))
+	remaining := make([]int, ra.Len())
+	for i := range remaining {
+		remaining[i] = i
+	}
+	var planes []plane
+	for len(planes) < maxPlanes && len(remaining) >= 3 && len(remaining) >= minInliers {
+		samples := remaining
+		if len(samples) > planeMaxSamples {
+			samples = make([]int, planeMaxSamples)
+			for i := range samples {
+				samples[i] = remaining[rnd.Intn(len(remaining))]
+			}
+		}
+		var best plane
+		bestScore := -1
+		for iter := 0; iter < planeIterations; iter++ {
+			p, ok := planeFrom3Points(
+				ra.Vec3At(remaining[rnd.Intn(len(remaining))]),
+				ra.Vec3At(remaining[rnd.Intn(len(remaining))]),
+				ra.Vec3At(remaining[rnd.Intn(len(remaining))]),
+			)
+			if !ok {
+				continue
+			}
+			var score int
+			for _, i := range samples {
+				if p.distance(ra.Vec3At(i)) <= distance {
+					score++
+				}
+			}
+			if score > bestScore {
+				best, bestScore = p, score
+			}
+		}
+		if bestScore < 0 {
+			break
+		}
+
+		inliers := func(p plane) ([]int, []int) {
+			var in, out []int
+			for _, i := range remaining {
+				if p.distance(ra.Vec3At(i)) <= distance {
+					in = append(in, i)
+				} else {
+					out = append(out, i)
+				}
+			}
+			return in, out
+		}
+		in, out := inliers(best)
+		if len(in) < minInliers {
+			break
+		}
+		if refined, ok := refinePlane(ra, in); ok {
+			if rin, rout := inliers(refined); len(rin) >= len(in) {
+				best, in, out = refined, rin, rout
+			}
+		}
+		best.inliers = in
+		best.orient()
+		planes = append(planes, best)
+		remaining = out
+	}
+	return planes
+}
+
+// classifyPlanes classifies the planes by the normal direction.
+// Horizontal planes lower than the middle of zMin and zMax are floors and others are ceilings.
+func classifyPlanes(ra pc.Vec3RandomAccessor, planes []plane, zMin, zMax float32) {
+	cosTol := float32(math.Cos(planeAngleTolerance))
+	sinTol := float32(math.Sin(planeAngleTolerance))
+	for i := range planes {
+		p := &planes[i]
+		nz := float32(math.Abs(float64(p.normal[2])))
+		switch {
+		case nz >= cosTol:
+			var z float32
+			for _, j := range p.inliers {
+				z += ra.Vec3At(j)[2]
+			}
+			if z/float32(len(p.inliers)) < (zMin+zMax)/2 {
+				p.class = planeFloor
+			} else {
+				p.class = planeCeiling
+			}
+		case nz <= sinTol:
+			p.class = planeWall
+		default:
+			p.class = planeOther
+		}
+	}
+}
+
+func (c *commandContext) PlaneLabels() planeLabels {
+	return c.planeLabels
+}
+
+func (c *commandContext) SetPlaneLabels(l planeLabels) {
+	c.planeLabels = l
+}
+
+// ExtractPlanes extracts the planes in the crop box, classifies them into floor, ceiling and wall,
+// and sets the plane labels to the inliers.
+// Selection mask must be updated before calling it to exclude the cropped points.
+func (c *commandContext) ExtractPlanes(distance float32, maxPlanes, minInliers int) ([]plane, error) {
+	if distance <= 0 || maxPlanes < 1 || minInliers < 3 {
+		return nil, errors.New("distance and maxPlanes must be positive and minInliers must be 3 or more")
+	}
+	if err := c.checkSelectMask(); err != nil {
+		return nil, err
+	}
+	it, err := c.editor.pp.Vec3Iterator()
+	if err != nil {
+		return nil, err
+	}
+	var indice []int
+	zMin, zMax := float32(math.Inf(1)), float32(math.Inf(-1))
+	for i, m := range c.selectMask {
+		if m&selectBitmaskCropped == 0 {
+			indice = append(indice, i)
+			z := it.Vec3At(i)[2]
+			if z < zMin {
+				zMin = z
+			}
+			if z > zMax {
+				zMax = z
+			}
+		}
+	}
+	ra := pc.NewIndiceVec3RandomAccessor(it, indice)
+	planes := extractPlanes(ra, distance, maxPlanes, minInliers)
+	classifyPlanes(ra, planes, zMin, zMax)
+
+	labels := make([]uint32, c.editor.pp.Points)
+	var labeled bool
+	for i := range planes {
+		p := &planes[i]
+		for k, j := range p.inliers {
+			p.inliers[k] = indice[j]
+		}
+		if l := c.planeLabels.of(p.class); l != 0 {
+			for _, j := range p.inliers {
+				labels[j] = l
+			}
+			labeled = true
+		}
+	}
+	if !labeled {
+		return planes, nil
+	}
+	err = c.editor.label(
+		c.newJournal("label_planes", distance, float32(maxPlanes), float32(minInliers)),
+		func(i int, _ mat.Vec3) (uint32, bool) {
+			return labels[i], labels[i] != 0
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	c.setPointCloudUpdated()
+	return planes, nil
+}
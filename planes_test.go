@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+// planeTestRoom returns the points of 4m x 4m x 3m room
+// having the floor, the ceiling and the walls on x=0 and x=4.
+func planeTestRoom() []mat.Vec3 {
+	var vs []mat.Vec3
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			x, y := float32(i)*0.2+0.1, float32(j)*0.2+0.1
+			vs = append(vs, mat.Vec3{x, y, 0}, mat.Vec3{x, y, 3})
+		}
+	}
+	for i := 0; i < 20; i++ {
+		for k := 1; k < 15; k++ {
+			y, z := float32(i)*0.2+0.1, float32(k)*0.2
+			vs = append(vs, mat.Vec3{0, y, z}, mat.Vec3{4, y, z})
+		}
+	}
+	// A box on the floor
+	return append(vs, mat.Vec3{2, 2, 0.5}, mat.Vec3{2.1, 2, 0.5}, mat.Vec3{2, 2.1, 0.5})
+}
+
+func TestExtractPlanes(t *testing.T) {
+	vs := planeTestRoom()
+	c := newTestConsole(t, vs...)
+
+	if _, err := c.Run("plane_labels 1 2 3", noUpdate); err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Run("planes 0.02 6 50", noUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := res.([][]float32)
+	if len(rows) != 4 {
+		t.Fatalf("Expected 4 planes, got %v", rows)
+	}
+	near := func(a, b float32) bool {
+		return math.Abs(float64(a-b)) < 0.01
+	}
+	var nFloor, nCeiling, nWall int
+	for _, r := range rows {
+		switch planeClass(r[5]) {
+		case planeFloor:
+			nFloor++
+			if !near(r[2], 1) || !near(r[3], 0) || r[4] != 400 {
+				t.Errorf("Unexpected floor %v", r)
+			}
+		case planeCeiling:
+			nCeiling++
+			if !near(r[2], 1) || !near(r[3], -3) || r[4] != 400 {
+				t.Errorf("Unexpected ceiling %v", r)
+			}
+		case planeWall:
+			nWall++
+			if !near(r[0], 1) || !(near(r[3], 0) || near(r[3], -4)) || r[4] != 280 {
+				t.Errorf("Unexpected wall %v", r)
+			}
+		default:
+			t.Errorf("Unexpected plane %v", r)
+		}
+	}
+	if nFloor != 1 || nCeiling != 1 || nWall != 2 {
+		t.Errorf("Expected 1 floor, 1 ceiling and 2 walls, got %d, %d and %d", nFloor, nCeiling, nWall)
+	}
+
+	lt, err := c.cmd.editor.pp.Uint32Iterator("label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	it, err := c.cmd.editor.pp.Vec3Iterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range vs {
+		p := it.Vec3At(i)
+		var expected uint32
+		switch {
+		case p[2] == 0:
+			expected = 1
+		case p[2] == 3:
+			expected = 2
+		case p[0] == 0 || p[0] == 4:
+			expected = 3
+		}
+		if l := lt.Uint32At(i); l != expected {
+			t.Errorf("Expected label %d at %v, got %d", expected, p, l)
+		}
+	}
+
+	if _, err := c.Run("planes 0 6 50", noUpdate); err == nil {
+		t.Error("Expected error on zero distance")
+	}
+}
+
+func TestExtractPlanes_NoLabel(t *testing.T) {
+	vs := planeTestRoom()
+	c := newTestConsole(t, vs...).cmd
+	planes, err := c.ExtractPlanes(0.02, 2, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(planes) != 2 {
+		t.Errorf("Expected 2 planes, got %d", len(planes))
+	}
+	if j, _ := c.Journal(); len(j) != 0 {
+		t.Error("Cloud must not be edited without plane labels")
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+var (
+	errPLYHeader   = errors.New("invalid PLY header")
+	errPLYNoVertex = errors.New("PLY file has no vertex element")
+)
+
+const (
+	plyASCII = iota
+	plyBinaryLittleEndian
+	plyBinaryBigEndian
+)
+
+var plyFormatNames = []string{"ascii", "binary_little_endian", "binary_big_endian"}
+
+// plyTypes maps PLY property types to PCD field types.
+var plyTypes = map[string]struct {
+	typ  string
+	size int
+}{
+	"char": {"I", 1}, "int8": {"I", 1},
+	"uchar": {"U", 1}, "uint8": {"U", 1},
+	"short": {"I", 2}, "int16": {"I", 2},
+	"ushort": {"U", 2}, "uint16": {"U", 2},
+	"int": {"I", 4}, "int32": {"I", 4},
+	"uint": {"U", 4}, "uint32": {"U", 4},
+	"float": {"F", 4}, "float32": {"F", 4},
+	"double": {"F", 8}, "float64": {"F", 8},
+}
+
+type plyProperty struct {
+	name      string
+	typ       string
+	size      int
+	list      bool
+	countTyp  string
+	countSize int
+}
+
+type plyElement struct {
+	name  string
+	count int
+	props []plyProperty
+}
+
+func isPLY(head []byte) bool {
+	return strings.HasPrefix(string(head), "ply\n") || strings.HasPrefix(string(head), "ply\r\n")
+}
+
+// unmarshalPLY reads vertices of ASCII or binary PLY file.
+// Scalar properties of the vertex element are stored as the fields,
+// and the other elements like faces are ignored.
+// It fails if the vertices exceed maxBytes.
+func unmarshalPLY(r io.Reader, maxBytes int) (*pc.PointCloud, error) {
+	br := bufio.NewReader(r)
+	format, elems, err := readPLYHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, e := range elems {
+		if e.name != "vertex" {
+			if err := skipPLYElement(br, format, e); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		pp := &pc.PointCloud{
+			PointCloudHeader: pc.PointCloudHeader{
+				Version:   0.7,
+				Width:     e.count,
+				Height:    1,
+				Viewpoint: []float32{0, 0, 0, 1, 0, 0, 0},
+			},
+			Points: e.count,
+		}
+		// Destination field of each property, -1 for list properties
+		dst := make([]int, len(e.props))
+		for k, p := range e.props {
+			dst[k] = -1
+			if p.list {
+				continue
+			}
+			name := normalizeFieldName(p.name)
+			typ, size := p.typ, p.size
+			switch name {
+			case "x", "y", "z":
+				typ, size = "F", 4
+			}
+			dst[k] = len(pp.Fields)
+			pp.Fields = append(pp.Fields, name)
+			pp.Type = append(pp.Type, typ)
+			pp.Size = append(pp.Size, size)
+			pp.Count = append(pp.Count, 1)
+		}
+		offsets := make([]int, len(pp.Fields))
+		for k := range offsets {
+			offsets[k], _ = fieldOffsetAt(&pp.PointCloudHeader, k)
+		}
+		stride := pp.Stride()
+		if err := checkPointCloudBytes(e.count, stride, maxBytes); err != nil {
+			return nil, err
+		}
+		pp.Data = make([]byte, e.count*stride)
+		tokens := &plyTokenizer{r: br}
+		for i := 0; i < e.count; i++ {
+			b := pp.Data[i*stride:]
+			for k, p := range e.props {
+				if p.list {
+					if err := skipPLYList(br, tokens, format, p); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				v, err := readPLYValue(br, tokens, format, p.typ, p.size)
+				if err != nil {
+					return nil, err
+				}
+				j := dst[k]
+				writeNumber(b[offsets[j]:], pp.Type[j], pp.Size[j], v)
+			}
+			if format == plyASCII {
+				tokens.nextLine()
+			}
+		}
+		return pp, nil
+	}
+	return nil, errPLYNoVertex
+}
+
+func readPLYHeader(br *bufio.Reader) (int, []plyElement, error) {
+	line, err := br.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "ply" {
+		return 0, nil, errPLYHeader
+	}
+	format := -1
+	var elems []plyElement
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return 0, nil, errPLYHeader
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		switch f[0] {
+		case "format":
+			if len(f) < 2 {
+				return 0, nil, errPLYHeader
+			}
+			format = indexOf(plyFormatNames, f[1])
+			if format < 0 {
+				return 0, nil, fmt.Errorf("unsupported PLY format %s", f[1])
+			}
+		case "element":
+			if len(f) != 3 {
+				return 0, nil, errPLYHeader
+			}
+			n, err := strconv.Atoi(f[2])
+			if err != nil || n < 0 {
+				return 0, nil, errPLYHeader
+			}
+			elems = append(elems, plyElement{name: f[1], count: n})
+		case "property":
+			if len(elems) == 0 {
+				return 0, nil, errPLYHeader
+			}
+			e := &elems[len(elems)-1]
+			var p plyProperty
+			switch {
+			case len(f) == 5 && f[1] == "list":
+				ct, ok1 := plyTypes[f[2]]
+				it, ok2 := plyTypes[f[3]]
+				if !ok1 || !ok2 || ct.typ == "F" {
+					return 0, nil, errPLYHeader
+				}
+				p = plyProperty{name: f[4], list: true, countTyp: ct.typ, countSize: ct.size, typ: it.typ, size: it.size}
+			case len(f) == 3:
+				t, ok := plyTypes[f[1]]
+				if !ok {
+					return 0, nil, fmt.Errorf("unsupported PLY property type %s", f[1])
+				}
+				p = plyProperty{name: f[2], typ: t.typ, size: t.size}
+			default:
+				return 0, nil, errPLYHeader
+			}
+			e.props = append(e.props, p)
+		case "end_header":
+			if format < 0 {
+				return 0, nil, errPLYHeader
+			}
+			return format, elems, nil
+		}
+	}
+}
+
+// plyTokenizer reads space separated values of ASCII PLY.
+type plyTokenizer struct {
+	r    *bufio.Reader
+	line []string
+}
+
+func (t *plyTokenizer) next() (string, error) {
+	for len(t.line) == 0 {
+		l, err := t.r.ReadString('\n')
+		if err != nil && (err != io.EOF || l == "") {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		t.line = strings.Fields(l)
+	}
+	s := t.line[0]
+	t.line = t.line[1:]
+	return s, nil
+}
+
+// nextLine drops the remaining values of the current line.
+func (t *plyTokenizer) nextLine() {
+	t.line = nil
+}
+
+func readPLYValue(br *bufio.Reader, tokens *plyTokenizer, format int, typ string, size int) (float64, error) {
+	if format == plyASCII {
+		s, err := tokens.next()
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseFloat(s, 64)
+	}
+	var b [8]byte
+	if _, err := io.ReadFull(br, b[:size]); err != nil {
+		return 0, err
+	}
+	if format == plyBinaryBigEndian {
+		for i := 0; i < size/2; i++ {
+			b[i], b[size-1-i] = b[size-1-i], b[i]
+		}
+	}
+	return readNumber(b[:], typ, size), nil
+}
+
+func skipPLYList(br *bufio.Reader, tokens *plyTokenizer, format int, p plyProperty) error {
+	n, err := readPLYValue(br, tokens, format, p.countTyp, p.countSize)
+	if err != nil {
+		return err
+	}
+	for k := 0; k < int(n); k++ {
+		if _, err := readPLYValue(br, tokens, format, p.typ, p.size); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func skipPLYElement(br *bufio.Reader, format int, e plyElement) error {
+	tokens := &plyTokenizer{r: br}
+	for i := 0; i < e.count; i++ {
+		if format == plyASCII {
+			// Each element is written in a line
+			if _, err := br.ReadString('\n'); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, p := range e.props {
+			if p.list {
+				if err := skipPLYList(br, tokens, format, p); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := br.Discard(p.size); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// marshalPLY writes the cloud as binary little endian or ASCII PLY.
+// Fields having multiple values and padding fields are not written.
+func marshalPLY(pp *pc.PointCloud, w io.Writer, ascii bool, precision int) error {
+	type column struct {
+		off  int
+		typ  string
+		size int
+	}
+	var cols []column
+	bw := bufio.NewWriter(w)
+	format := plyBinaryLittleEndian
+	if ascii {
+		format = plyASCII
+	}
+	fmt.Fprintf(bw, "ply\nformat %s 1.0\ncomment pcdeditor\nelement vertex %d\n", plyFormatNames[format], pp.Points)
+	for i, f := range pp.Fields {
+		if f == "_" || pp.Count[i] != 1 || !isNumericType(pp.Type[i], pp.Size[i]) {
+			continue
+		}
+		typ := plyTypeName(pp.Type[i], pp.Size[i])
+		if typ == "" {
+			continue
+		}
+		off, _ := fieldOffsetAt(&pp.PointCloudHeader, i)
+		cols = append(cols, column{off: off, typ: pp.Type[i], size: pp.Size[i]})
+		fmt.Fprintf(bw, "property %s %s\n", typ, plyPropertyName(f))
+	}
+	bw.WriteString("end_header\n")
+
+	stride := pp.Stride()
+	var buf []byte
+	for i := 0; i < pp.Points; i++ {
+		p := pp.Data[i*stride:]
+		buf = buf[:0]
+		for k, c := range cols {
+			if !ascii {
+				buf = append(buf, p[c.off:c.off+c.size]...)
+				continue
+			}
+			if k > 0 {
+				buf = append(buf, ' ')
+			}
+			buf = appendNumber(buf, p[c.off:], c.typ, c.size, precision)
+		}
+		if ascii {
+			buf = append(buf, '\n')
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func plyTypeName(typ string, size int) string {
+	switch typ + strconv.Itoa(size) {
+	case "I1":
+		return "char"
+	case "U1":
+		return "uchar"
+	case "I2":
+		return "short"
+	case "U2":
+		return "ushort"
+	case "I4":
+		return "int"
+	case "U4":
+		return "uint"
+	case "F4":
+		return "float"
+	case "F8":
+		return "double"
+	}
+	return ""
+}
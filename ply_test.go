@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seqsense/pcdeditor/pcd"
+	"github.com/seqsense/pcgol/pc"
+)
+
+func TestPLY(t *testing.T) {
+	for _, encoding := range []string{"binary", "ascii"} {
+		encoding := encoding
+		t.Run("RoundTrip_"+encoding, func(t *testing.T) {
+			pp := createLASTestCloud(t, []uint32{0, 2, 300})
+			var buf bytes.Buffer
+			if err := marshalPointCloud(pp, &buf, formatOptions{format: formatPLY, encoding: encoding}); err != nil {
+				t.Fatal(err)
+			}
+			out, err := unmarshalPointCloud(&buf, formatOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pp.PointCloudHeader, out.PointCloudHeader) {
+				t.Fatalf("Expected header:\n%+v\nGot:\n%+v", pp.PointCloudHeader, out.PointCloudHeader)
+			}
+			if !bytes.Equal(pp.Data, out.Data) {
+				t.Errorf("Expected data:\n%v\nGot:\n%v", pp.Data, out.Data)
+			}
+		})
+	}
+
+	expected := &pc.PointCloud{
+		PointCloudHeader: pc.PointCloudHeader{
+			Version:   0.7,
+			Fields:    []string{"x", "y", "z", "normal_x", "red", "intensity"},
+			Size:      []int{4, 4, 4, 4, 1, 4},
+			Type:      []string{"F", "F", "F", "F", "U", "F"},
+			Count:     []int{1, 1, 1, 1, 1, 1},
+			Width:     2,
+			Height:    1,
+			Viewpoint: []float32{0, 0, 0, 1, 0, 0, 0},
+		},
+		Points: 2,
+	}
+	expected.Data = make([]byte, 2*expected.Stride())
+	for i, v := range [][]float64{
+		{1, 2, 3, 0.5, 255, 10},
+		{-1, -2, -3, -0.5, 0, 20},
+	} {
+		p := expected.Data[i*expected.Stride():]
+		for k, f := range v {
+			off, _ := fieldOffsetAt(&expected.PointCloudHeader, k)
+			writeNumber(p[off:], expected.Type[k], expected.Size[k], f)
+		}
+	}
+	header := func(format string) string {
+		return "ply\nformat " + format + " 1.0\ncomment test\n" +
+			"element vertex 2\n" +
+			"property double x\nproperty double y\nproperty double z\n" +
+			"property float nx\nproperty uchar red\nproperty float scalar_Intensity\n" +
+			"element face 1\nproperty list uchar int vertex_indices\n" +
+			"end_header\n"
+	}
+
+	testCases := map[string][]byte{
+		"ASCII": []byte(header("ascii") +
+			"1 2 3 0.5 255 10\n" +
+			"-1 -2 -3 -0.5 0 20\n" +
+			"3 0 1 0\n"),
+		"BinaryBigEndian": append([]byte(header("binary_big_endian")),
+			0x3F, 0xF0, 0, 0, 0, 0, 0, 0,
+			0x40, 0x00, 0, 0, 0, 0, 0, 0,
+			0x40, 0x08, 0, 0, 0, 0, 0, 0,
+			0x3F, 0x00, 0, 0,
+			0xFF,
+			0x41, 0x20, 0, 0,
+			0xBF, 0xF0, 0, 0, 0, 0, 0, 0,
+			0xC0, 0x00, 0, 0, 0, 0, 0, 0,
+			0xC0, 0x08, 0, 0, 0, 0, 0, 0,
+			0xBF, 0x00, 0, 0,
+			0x00,
+			0x41, 0xA0, 0, 0,
+			3, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0,
+		),
+	}
+	for name, b := range testCases {
+		b := b
+		t.Run(name, func(t *testing.T) {
+			out, err := unmarshalPointCloud(bytes.NewReader(b), formatOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(expected.PointCloudHeader, out.PointCloudHeader) {
+				t.Fatalf("Expected header:\n%+v\nGot:\n%+v", expected.PointCloudHeader, out.PointCloudHeader)
+			}
+			if !bytes.Equal(expected.Data, out.Data) {
+				t.Errorf("Expected data:\n%v\nGot:\n%v", expected.Data, out.Data)
+			}
+		})
+	}
+
+	t.Run("NoVertex", func(t *testing.T) {
+		b := "ply\nformat ascii 1.0\nelement face 0\nproperty list uchar int vertex_indices\nend_header\n"
+		if _, err := unmarshalPLY(strings.NewReader(b), 0); !errors.Is(err, errPLYNoVertex) {
+			t.Errorf("Expected %v, got: %v", errPLYNoVertex, err)
+		}
+	})
+	t.Run("TooLarge", func(t *testing.T) {
+		b := "ply\nformat binary_little_endian 1.0\nelement vertex 1000000000000\nproperty float x\nproperty float y\nproperty float z\nend_header\n"
+		if _, err := unmarshalPointCloud(strings.NewReader(b), formatOptions{}); !errors.Is(err, pcd.ErrTooLarge) {
+			t.Errorf("Expected %v, got: %v", pcd.ErrTooLarge, err)
+		}
+		b = "ply\nformat ascii 1.0\nelement vertex 2\nproperty float x\nproperty float y\nproperty float z\nend_header\n0 0 0\n1 1 1\n"
+		if _, err := unmarshalPLY(strings.NewReader(b), 12); !errors.Is(err, pcd.ErrTooLarge) {
+			t.Errorf("Expected %v, got: %v", pcd.ErrTooLarge, err)
+		}
+		if _, err := unmarshalPLY(strings.NewReader(b), 24); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
@@ -26,6 +26,18 @@ func vec3Min(a, b mat.Vec3) mat.Vec3 {
 	return out
 }
 
+func vec3Max(a, b mat.Vec3) mat.Vec3 {
+	var out mat.Vec3
+	for i := range out {
+		if a[i] > b[i] {
+			out[i] = a[i]
+		} else {
+			out[i] = b[i]
+		}
+	}
+	return out
+}
+
 func float32Min(a, b float32) float32 {
 	if a < b {
 		return a
@@ -74,3 +86,26 @@ func (r *rect) IsInside(v mat.Vec3) bool {
 		r.max[1] < v[1] ||
 		r.max[2] < v[2])
 }
+
+// fieldOffset returns byte offset of the field in a point.
+func fieldOffset(h *pc.PointCloudHeader, name string) (int, bool) {
+	var off int
+	for i, f := range h.Fields {
+		if f == name {
+			return off, true
+		}
+		off += h.Size[i] * h.Count[i]
+	}
+	return 0, false
+}
+
+// newPointCloudLike allocates n points of the cloud having the same fields as pp.
+func newPointCloudLike(pp *pc.PointCloud, n int) *pc.PointCloud {
+	out := &pc.PointCloud{
+		PointCloudHeader: pp.PointCloudHeader.Clone(),
+		Points:           n,
+	}
+	out.Width, out.Height = n, 1
+	out.Data = make([]byte, n*out.Stride())
+	return out
+}
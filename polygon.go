@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+var errPolygonTooFewVertices = errors.New("polygon requires at least 3 vertices")
+
+// polygonPrism is the polygon on XY plane extruded between zMin and zMax.
+type polygonPrism struct {
+	vertices   []mat.Vec3 // z is ignored
+	zMin, zMax float32
+	min, max   [2]float32 // bounding box of the vertices
+}
+
+func newPolygonPrism(vertices []mat.Vec3, zMin, zMax float32) (*polygonPrism, error) {
+	if len(vertices) < 3 {
+		return nil, errPolygonTooFewVertices
+	}
+	p := &polygonPrism{
+		vertices: vertices,
+		zMin:     zMin,
+		zMax:     zMax,
+		min:      [2]float32{vertices[0][0], vertices[0][1]},
+		max:      [2]float32{vertices[0][0], vertices[0][1]},
+	}
+	for _, v := range vertices[1:] {
+		for k := 0; k < 2; k++ {
+			if v[k] < p.min[k] {
+				p.min[k] = v[k]
+			}
+			if v[k] > p.max[k] {
+				p.max[k] = v[k]
+			}
+		}
+	}
+	return p, nil
+}
+
+// IsInside returns true if the point is inside the prism.
+// Self-intersecting polygon is evaluated by the even-odd rule.
+func (p *polygonPrism) IsInside(v mat.Vec3) bool {
+	if v[2] < p.zMin || p.zMax < v[2] ||
+		v[0] < p.min[0] || p.max[0] < v[0] ||
+		v[1] < p.min[1] || p.max[1] < v[1] {
+		return false
+	}
+	inside := false
+	n := len(p.vertices)
+	for i, j := 0, n-1; i < n; j, i = i, i+1 {
+		a, b := p.vertices[i], p.vertices[j]
+		if (a[1] > v[1]) != (b[1] > v[1]) &&
+			v[0] < (b[0]-a[0])*(v[1]-a[1])/(b[1]-a[1])+a[0] {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Polygon returns the vertices of the polygon being drawn.
+func (c *commandContext) Polygon() ([]mat.Vec3, bool) {
+	updated := c.polygonUpdated
+	c.polygonUpdated = false
+	return c.polygon, updated
+}
+
+// AddPolygonVertex adds the vertex of the polygon being drawn.
+// The polygon is selected by FinalizeCurrentMode.
+func (c *commandContext) AddPolygonVertex(p mat.Vec3) bool {
+	if c.selectMode == selectModeInsert {
+		return false
+	}
+	if len(c.polygon) == 0 {
+		// Keep the mask selection to be combined with the polygon
+		c.selected = nil
+		c.updateRect()
+	}
+	c.polygon = append(c.polygon, p)
+	c.polygonUpdated = true
+	return true
+}
+
+func (c *commandContext) unsetPolygon() {
+	c.polygon = nil
+	c.polygonUpdated = true
+}
+
+func (c *commandContext) PolygonZRange() (float32, float32) {
+	return c.polygonZMin, c.polygonZMax
+}
+
+func (c *commandContext) SetPolygonZRange(min, max float32) error {
+	if min > max {
+		return errors.New("min must be smaller than max")
+	}
+	c.polygonZMin, c.polygonZMax = min, max
+	return nil
+}
+
+// SelectPolygon selects the points in the polygon extruded in the polygon Z range.
+// Selection mask must be updated before calling it to exclude the cropped points.
+func (c *commandContext) SelectPolygon(vertices []mat.Vec3) error {
+	if c.selectMode == selectModeInsert {
+		return errors.New("polygon selection is not available in insert mode")
+	}
+	prism, err := newPolygonPrism(vertices, c.polygonZMin, c.polygonZMax)
+	if err != nil {
+		return err
+	}
+	if err := c.checkSelectMask(); err != nil {
+		return err
+	}
+	it, err := c.editor.pp.Vec3Iterator()
+	if err != nil {
+		return err
+	}
+	c.beginMaskSelection()
+	n := c.editor.pp.Points
+	for i := 0; i < n; i++ {
+		if c.selectMask[i]&selectBitmaskCropped == 0 && prism.IsInside(it.Vec3At(i)) {
+			c.selectMask[i] |= selectBitmaskSegmentSelected
+		}
+	}
+	c.endMaskSelection()
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestPolygonPrism(t *testing.T) {
+	// L-shaped polygon
+	prism, err := newPolygonPrism([]mat.Vec3{
+		{0, 0, 0}, {2, 0, 0}, {2, 1, 0}, {1, 1, 0}, {1, 2, 0}, {0, 2, 0},
+	}, -1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := map[string]struct {
+		p        mat.Vec3
+		expected bool
+	}{
+		"Inside":       {mat.Vec3{0.5, 0.5, 0}, true},
+		"InsideArm":    {mat.Vec3{1.5, 0.5, 0.5}, true},
+		"Concave":      {mat.Vec3{1.5, 1.5, 0}, false},
+		"OutsideBBox":  {mat.Vec3{3, 0.5, 0}, false},
+		"AboveZRange":  {mat.Vec3{0.5, 0.5, 1.5}, false},
+		"BelowZRange":  {mat.Vec3{0.5, 0.5, -1.5}, false},
+		"OnZRangeEdge": {mat.Vec3{0.5, 0.5, 1}, true},
+	}
+	for name, tt := range testCases {
+		if in := prism.IsInside(tt.p); in != tt.expected {
+			t.Errorf("%s: expected %v, got %v", name, tt.expected, in)
+		}
+	}
+
+	if _, err := newPolygonPrism([]mat.Vec3{{0, 0, 0}, {1, 0, 0}}, -1, 1); err != errPolygonTooFewVertices {
+		t.Errorf("Expected %v, got %v", errPolygonTooFewVertices, err)
+	}
+}
+
+func TestSelectPolygon(t *testing.T) {
+	c := newCommandContext(&dummyPCDIO{}, nil)
+	if err := c.editor.SetPointCloud(createPointCloud(t, false), cloudMain); err != nil {
+		t.Fatal(err)
+	}
+	triangle := []mat.Vec3{{0, 0, 0}, {10, 0, 0}, {0, 10, 0}}
+
+	if err := c.SelectPolygon(triangle); err == nil {
+		t.Error("Expected error without the selection mask")
+	}
+
+	// (7, 8, 9) is outside of the triangle and (4, 5, 6) is cropped
+	c.SetSelectMask([]uint32{0, selectBitmaskCropped, 0})
+	if err := c.SelectPolygon(triangle); err != nil {
+		t.Fatal(err)
+	}
+	if c.SelectMode() != selectModeMask {
+		t.Fatal("Select mode must be mask")
+	}
+	if !c.Label(5) {
+		t.Fatal("Label failed")
+	}
+	lt, err := c.editor.pp.Uint32Iterator("label")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []uint32{5, 1, 2} {
+		if l := lt.Uint32At(i); l != expected {
+			t.Errorf("Expected label %d at %d, got %d", expected, i, l)
+		}
+	}
+
+	if err := c.SetPolygonZRange(4, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetPolygonZRange(1, 0); err == nil {
+		t.Error("Expected error on invalid Z range")
+	}
+	c.SetSelectMask([]uint32{0, 0, 0})
+	if !c.AddPolygonVertex(mat.Vec3{0, 0, 0}) || !c.AddPolygonVertex(mat.Vec3{20, 0, 0}) {
+		t.Fatal("Failed to add polygon vertex")
+	}
+	if polygon, updated := c.Polygon(); len(polygon) != 2 || !updated {
+		t.Errorf("Expected 2 updated vertices, got %v (updated: %v)", polygon, updated)
+	}
+	c.AddPolygonVertex(mat.Vec3{0, 20, 0})
+	if err := c.FinalizeCurrentMode(); err != nil {
+		t.Fatal(err)
+	}
+	if polygon, _ := c.Polygon(); len(polygon) != 0 {
+		t.Error("Polygon must be cleared after selection")
+	}
+	// (1, 2, 3) is out of the Z range
+	c.Delete()
+	expectPointCloud(t, c.editor.pp, []mat.Vec3{{1, 2, 3}})
+}
+
+func TestSelectPolygon_VoxelFilter(t *testing.T) {
+	c := newCommandContext(&dummyPCDIO{}, nil)
+	pp := createXYZCloud(t,
+		mat.Vec3{0.01, 0.01, 0}, mat.Vec3{0.02, 0.02, 0}, mat.Vec3{0.03, 0.03, 0},
+		mat.Vec3{5.01, 5.01, 0}, mat.Vec3{5.02, 5.02, 0},
+	)
+	if err := c.editor.SetPointCloud(pp, cloudMain); err != nil {
+		t.Fatal(err)
+	}
+	c.SetSelectMask(make([]uint32, 5))
+	if err := c.SelectPolygon([]mat.Vec3{{-1, -1, 0}, {1, -1, 0}, {1, 1, 0}, {-1, 1, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VoxelFilter(1); err != nil {
+		t.Fatal(err)
+	}
+	if c.editor.pp.Points != 3 {
+		t.Errorf("Only the points in the polygon must be filtered, got %d points", c.editor.pp.Points)
+	}
+	if c.SelectMode() != selectModeRect {
+		t.Error("Mask selection must be cleared after filtering")
+	}
+}
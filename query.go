@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+// queryNode is a node of the point query expression like
+// "label in 3,5 and z > 1.2 and intensity < 10".
+type queryNode interface {
+	// bind returns the function to evaluate the node on i-th point of the cloud.
+	bind(env *queryEnv) (func(i int) bool, error)
+}
+
+// queryEnv is the cloud and the editor state to evaluate the query.
+type queryEnv struct {
+	pp                 *pc.PointCloud
+	labelMin, labelMax uint32
+}
+
+type queryAnd struct{ a, b queryNode }
+type queryOr struct{ a, b queryNode }
+type queryNot struct{ a queryNode }
+
+// queryColored matches the points having the label in the render label range.
+type queryColored struct{}
+
+// queryCompare compares the field value with the values.
+// op is one of "<", "<=", ">", ">=", "==", "!=" and "in".
+type queryCompare struct {
+	field  string
+	op     string
+	values []float64
+}
+
+func (q *queryAnd) bind(env *queryEnv) (func(int) bool, error) {
+	a, b, err := bind2(env, q.a, q.b)
+	if err != nil {
+		return nil, err
+	}
+	return func(i int) bool { return a(i) && b(i) }, nil
+}
+
+func (q *queryOr) bind(env *queryEnv) (func(int) bool, error) {
+	a, b, err := bind2(env, q.a, q.b)
+	if err != nil {
+		return nil, err
+	}
+	return func(i int) bool { return a(i) || b(i) }, nil
+}
+
+func bind2(env *queryEnv, a, b queryNode) (func(int) bool, func(int) bool, error) {
+	fa, err := a.bind(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	fb, err := b.bind(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fa, fb, nil
+}
+
+func (q *queryNot) bind(env *queryEnv) (func(int) bool, error) {
+	a, err := q.a.bind(env)
+	if err != nil {
+		return nil, err
+	}
+	return func(i int) bool { return !a(i) }, nil
+}
+
+func (q *queryColored) bind(env *queryEnv) (func(int) bool, error) {
+	lt, err := env.pp.Uint32Iterator("label")
+	if err != nil {
+		return nil, err
+	}
+	return func(i int) bool {
+		l := lt.Uint32At(i)
+		return env.labelMin <= l && l <= env.labelMax
+	}, nil
+}
+
+func (q *queryCompare) bind(env *queryEnv) (func(int) bool, error) {
+	h := &env.pp.PointCloudHeader
+	idx := fieldIndex(h, q.field, 0)
+	if idx < 0 {
+		return nil, fmt.Errorf("unknown field %q", q.field)
+	}
+	if h.Count[idx] != 1 || !isNumericType(h.Type[idx], h.Size[idx]) {
+		return nil, fmt.Errorf("field %q is not a scalar number", q.field)
+	}
+	off, _ := fieldOffsetAt(h, idx)
+	stride := h.Stride()
+	typ, size := h.Type[idx], h.Size[idx]
+	value := func(i int) float64 {
+		return readNumber(env.pp.Data[i*stride+off:], typ, size)
+	}
+
+	v := q.values[0]
+	switch q.op {
+	case "<":
+		return func(i int) bool { return value(i) < v }, nil
+	case "<=":
+		return func(i int) bool { return value(i) <= v }, nil
+	case ">":
+		return func(i int) bool { return value(i) > v }, nil
+	case ">=":
+		return func(i int) bool { return value(i) >= v }, nil
+	case "==":
+		return func(i int) bool { return value(i) == v }, nil
+	case "!=":
+		return func(i int) bool { return value(i) != v }, nil
+	default:
+		return func(i int) bool {
+			val := value(i)
+			for _, v := range q.values {
+				if val == v {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+}
+
+var errQueryUnexpectedEnd = errors.New("unexpected end of the query")
+
+// tokenizeQuery splits the query into identifiers, numbers, operators, commas and parentheses.
+func tokenizeQuery(s string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(' || c == ')' || c == ',':
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case c == '<' || c == '>' || c == '=' || c == '!':
+			j := i + 1
+			if j < len(s) && s[j] == '=' {
+				j++
+			}
+			op := s[i:j]
+			switch op {
+			case "=":
+				op = "=="
+			case "!":
+				return nil, errors.New("unexpected '!' in the query")
+			}
+			tokens = append(tokens, op)
+			i = j
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(" \t(),<>=!", s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseQuery parses the query expression.
+// "or" has lower precedence than "and" and "not".
+func parseQuery(s string) (queryNode, error) {
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in the query", p.tokens[p.pos])
+	}
+	return q, nil
+}
+
+func (p *queryParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *queryParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", errQueryUnexpectedEnd
+	}
+	p.pos++
+	return p.tokens[p.pos-1], nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	a, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "or" {
+		p.pos++
+		b, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		a = &queryOr{a, b}
+	}
+	return a, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	a, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "and" {
+		p.pos++
+		b, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		a = &queryAnd{a, b}
+	}
+	return a, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.peek() == "not" {
+		p.pos++
+		a, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{a}, nil
+	}
+	return p.parseTerm()
+}
+
+func (p *queryParser) parseTerm() (queryNode, error) {
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t {
+	case "(":
+		q, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next(); err != nil || t != ")" {
+			return nil, errors.New("missing ')' in the query")
+		}
+		return q, nil
+	case "colored":
+		return &queryColored{}, nil
+	}
+	if !isScriptVarName(t) {
+		return nil, fmt.Errorf("field name is expected but got %q", t)
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	q := &queryCompare{field: t, op: op}
+	switch op {
+	case "<", "<=", ">", ">=", "==", "!=":
+		v, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		q.values = []float64{v}
+	case "in":
+		for {
+			v, err := p.parseNumber()
+			if err != nil {
+				return nil, err
+			}
+			q.values = append(q.values, v)
+			if p.peek() != "," {
+				break
+			}
+			p.pos++
+		}
+	default:
+		return nil, fmt.Errorf("unknown operator %q", op)
+	}
+	return q, nil
+}
+
+func (p *queryParser) parseNumber() (float64, error) {
+	t, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil {
+		return 0, fmt.Errorf("number is expected but got %q", t)
+	}
+	return v, nil
+}
+
+// SelectWhere selects the points in the crop box matching the query.
+// The selection is combined with the current selection by the select operation.
+// Selection mask must be updated before calling it to exclude the cropped points.
+func (c *commandContext) SelectWhere(query string) error {
+	if c.selectMode == selectModeInsert {
+		return errors.New("selection is not available in insert mode")
+	}
+	q, err := parseQuery(query)
+	if err != nil {
+		return err
+	}
+	if err := c.checkSelectMask(); err != nil {
+		return err
+	}
+	match, err := q.bind(&queryEnv{
+		pp:       c.editor.pp,
+		labelMin: c.renderLabelMin,
+		labelMax: c.renderLabelMax,
+	})
+	if err != nil {
+		return err
+	}
+	c.beginMaskSelection()
+	for i, m := range c.selectMask {
+		if m&selectBitmaskCropped == 0 && match(i) {
+			c.selectMask[i] |= selectBitmaskSegmentSelected
+		}
+	}
+	c.endMaskSelection()
+	return nil
+}
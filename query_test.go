@@ -0,0 +1,122 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestTokenizeQuery(t *testing.T) {
+	tokens, err := tokenizeQuery("label in 3,5 and (z>=-1.2 or not intensity!=10) and x=1e-3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"label", "in", "3", ",", "5", "and",
+		"(", "z", ">=", "-1.2", "or", "not", "intensity", "!=", "10", ")",
+		"and", "x", "==", "1e-3",
+	}
+	if !reflect.DeepEqual(expected, tokens) {
+		t.Errorf("Expected %v, got %v", expected, tokens)
+	}
+}
+
+func TestParseQuery_Error(t *testing.T) {
+	for _, q := range []string{
+		"",
+		"label",
+		"label in",
+		"label in 3,",
+		"label ~ 3",
+		"z > a",
+		"(z > 1",
+		"z > 1 z < 2",
+		"z ! 1",
+		"3 > z",
+	} {
+		if _, err := parseQuery(q); err == nil {
+			t.Errorf("Expected error on %q", q)
+		}
+	}
+}
+
+func TestSelectWhere(t *testing.T) {
+	c := &console{cmd: newCommandContext(&dummyPCDIO{}, nil)}
+	// (1, 2, 3) label 0 intensity 0.5, (4, 5, 6) label 1 intensity 0.6, (7, 8, 9) label 2 intensity 0.7
+	if err := c.cmd.editor.SetPointCloud(createPointCloud(t, true), cloudMain); err != nil {
+		t.Fatal(err)
+	}
+	it, err := c.cmd.editor.pp.Float32Iterator("intensity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float32{0.5, 0.6, 0.7} {
+		it.SetFloat32(v)
+		it.Incr()
+	}
+
+	testCases := map[string]struct {
+		query    string
+		cropped  []int
+		expected []int
+	}{
+		"Label":      {query: "label in 0,2", expected: []int{0, 2}},
+		"And":        {query: "label in 0,2 and z > 4", expected: []int{2}},
+		"Or":         {query: "x < 2 or y >= 8", expected: []int{0, 2}},
+		"Not":        {query: "not label == 1", expected: []int{0, 2}},
+		"Precedence": {query: "x < 2 or y > 4 and z < 7", expected: []int{0, 1}},
+		"Paren":      {query: "(x < 2 or y > 4) and z < 7", expected: []int{0, 1}},
+		"Intensity":  {query: "intensity > 0.55", expected: []int{1, 2}},
+		"Crop":       {query: "z > 0", cropped: []int{1}, expected: []int{0, 2}},
+		"Colored":    {query: "colored", expected: []int{1, 2}},
+		"NoMatch":    {query: "z > 100", expected: nil},
+		"Unspaced":   {query: "label=1", expected: []int{1}},
+		"UnspacedEq": {query: "label==2 or x<2", expected: []int{0, 2}},
+		"Quoted":     {query: "'label == 1'", expected: []int{1}},
+	}
+	for name, tt := range testCases {
+		t.Run(name, func(t *testing.T) {
+			mask := make([]uint32, 3)
+			for _, i := range tt.cropped {
+				mask[i] |= selectBitmaskCropped
+			}
+			c.cmd.UnsetCursors()
+			c.cmd.SetSelectMask(mask)
+			if _, err := c.Run("select_where "+tt.query, noUpdate); err != nil {
+				t.Fatal(err)
+			}
+			if c.cmd.SelectMode() != selectModeMask {
+				t.Fatal("Select mode must be mask")
+			}
+			var ids []int
+			for i, m := range c.cmd.SelectMask() {
+				if m&selectBitmaskSegmentSelected != 0 {
+					ids = append(ids, i)
+				}
+			}
+			if !reflect.DeepEqual(tt.expected, ids) {
+				t.Errorf("Expected %v, got %v", tt.expected, ids)
+			}
+		})
+	}
+
+	t.Run("Combine", func(t *testing.T) {
+		c.cmd.UnsetCursors()
+		c.cmd.SetSelectMask(make([]uint32, 3))
+		for _, cmd := range []string{"select_where z > 4", "select_op subtract", "select_where label == 2"} {
+			if _, err := c.Run(cmd, noUpdate); err != nil {
+				t.Fatal(err)
+			}
+		}
+		c.cmd.Delete()
+		expectPointCloud(t, c.cmd.editor.pp, []mat.Vec3{{1, 2, 3}, {7, 8, 9}})
+	})
+
+	t.Run("UnknownField", func(t *testing.T) {
+		c.cmd.SetSelectMask(make([]uint32, c.cmd.editor.pp.Points))
+		if _, err := c.Run("select_where rgb > 0", noUpdate); err == nil {
+			t.Error("Expected error on unknown field")
+		}
+	})
+}
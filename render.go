@@ -0,0 +1,110 @@
+package main
+
+import (
+	"math"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+// Render buffer is the tightly packed copy of the fields fed to the shader.
+// It is used if the editor record can't be rendered directly since vertexAttribPointer
+// requires the stride and the offsets to be multiples of the component size
+// and the stride to be 255 or less.
+const (
+	renderOffsetLabel = 12
+	renderOffsetColor = 16
+)
+
+// renderLayout is the layout of a point in the render buffer:
+// x, y, z, label and the optional color attribute.
+type renderLayout struct {
+	stride   int
+	color    colorField // offset is in the render buffer
+	hasColor bool
+}
+
+func renderLayoutOf(h *pc.PointCloudHeader, m colorMode) (renderLayout, colorField) {
+	l := renderLayout{stride: renderOffsetColor}
+	src, ok := colorFieldOf(h, m)
+	if !ok {
+		return l, colorField{}
+	}
+	l.color = src
+	l.color.offset = renderOffsetColor
+	l.hasColor = true
+	l.stride += (src.size*src.count + 3) / 4 * 4
+	return l, src
+}
+
+// renderBuffer returns the vertices to be uploaded and their layout.
+// The editor record is returned as is if it is aligned,
+// otherwise the cloud is packed into buf which is reused if it has enough capacity.
+func renderBuffer(buf *[]byte, pp *pc.PointCloud, m colorMode) ([]byte, renderLayout) {
+	stride := pp.Stride()
+	if src, ok := colorFieldOf(&pp.PointCloudHeader, m); stride%4 == 0 && stride <= 255 &&
+		(!ok || !src.separate && src.offset%4 == 0) {
+		*buf = nil // release the packed copy
+		return pp.Data[:pp.Points*stride], renderLayout{stride: stride, color: src, hasColor: ok}
+	}
+
+	l, src := renderLayoutOf(&pp.PointCloudHeader, m)
+	n := pp.Points * l.stride
+	if cap(*buf) < n {
+		*buf = make([]byte, n)
+	}
+	out := (*buf)[:n]
+	colorSize := src.size * src.count
+	var shift uint
+	if src.separate {
+		shift = colorChannelShift(pp, src)
+	}
+	for i := 0; i < pp.Points; i++ {
+		s := pp.Data[i*stride : (i+1)*stride]
+		d := out[i*l.stride : (i+1)*l.stride]
+		// x, y, z and label are placed at the beginning of the editor record
+		copy(d[:renderOffsetColor], s)
+		switch {
+		case src.separate:
+			for k, off := range src.channels {
+				v := readNumber(s[off:], src.channelType, src.channelSize) / float64(uint(1)<<shift)
+				d[renderOffsetColor+2-k] = byte(math.Max(0, math.Min(255, v)))
+			}
+			d[renderOffsetColor+3] = 0xFF
+		case l.hasColor:
+			copy(d[renderOffsetColor:], s[src.offset:src.offset+colorSize])
+			clear(d[renderOffsetColor+colorSize:])
+		}
+	}
+	return out, l
+}
+
+// colorChannelShift returns the shift to convert the separate color channels to 8 bits.
+// 16 bits channels (e.g. LAS) are scaled unless all values fit in 8 bits.
+func colorChannelShift(pp *pc.PointCloud, cf colorField) uint {
+	if cf.channelSize == 1 {
+		return 0
+	}
+	stride := pp.Stride()
+	for i := 0; i < pp.Points; i++ {
+		s := pp.Data[i*stride : (i+1)*stride]
+		for _, off := range cf.channels {
+			if readNumber(s[off:], cf.channelType, cf.channelSize) > 255 {
+				return 8
+			}
+		}
+	}
+	return 0
+}
+
+// renderSamplingRatio returns the ratio to thin out the points while dragging.
+// Sampling is done by multiplying the stride which must be 255 or less.
+func renderSamplingRatio(points, maxPoints, stride int) int {
+	r := 1 + points/maxPoints
+	if r*stride > 255 {
+		r = 255 / stride
+	}
+	if r < 1 {
+		r = 1
+	}
+	return r
+}
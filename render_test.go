@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+func TestRenderBuffer(t *testing.T) {
+	header := func(fields []string, size []int, typ []string, count []int) pc.PointCloudHeader {
+		return pc.PointCloudHeader{Fields: fields, Size: size, Type: typ, Count: count}
+	}
+	testCases := map[string]struct {
+		header pc.PointCloudHeader
+		mode   colorMode
+		stride int
+		direct bool // editor record is rendered without copy
+	}{
+		"IntensityU1": {
+			header: header(
+				[]string{"x", "y", "z", "intensity"}, []int{4, 4, 4, 1},
+				[]string{"F", "F", "F", "U"}, []int{1, 1, 1, 1},
+			),
+			mode:   colorModeIntensity,
+			stride: 20,
+		},
+		"IntensityU2Ring": {
+			header: header(
+				[]string{"x", "y", "z", "intensity", "ring"}, []int{4, 4, 4, 2, 2},
+				[]string{"F", "F", "F", "U", "U"}, []int{1, 1, 1, 1, 1},
+			),
+			mode:   colorModeIntensity,
+			stride: 20,
+			direct: true,
+		},
+		"AlignedRGB": {
+			header: header(
+				[]string{"x", "y", "z", "rgb"}, []int{4, 4, 4, 4},
+				[]string{"F", "F", "F", "F"}, []int{1, 1, 1, 1},
+			),
+			mode:   colorModeRGB,
+			stride: 20,
+			direct: true,
+		},
+		"XYZ": {
+			header: header(
+				[]string{"x", "y", "z"}, []int{4, 4, 4},
+				[]string{"F", "F", "F"}, []int{1, 1, 1},
+			),
+			mode:   colorModeZ,
+			stride: 16,
+			direct: true,
+		},
+		"PackedRGBAfterByte": {
+			header: header(
+				[]string{"x", "y", "z", "classification", "rgb"}, []int{4, 4, 4, 1, 4},
+				[]string{"F", "F", "F", "U", "F"}, []int{1, 1, 1, 1, 1},
+			),
+			mode:   colorModeRGB,
+			stride: 20,
+		},
+		"Descriptor": {
+			header: header(
+				[]string{"x", "y", "z", "fpfh", "intensity"}, []int{4, 4, 4, 4, 2},
+				[]string{"F", "F", "F", "F", "U"}, []int{1, 1, 1, 33, 1},
+			),
+			mode:   colorModeIntensity,
+			stride: 20,
+		},
+		"NoColor": {
+			header: header(
+				[]string{"x", "y", "z", "fpfh"}, []int{4, 4, 4, 4},
+				[]string{"F", "F", "F", "F"}, []int{1, 1, 1, 352},
+			),
+			mode:   colorModeZ,
+			stride: 16,
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			h, err := editorHeader(&tt.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pp := &pc.PointCloud{PointCloudHeader: h, Points: 3}
+			pp.Data = make([]byte, pp.Points*pp.Stride())
+			for i := range pp.Data {
+				pp.Data[i] = byte(i)
+			}
+
+			var packed []byte
+			buf, l := renderBuffer(&packed, pp, tt.mode)
+			if direct := &buf[0] == &pp.Data[0]; direct != tt.direct {
+				t.Errorf("Expected direct rendering %v, got %v", tt.direct, direct)
+			}
+			if l.stride != tt.stride {
+				t.Errorf("Expected stride %d, got %d", tt.stride, l.stride)
+			}
+			if l.stride%4 != 0 {
+				t.Errorf("Stride %d must be a multiple of 4", l.stride)
+			}
+			if l.hasColor && l.color.offset%4 != 0 {
+				t.Errorf("Color offset %d must be a multiple of 4", l.color.offset)
+			}
+			if len(buf) != pp.Points*l.stride {
+				t.Fatalf("Expected %d bytes, got %d", pp.Points*l.stride, len(buf))
+			}
+			for i := 0; i < pp.Points; i++ {
+				d := buf[i*l.stride:]
+				// x, y, z and label
+				if s := pp.Data[i*pp.Stride():]; !bytes.Equal(d[:renderOffsetColor], s[:renderOffsetColor]) {
+					t.Errorf("Position and label are not copied at %d", i)
+				}
+				if l.hasColor {
+					src, _ := colorFieldOf(&pp.PointCloudHeader, tt.mode)
+					n := src.size * src.count
+					s := pp.Data[i*pp.Stride()+src.offset:]
+					for k := 0; k < n; k++ {
+						if d[l.color.offset+k] != s[k] {
+							t.Fatalf("Color field is not copied at %d", i)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRenderSamplingRatio(t *testing.T) {
+	if r := renderSamplingRatio(100, 10, 16); r != 11 {
+		t.Errorf("Expected 11, got %d", r)
+	}
+	if r := renderSamplingRatio(1000, 10, 28); r*28 > 255 {
+		t.Errorf("Sampled stride %d must be 255 or less", r*28)
+	}
+	if r := renderSamplingRatio(1000, 10, 300); r != 1 {
+		t.Errorf("Expected 1 for too large stride, got %d", r)
+	}
+}
+
+func TestRenderBuffer_SeparateRGB(t *testing.T) {
+	var las bytes.Buffer
+	if err := marshalPointCloud(createLASTestCloud(t, []uint32{0, 1, 2}), &las, formatOptions{format: formatLAS}); err != nil {
+		t.Fatal(err)
+	}
+	ply := "ply\nformat ascii 1.0\nelement vertex 2\n" +
+		"property float x\nproperty float y\nproperty float z\n" +
+		"property uchar red\nproperty uchar green\nproperty uchar blue\n" +
+		"end_header\n" +
+		"0 0 0 255 128 0\n" +
+		"1 1 1 10 20 30\n"
+
+	testCases := map[string]struct {
+		data     []byte
+		expected [][4]byte // B, G, R, A
+	}{
+		// 16 bits colors are scaled to 8 bits
+		"LAS": {
+			data:     las.Bytes(),
+			expected: [][4]byte{{0, 0, 255, 255}, {0, 1, 255, 255}, {0, 2, 255, 255}},
+		},
+		"PLY": {
+			data:     []byte(ply),
+			expected: [][4]byte{{0, 128, 255, 255}, {30, 20, 10, 255}},
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			pp, err := unmarshalPointCloud(bytes.NewReader(tt.data), formatOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := newCommandContext(&dummyPCDIO{}, nil)
+			if err := c.editor.SetPointCloud(pp, cloudMain); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.SetColorMode(colorModeRGB); err != nil {
+				t.Fatal(err)
+			}
+			var packed []byte
+			buf, l := renderBuffer(&packed, c.editor.pp, colorModeRGB)
+			if !l.hasColor || l.stride != 20 {
+				t.Fatalf("Expected color attribute with stride 20, got %+v", l)
+			}
+			for i, e := range tt.expected {
+				var rgb [4]byte
+				copy(rgb[:], buf[i*l.stride+renderOffsetColor:])
+				if rgb != e {
+					t.Errorf("Expected color %v at %d, got %v", e, i, rgb)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	errScriptUnexpectedEnd = errors.New("unexpected end")
+	errScriptUnclosedFor   = errors.New("for without end")
+	errScriptForSyntax     = errors.New("invalid for syntax (for NAME in ITEM...)")
+	errScriptSetSyntax     = errors.New("invalid set syntax (set NAME VALUE...)")
+)
+
+type scriptStmt struct {
+	line int
+	args []consoleToken
+	body []scriptStmt // body of the for loop
+}
+
+type scriptError struct {
+	line int
+	err  error
+}
+
+func (e *scriptError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.line, e.err)
+}
+
+func (e *scriptError) Unwrap() error {
+	return e.err
+}
+
+func parseScript(script string) ([]scriptStmt, error) {
+	// Root frame and the for loops currently open.
+	stack := []*scriptStmt{{}}
+	for i, l := range strings.Split(script, "\n") {
+		args, err := tokenizeConsole(l)
+		if err != nil {
+			return nil, &scriptError{line: i + 1, err: err}
+		}
+		if len(args) == 0 {
+			continue
+		}
+		cur := stack[len(stack)-1]
+		switch scriptKeyword(args[0]) {
+		case "for":
+			if len(args) < 4 || scriptKeyword(args[2]) != "in" || !isScriptVarName(scriptKeyword(args[1])) {
+				return nil, &scriptError{line: i + 1, err: errScriptForSyntax}
+			}
+			stack = append(stack, &scriptStmt{line: i + 1, args: args})
+			continue
+		case "end":
+			if len(args) != 1 || len(stack) == 1 {
+				return nil, &scriptError{line: i + 1, err: errScriptUnexpectedEnd}
+			}
+			stack = stack[:len(stack)-1]
+			parent := stack[len(stack)-1]
+			parent.body = append(parent.body, *cur)
+			continue
+		case "set":
+			if len(args) < 3 || !isScriptVarName(scriptKeyword(args[1])) {
+				return nil, &scriptError{line: i + 1, err: errScriptSetSyntax}
+			}
+		}
+		cur.body = append(cur.body, scriptStmt{line: i + 1, args: args})
+	}
+	if len(stack) > 1 {
+		return nil, &scriptError{line: stack[len(stack)-1].line, err: errScriptUnclosedFor}
+	}
+	return stack[0].body, nil
+}
+
+// scriptKeyword returns the value of the token if it can be a keyword or a name.
+func scriptKeyword(t consoleToken) string {
+	if t.key != "" || t.quoted {
+		return ""
+	}
+	return t.value
+}
+
+func isScriptVarName(s string) bool {
+	for i, r := range s {
+		switch {
+		case r == '_', 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z':
+		case i > 0 && '0' <= r && r <= '9':
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// RunScript runs multi-line console commands as a batch and stops at the first error.
+// Results of the commands are returned in the order of execution.
+//
+//	# comment
+//	set res 0.1                # define variable
+//	for p in 1,2,0 3,4,0 $pts  # loop over space separated items
+//	  cursor $p                # comma separated numbers are expanded to arguments
+//	end
+//	voxel_grid $res
+func (c *console) RunScript(script string, updateSel updateSelectionFn) ([]interface{}, error) {
+	stmts, err := parseScript(script)
+	if err != nil {
+		return nil, err
+	}
+	var res []interface{}
+	vars := make(map[string][]string)
+	if err := c.runScriptStmts(stmts, vars, &res, updateSel); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func (c *console) runScriptStmts(stmts []scriptStmt, vars map[string][]string, res *[]interface{}, updateSel updateSelectionFn) error {
+	for _, s := range stmts {
+		args, err := expandScriptVars(s.args, vars)
+		if err != nil {
+			return &scriptError{line: s.line, err: err}
+		}
+		switch scriptKeyword(s.args[0]) {
+		case "set":
+			vars[s.args[1].value] = tokenValues(args[2:])
+		case "for":
+			for _, item := range tokenValues(args[3:]) {
+				vars[s.args[1].value] = []string{item}
+				if err := c.runScriptStmts(s.body, vars, res, updateSel); err != nil {
+					return err
+				}
+			}
+		default:
+			cmd := args
+			if !isRawCommand(args[0].value) {
+				cmd = expandNumberLists(args)
+			}
+			r, err := c.runTokens(cmd, updateSel)
+			if err != nil {
+				return &scriptError{line: s.line, err: err}
+			}
+			*res = append(*res, r)
+		}
+	}
+	return nil
+}
+
+// isRawCommand returns true if the command takes the arguments as they are written
+// like the query of select_where.
+func isRawCommand(name string) bool {
+	cmd, ok := consoleCommands[name]
+	if !ok {
+		return false
+	}
+	for _, u := range cmd.usages {
+		if u.raw() {
+			return true
+		}
+	}
+	return false
+}
+
+// expandNumberLists expands the comma separated numbers to the arguments.
+// Other arguments are kept as they are.
+func expandNumberLists(args []consoleToken) []consoleToken {
+	var out []consoleToken
+	for _, a := range args {
+		if a.quoted || a.key != "" || !strings.Contains(a.value, ",") {
+			out = append(out, a)
+			continue
+		}
+		var vs []consoleToken
+		for _, v := range strings.Split(a.value, ",") {
+			if v == "" {
+				continue
+			}
+			if _, err := strconv.ParseFloat(v, 32); err != nil {
+				vs = nil
+				break
+			}
+			vs = append(vs, consoleToken{value: v})
+		}
+		if vs == nil {
+			out = append(out, a)
+			continue
+		}
+		out = append(out, vs...)
+	}
+	return out
+}
+
+func tokenValues(ts []consoleToken) []string {
+	out := make([]string, len(ts))
+	for i, t := range ts {
+		out[i] = t.value
+	}
+	return out
+}
+
+// expandScriptVars replaces $NAME by the value of the variable.
+// Multiple values are expanded to multiple arguments if $NAME is a whole argument,
+// or joined by comma if $NAME is a part of the comma separated value.
+// Quoted arguments are not expanded.
+func expandScriptVars(args []consoleToken, vars map[string][]string) ([]consoleToken, error) {
+	lookup := func(a string) ([]string, error) {
+		v, ok := vars[a[1:]]
+		if !ok {
+			return nil, fmt.Errorf("undefined variable %s", a)
+		}
+		return v, nil
+	}
+	out := make([]consoleToken, 0, len(args))
+	for i, a := range args {
+		if a.quoted || !strings.Contains(a.value, "$") || (i == 1 && (scriptKeyword(args[0]) == "set" || scriptKeyword(args[0]) == "for")) {
+			out = append(out, a)
+			continue
+		}
+		if a.key == "" && strings.HasPrefix(a.value, "$") && !strings.Contains(a.value, ",") {
+			v, err := lookup(a.value)
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range v {
+				out = append(out, consoleToken{value: s})
+			}
+			continue
+		}
+		parts := strings.Split(a.value, ",")
+		for j, p := range parts {
+			if strings.HasPrefix(p, "$") {
+				v, err := lookup(p)
+				if err != nil {
+					return nil, err
+				}
+				parts[j] = strings.Join(v, ",")
+			}
+		}
+		a.value = strings.Join(parts, ",")
+		out = append(out, a)
+	}
+	return out, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestConsole_RunScript(t *testing.T) {
+	t.Run("VariablesAndLoop", func(t *testing.T) {
+		c := &console{
+			cmd: newCommandContext(nil, nil),
+		}
+		res, err := c.RunScript(`
+# place cursors
+set z 1
+set pts 1,2,$z 3,4,$z
+for p in 0,0,$z $pts
+  cursor $p # comment after command
+end
+select_range 0.5
+`, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res) != 4 {
+			t.Fatalf("Expected 4 results, got: %v", res)
+		}
+		expected := []mat.Vec3{{0, 0, 1}, {1, 2, 1}, {3, 4, 1}}
+		if cursors := c.cmd.Cursors(); !reflect.DeepEqual(expected, cursors) {
+			t.Errorf("Expected cursors: %v, got: %v", expected, cursors)
+		}
+		if r := c.cmd.SelectRange(rangeTypeAuto); r != 0.5 {
+			t.Errorf("Expected select range: 0.5, got: %f", r)
+		}
+	})
+	t.Run("NestedLoop", func(t *testing.T) {
+		c := &console{
+			cmd: newCommandContext(nil, nil),
+		}
+		if _, err := c.RunScript(`
+for x in 1 2
+  for y in 3 4
+    cursor $x $y 0
+  end
+end
+`, nil); err != nil {
+			t.Fatal(err)
+		}
+		expected := []mat.Vec3{{1, 3, 0}, {1, 4, 0}, {2, 3, 0}, {2, 4, 0}}
+		if cursors := c.cmd.Cursors(); !reflect.DeepEqual(expected, cursors) {
+			t.Errorf("Expected cursors: %v, got: %v", expected, cursors)
+		}
+	})
+	t.Run("QueryList", func(t *testing.T) {
+		c := &console{cmd: newCommandContext(&dummyPCDIO{}, nil)}
+		// (1, 2, 3) label 0, (4, 5, 6) label 1, (7, 8, 9) label 2
+		if err := c.cmd.editor.SetPointCloud(createPointCloud(t, false), cloudMain); err != nil {
+			t.Fatal(err)
+		}
+		c.cmd.SetSelectMask(make([]uint32, 3))
+		if _, err := c.RunScript(`
+set labels 0,2
+select_where label in $labels and x < 5
+delete
+`, noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, []mat.Vec3{{4, 5, 6}, {7, 8, 9}})
+	})
+	t.Run("Errors", func(t *testing.T) {
+		testCases := map[string]struct {
+			script  string
+			err     error
+			line    int
+			cursors int
+		}{
+			"InvalidCommand": {
+				script:  "cursor 1 2 3\nfoo\ncursor 4 5 6",
+				err:     errInvalidCommand,
+				line:    2,
+				cursors: 1,
+			},
+			"UndefinedVariable": {
+				script: "\n\ncursor $p",
+				line:   3,
+			},
+			"UnclosedFor": {
+				script: "cursor 1 2 3\nfor p in 1\ncursor $p 0 0",
+				err:    errScriptUnclosedFor,
+				line:   2,
+			},
+			"UnexpectedEnd": {
+				script: "end",
+				err:    errScriptUnexpectedEnd,
+				line:   1,
+			},
+			"InvalidFor": {
+				script: "for p 1 2",
+				err:    errScriptForSyntax,
+				line:   1,
+			},
+		}
+		for name, tt := range testCases {
+			tt := tt
+			t.Run(name, func(t *testing.T) {
+				c := &console{
+					cmd: newCommandContext(nil, nil),
+				}
+				_, err := c.RunScript(tt.script, nil)
+				var se *scriptError
+				if !errors.As(err, &se) {
+					t.Fatalf("Expected scriptError, got: %v", err)
+				}
+				if se.line != tt.line {
+					t.Errorf("Expected error at line %d, got: %v", tt.line, err)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Errorf("Expected %v, got: %v", tt.err, err)
+				}
+				if n := len(c.cmd.Cursors()); n != tt.cursors {
+					t.Errorf("Expected %d cursors, got: %d", tt.cursors, n)
+				}
+			})
+		}
+	})
+}
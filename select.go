@@ -13,6 +13,7 @@ const (
 	selectBitmaskNearCursor      = 0x00000004
 	selectBitmaskOnScreen        = 0x00000008
 	selectBitmaskExclude         = 0x80000000
+	selectBitmaskPrevSelected    = 0x40000000
 	selectBitmaskSegmentSelected = 0x00000010
 )
 
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+// selectOp is the operation to combine the new selection with the current mask selection.
+type selectOp int
+
+const (
+	selectOpReplace selectOp = iota
+	selectOpAdd
+	selectOpSubtract
+	selectOpIntersect
+)
+
+var selectOpNames = []string{"replace", "add", "subtract", "intersect"}
+
+func (o selectOp) String() string {
+	return selectOpNames[o]
+}
+
+func (o selectOp) apply(prev, cur bool) bool {
+	switch o {
+	case selectOpAdd:
+		return prev || cur
+	case selectOpSubtract:
+		return prev && !cur
+	case selectOpIntersect:
+		return prev && cur
+	default:
+		return cur
+	}
+}
+
+var errSelectMaskNotUpdated = errors.New("selection mask is not updated")
+
+func (c *commandContext) SelectOp() selectOp {
+	return c.selectOp
+}
+
+func (c *commandContext) SetSelectOp(o selectOp) {
+	c.selectOp = o
+}
+
+// HasMaskSelection returns true if the mask selection is kept to be combined
+// with the next selection.
+func (c *commandContext) HasMaskSelection() bool {
+	return c.hasMaskSelection
+}
+
+func (c *commandContext) checkSelectMask() error {
+	if c.editor.pp == nil {
+		return errors.New("no pointcloud")
+	}
+	if len(c.selectMask) != c.editor.pp.Points {
+		return errSelectMaskNotUpdated
+	}
+	return nil
+}
+
+// beginMaskSelection moves the current mask selection to selectBitmaskPrevSelected
+// and clears selectBitmaskSegmentSelected to store the new selection.
+func (c *commandContext) beginMaskSelection() {
+	c.invalidateSelectMask()
+	for i, m := range c.selectMask {
+		m &= ^uint32(selectBitmaskPrevSelected)
+		if c.hasMaskSelection && m&selectBitmaskSegmentSelected != 0 {
+			m |= selectBitmaskPrevSelected
+		}
+		c.selectMask[i] = m & ^uint32(selectBitmaskSegmentSelected)
+	}
+}
+
+// endMaskSelection combines the new selection with the previous one by the select operation.
+func (c *commandContext) endMaskSelection() {
+	c.combineMaskSelection(c.selectOp)
+	c.UnsetCursors()
+	c.selectMode = selectModeMask
+	c.hasMaskSelection = true
+}
+
+// abortMaskSelection restores the previous selection.
+func (c *commandContext) abortMaskSelection() {
+	for i, m := range c.selectMask {
+		m &= ^uint32(selectBitmaskSegmentSelected)
+		if m&selectBitmaskPrevSelected != 0 {
+			m |= selectBitmaskSegmentSelected
+		}
+		c.selectMask[i] = m & ^uint32(selectBitmaskPrevSelected)
+	}
+}
+
+func (c *commandContext) combineMaskSelection(o selectOp) {
+	for i, m := range c.selectMask {
+		prev := m&selectBitmaskPrevSelected != 0
+		cur := m&selectBitmaskSegmentSelected != 0
+		m &= ^uint32(selectBitmaskPrevSelected | selectBitmaskSegmentSelected)
+		if o.apply(prev, cur) {
+			m |= selectBitmaskSegmentSelected
+		}
+		c.selectMask[i] = m
+	}
+}
+
+// clearMaskSelection leaves the mask selection mode.
+func (c *commandContext) clearMaskSelection() {
+	if c.selectMode == selectModeMask {
+		c.selectMode = selectModeRect
+	}
+	c.hasMaskSelection = false
+}
+
+// SelectBox converts the rectangle or box selection into the mask selection.
+func (c *commandContext) SelectBox() error {
+	if _, ok := c.SelectMatrix(); !ok || c.selectMode != selectModeRect {
+		return errors.New("rectangle or box is not selected")
+	}
+	if err := c.checkSelectMask(); err != nil {
+		return err
+	}
+	c.beginMaskSelection()
+	for i, m := range c.selectMask {
+		if m&(selectBitmaskCropped|selectBitmaskSelected) == selectBitmaskSelected {
+			c.selectMask[i] |= selectBitmaskSegmentSelected
+		}
+	}
+	c.endMaskSelection()
+	return nil
+}
+
+// InvertSelection selects the points in the crop box not selected.
+// Rectangle or box selection is inverted while it is drawn.
+func (c *commandContext) InvertSelection() error {
+	if c.selectMode == selectModeInsert {
+		return errors.New("selection is not available in insert mode")
+	}
+	if err := c.checkSelectMask(); err != nil {
+		return err
+	}
+	bit := uint32(0)
+	switch {
+	case c.selectMode == selectModeMask:
+		bit = selectBitmaskSegmentSelected
+	case len(c.selected) >= 3:
+		bit = selectBitmaskSelected
+	}
+	c.invalidateSelectMask()
+	for i, m := range c.selectMask {
+		selected := m&bit != 0
+		m &= ^uint32(selectBitmaskSegmentSelected)
+		if !selected && m&selectBitmaskCropped == 0 {
+			m |= selectBitmaskSegmentSelected
+		}
+		c.selectMask[i] = m
+	}
+	c.UnsetCursors()
+	c.selectMode = selectModeMask
+	c.hasMaskSelection = true
+	return nil
+}
+
+// selectedIndice returns the indices of the points selected by the rectangle, box or mask.
+func (c *commandContext) selectedIndice() ([]int, error) {
+	var filter func(int, mat.Vec3) bool
+	switch c.SelectMode() {
+	case selectModeRect:
+		if _, ok := c.SelectMatrix(); ok {
+			filter = c.baseFilter(true)
+		}
+	case selectModeMask:
+		filter = c.baseFilterByMask(true)
+	}
+	if filter == nil {
+		return nil, errNoSelection
+	}
+	if err := c.checkSelectMask(); err != nil {
+		return nil, err
+	}
+	it, err := c.editor.pp.Vec3Iterator()
+	if err != nil {
+		return nil, err
+	}
+	var indice []int
+	for i := 0; i < c.editor.pp.Points; i++ {
+		if filter(i, it.Vec3At(i)) {
+			indice = append(indice, i)
+		}
+	}
+	if len(indice) == 0 {
+		return nil, errNoSelection
+	}
+	return indice, nil
+}
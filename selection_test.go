@@ -0,0 +1,142 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestSelectOp(t *testing.T) {
+	expected := map[selectOp][4]bool{
+		// prev/cur: false/false, false/true, true/false, true/true
+		selectOpReplace:   {false, true, false, true},
+		selectOpAdd:       {false, true, true, true},
+		selectOpSubtract:  {false, false, true, false},
+		selectOpIntersect: {false, false, false, true},
+	}
+	for o, e := range expected {
+		for i, res := range e {
+			if got := o.apply(i&2 != 0, i&1 != 0); got != res {
+				t.Errorf("%s(prev: %v, cur: %v): expected %v, got %v", o, i&2 != 0, i&1 != 0, res, got)
+			}
+		}
+	}
+}
+
+func TestSelectionAlgebra(t *testing.T) {
+	c := &console{cmd: newCommandContext(&dummyPCDIO{}, nil)}
+	if err := c.cmd.editor.SetPointCloud(createPointCloud(t, false), cloudMain); err != nil {
+		t.Fatal(err)
+	}
+
+	selected := func() []int {
+		t.Helper()
+		if c.cmd.SelectMode() != selectModeMask {
+			t.Fatal("Select mode must be mask")
+		}
+		var ids []int
+		for i, m := range c.cmd.SelectMask() {
+			if m&selectBitmaskSegmentSelected != 0 {
+				ids = append(ids, i)
+			}
+			if m&selectBitmaskPrevSelected != 0 {
+				t.Errorf("Temporary bit must be cleared at %d", i)
+			}
+		}
+		return ids
+	}
+	// selectBox emulates drawing the box and GPU scan keeping selectBitmaskSegmentSelected bits
+	selectBox := func(op string, box ...int) {
+		t.Helper()
+		for i, p := range []mat.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 1, 0}} {
+			c.cmd.SetCursor(i, p)
+		}
+		mask := c.cmd.SelectMask()
+		if mask == nil {
+			mask = make([]uint32, 3)
+		}
+		for i := range mask {
+			mask[i] &= selectBitmaskSegmentSelected
+		}
+		for _, i := range box {
+			mask[i] |= selectBitmaskSelected
+		}
+		c.cmd.SetSelectMask(mask)
+		if _, err := c.Run("select_op "+op, noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Run("select_box", noUpdate); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := c.Run("select_box", noUpdate); err == nil {
+		t.Error("Expected error without box")
+	}
+
+	selectBox("replace", 0, 1)
+	if ids := selected(); !reflect.DeepEqual([]int{0, 1}, ids) {
+		t.Errorf("Expected [0 1], got %v", ids)
+	}
+	selectBox("subtract", 1, 2)
+	if ids := selected(); !reflect.DeepEqual([]int{0}, ids) {
+		t.Errorf("Expected [0], got %v", ids)
+	}
+	selectBox("add", 2)
+	if ids := selected(); !reflect.DeepEqual([]int{0, 2}, ids) {
+		t.Errorf("Expected [0 2], got %v", ids)
+	}
+	selectBox("intersect", 0, 1)
+	if ids := selected(); !reflect.DeepEqual([]int{0}, ids) {
+		t.Errorf("Expected [0], got %v", ids)
+	}
+	res, err := c.Run("select_op", noUpdate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual([]string{"intersect"}, res) {
+		t.Errorf("Expected [intersect], got %v", res)
+	}
+
+	c.cmd.SelectMask()[1] |= selectBitmaskCropped
+	if _, err := c.Run("select_invert", noUpdate); err != nil {
+		t.Fatal(err)
+	}
+	if ids := selected(); !reflect.DeepEqual([]int{2}, ids) {
+		t.Errorf("Cropped points must not be selected by invert, expected [2], got %v", ids)
+	}
+	c.cmd.SelectMask()[1] &= ^uint32(selectBitmaskCropped)
+
+	// Unset clears the selection to be combined
+	c.cmd.UnsetCursors()
+	selectBox("add", 1)
+	if ids := selected(); !reflect.DeepEqual([]int{1}, ids) {
+		t.Errorf("Expected [1], got %v", ids)
+	}
+
+	if !c.cmd.Label(3) {
+		t.Fatal("Label failed")
+	}
+	if !c.cmd.HasMaskSelection() {
+		t.Error("Selection must be kept after labeling")
+	}
+	if err := c.cmd.Delete(); err != nil {
+		t.Fatal(err)
+	}
+	if c.cmd.HasMaskSelection() || c.cmd.SelectMode() != selectModeRect {
+		t.Error("Selection must be cleared after deleting")
+	}
+	expectPointCloud(t, c.cmd.editor.pp, []mat.Vec3{{1, 2, 3}, {7, 8, 9}})
+
+	// Undo restoring the deleted point shifts the indices
+	c.cmd.SetSelectMask([]uint32{0, selectBitmaskSegmentSelected})
+	c.cmd.selectMode = selectModeMask
+	c.cmd.hasMaskSelection = true
+	if !c.cmd.Undo() {
+		t.Fatal("Undo failed")
+	}
+	if c.cmd.HasMaskSelection() || c.cmd.SelectMode() != selectModeRect || c.cmd.SelectMask() != nil {
+		t.Error("Selection must be cleared after undo changing the number of the points")
+	}
+}
@@ -66,3 +66,17 @@ func enableVertexAttribs(gl *webgl.WebGL, attrs ...int) func() {
 		}
 	}
 }
+
+func colorFieldGLType(gl *webgl.WebGL, cf colorField) webgl.Type {
+	if cf.typ == "F" {
+		return gl.FLOAT
+	}
+	switch cf.size {
+	case 1:
+		return gl.UNSIGNED_BYTE
+	case 2:
+		return gl.UNSIGNED_SHORT
+	default:
+		return gl.UNSIGNED_INT
+	}
+}
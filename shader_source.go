@@ -4,6 +4,7 @@ const vsSource = `#version 300 es
 	layout (location = 0) in vec4 aVertexPosition;
 	layout (location = 1) in uint aVertexLabel;
 	layout (location = 2) in uint aSelectMask;
+	layout (location = 3) in vec4 aColorField;
 	uniform mat4 uModelViewMatrix;
 	uniform mat4 uProjectionMatrix;
 	uniform mat4 uSelectMatrix;
@@ -14,6 +15,12 @@ const vsSource = `#version 300 es
 	uniform int uUseSelectMask;
 	uniform uint uMinLabel;
 	uniform uint uMaxLabel;
+	uniform int uColorMode; // 0: label, 1: z, 2: intensity, 3: rgb, 4: normal
+	uniform int uColormap;  // 0: viridis, 1: jet, 2: gray
+	uniform float uIntensityMin;
+	uniform float uIntensityRange;
+	uniform sampler2D uLabelPalette;
+	uniform uint uLabelPaletteSize;
 	vec4 viewPosition;
 	vec4 selectPosition;
 	vec4 cropPosition;
@@ -21,33 +28,31 @@ const vsSource = `#version 300 es
 	lowp float cSelected;
 	out lowp vec4 vColor;
 
-	vec4 label2color(int label) {
-		int idx = label % 20;
-		vec3 c;
-		if (idx == 0) c = vec3(128.0, 128.0, 128.0);
-		else if (idx == 1) c = vec3(60.0, 180.0, 75.0);
-		else if (idx == 2) c = vec3(230.0, 25.0, 75.0);
-		else if (idx == 3) c = vec3(255.0, 225.0, 25.0);
-		else if (idx == 4) c = vec3(67.0, 99.0, 216.0);
-		else if (idx == 5) c = vec3(245.0, 130.0, 49.0);
-		else if (idx == 6) c = vec3(145.0, 30.0, 180.0);
-		else if (idx == 7) c = vec3(70.0, 240.0, 240.0);
-		else if (idx == 8) c = vec3(240.0, 50.0, 230.0);
-		else if (idx == 9) c = vec3(188.0, 246.0, 12.0);
-		else if (idx == 10) c = vec3(250.0, 190.0, 190.0);
-		else if (idx == 11) c = vec3(0.0, 128.0, 128.0);
-		else if (idx == 12) c = vec3(230.0, 190.0, 255.0);
-		else if (idx == 13) c = vec3(154.0, 99.0, 36.0);
-		else if (idx == 14) c = vec3(255.0, 250.0, 200.0);
-		else if (idx == 15) c = vec3(128.0, 0.0, 0.0);
-		else if (idx == 16) c = vec3(170.0, 255.0, 195.0);
-		else if (idx == 17) c = vec3(128.0, 128.0, 0.0);
-		else if (idx == 18) c = vec3(255.0, 216.0, 177.0);
-		else if (idx == 19) c = vec3(0.0, 0.0, 117.0);
-		else c = vec3(128.0, 128.0, 128.0);
-		c = mix(c, vec3(255.0, 255.0, 255.0), cSelected);
-		c /= 255.0;
-		return vec4(c, 1.0);
+	vec4 label2color(uint label) {
+		vec3 color = texelFetch(uLabelPalette, ivec2(int(label % uLabelPaletteSize), 0), 0).rgb;
+		return vec4(mix(color, vec3(1.0), cSelected), 1.0);
+	}
+
+	vec3 viridis(float t) {
+		// Polynomial approximation of matplotlib viridis
+		const vec3 c0 = vec3(0.2777, 0.0054, 0.3341);
+		const vec3 c1 = vec3(0.1051, 1.4046, 1.3846);
+		const vec3 c2 = vec3(-0.3309, 0.2148, 0.0951);
+		const vec3 c3 = vec3(-4.6342, -5.7991, -19.3324);
+		const vec3 c4 = vec3(6.2283, 14.1799, 56.6906);
+		const vec3 c5 = vec3(4.7764, -13.7451, -65.3530);
+		const vec3 c6 = vec3(-5.4355, 4.6459, 26.3124);
+		return c0 + t * (c1 + t * (c2 + t * (c3 + t * (c4 + t * (c5 + t * c6)))));
+	}
+
+	vec3 colormap(float t) {
+		t = clamp(t, 0.0, 1.0);
+		if (uColormap == 1) {
+			return clamp(vec3(1.5) - abs(4.0 * t - vec3(3.0, 2.0, 1.0)), 0.0, 1.0);
+		} else if (uColormap == 2) {
+			return vec3(t);
+		}
+		return viridis(t);
 	}
 
 	void main(void) {
@@ -70,25 +75,29 @@ const vsSource = `#version 300 es
 			gl_PointSize = uPointSizeBase / 20.0;
 		}
 
-		if (uUseSelectMask == 0) {
+		// uUseSelectMask: 0: select box, 1: select mask, 2: both
+		cSelected = 0.0;
+		if (uUseSelectMask != 1) {
 			selectPosition = uSelectMatrix * aVertexPosition;
 			if (uSelectMatrix[3][3] == 1.0 &&
 					all(lessThanEqual(vec3(0, 0, 0), vec3(selectPosition))) &&
 					all(lessThanEqual(vec3(selectPosition), vec3(1.0, 1.0, 1.0)))) {
 				cSelected = 0.5;
-			} else {
-				cSelected = 0.0;
-			}
-		} else {
-			if ((aSelectMask & 0x10u) != 0u) {
-				cSelected = 0.5;
-			} else {
-				cSelected = 0.0;
 			}
 		}
+		if (uUseSelectMask != 0 && (aSelectMask & 0x10u) != 0u) {
+			cSelected = 0.5;
+		}
 
-		if (aVertexLabel >= uMinLabel && aVertexLabel <= uMaxLabel) {
-			vColor = label2color(int(aVertexLabel));
+		if (uColorMode == 0 && aVertexLabel >= uMinLabel && aVertexLabel <= uMaxLabel) {
+			vColor = label2color(aVertexLabel);
+		} else if (uColorMode == 2) {
+			vColor = vec4(mix(colormap((aColorField[0] - uIntensityMin) / uIntensityRange), vec3(1.0), cSelected), 1.0);
+		} else if (uColorMode == 3) {
+			// rgb field is fed as B, G, R, A bytes
+			vColor = vec4(mix(aColorField.zyx, vec3(1.0), cSelected), 1.0);
+		} else if (uColorMode == 4) {
+			vColor = vec4(mix(aColorField.xyz * 0.5 + 0.5, vec3(1.0), cSelected), 1.0);
 		} else {
 			c = (aVertexPosition[2] - uZMin) / uZRange;
 			vColor = vec4(c, cSelected, 1.0 - c, 1.0);
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/seqsense/pcgol/pc"
+)
+
+var errTextNoXYZ = errors.New("x, y and z columns are required")
+
+// textOptions is the options to read delimited text formats.
+type textOptions struct {
+	columns   []string // field names of the columns ("_" to ignore), or nil to use the header row or the defaults
+	delimiter string   // empty to split by commas, semicolons, tabs or spaces
+	skipRows  int      // number of rows to skip before the header or the data
+}
+
+// defaultTextColumns returns the column names of text files without a header row.
+func defaultTextColumns(n int) []string {
+	switch n {
+	case 3:
+		return []string{"x", "y", "z"}
+	case 4:
+		return []string{"x", "y", "z", "intensity"}
+	case 6:
+		return []string{"x", "y", "z", "red", "green", "blue"}
+	case 7:
+		return []string{"x", "y", "z", "intensity", "red", "green", "blue"}
+	}
+	cols := []string{"x", "y", "z"}
+	for i := 3; i < n; i++ {
+		cols = append(cols, "_")
+	}
+	return cols
+}
+
+func textFieldType(name string) (string, int) {
+	if name == "label" {
+		return "U", 4
+	}
+	return "F", 4
+}
+
+func splitTextRow(line, delimiter string) []string {
+	if delimiter == "" {
+		return strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ';' || r == ' ' || r == '\t'
+		})
+	}
+	s := strings.Split(line, delimiter)
+	for i := range s {
+		s[i] = strings.TrimSpace(s[i])
+	}
+	return s
+}
+
+func isNumericRow(tokens []string) bool {
+	for _, t := range tokens {
+		if _, err := strconv.ParseFloat(t, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// hasXYZColumns returns true if the column names have x, y and z.
+func hasXYZColumns(names []string) bool {
+	var n int
+	for _, c := range []string{"x", "y", "z"} {
+		for _, name := range names {
+			if normalizeFieldName(name) == c {
+				n++
+				break
+			}
+		}
+	}
+	return n == 3
+}
+
+// unmarshalText reads the delimited text like XYZ or CSV.
+// The first row is used as the column names if it is not numeric.
+// Rows starting with # are ignored, except for the column names like "# x y z".
+// It fails if the points exceed maxBytes.
+func unmarshalText(r io.Reader, opts textOptions, maxBytes int) (*pc.PointCloud, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	pp := &pc.PointCloud{
+		PointCloudHeader: pc.PointCloudHeader{
+			Version:   0.7,
+			Height:    1,
+			Viewpoint: []float32{0, 0, 0, 1, 0, 0, 0},
+		},
+	}
+	var cols []int // field index of each column, -1 to ignore
+	var offsets []int
+	var stride int
+
+	setColumns := func(names []string) error {
+		cols = make([]int, len(names))
+		var hasX, hasY, hasZ bool
+		for i, name := range names {
+			name = normalizeFieldName(name)
+			cols[i] = -1
+			if name == "_" || name == "" || fieldIndex(&pp.PointCloudHeader, name, 0) >= 0 {
+				continue
+			}
+			typ, size := textFieldType(name)
+			cols[i] = len(pp.Fields)
+			pp.Fields = append(pp.Fields, name)
+			pp.Type = append(pp.Type, typ)
+			pp.Size = append(pp.Size, size)
+			pp.Count = append(pp.Count, 1)
+			hasX = hasX || name == "x"
+			hasY = hasY || name == "y"
+			hasZ = hasZ || name == "z"
+		}
+		if !hasX || !hasY || !hasZ {
+			return errTextNoXYZ
+		}
+		offsets = make([]int, len(pp.Fields))
+		for i := range offsets {
+			offsets[i], _ = fieldOffsetAt(&pp.PointCloudHeader, i)
+		}
+		stride = pp.Stride()
+		return nil
+	}
+	if opts.columns != nil {
+		if err := setColumns(opts.columns); err != nil {
+			return nil, err
+		}
+	}
+
+	for line := 1; s.Scan(); line++ {
+		if line <= opts.skipRows {
+			continue
+		}
+		l := strings.TrimSpace(s.Text())
+		if l == "" {
+			continue
+		}
+		if strings.HasPrefix(l, "#") {
+			if names := splitTextRow(strings.TrimLeft(l, "#"), opts.delimiter); cols == nil && hasXYZColumns(names) {
+				if err := setColumns(names); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+			}
+			continue
+		}
+		tokens := splitTextRow(l, opts.delimiter)
+		if cols == nil {
+			if isNumericRow(tokens) {
+				if err := setColumns(defaultTextColumns(len(tokens))); err != nil {
+					return nil, err
+				}
+			} else {
+				if err := setColumns(tokens); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				continue
+			}
+		}
+		if len(tokens) < len(cols) {
+			return nil, fmt.Errorf("line %d: %d columns are required but got %d", line, len(cols), len(tokens))
+		}
+		if err := checkPointCloudBytes(pp.Points+1, stride, maxBytes); err != nil {
+			return nil, err
+		}
+		p := make([]byte, stride)
+		for i, f := range cols {
+			if f < 0 {
+				continue
+			}
+			v, err := strconv.ParseFloat(tokens[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid number %q", line, tokens[i])
+			}
+			writeNumber(p[offsets[f]:], pp.Type[f], pp.Size[f], v)
+		}
+		pp.Data = append(pp.Data, p...)
+		pp.Points++
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if cols == nil {
+		return nil, errTextNoXYZ
+	}
+	pp.Width = pp.Points
+	return pp, nil
+}
+
+// marshalText writes the cloud as delimited text.
+// Fields having multiple values and padding fields are not written.
+func marshalText(pp *pc.PointCloud, w io.Writer, delimiter string, header bool, precision int) error {
+	var cols []int
+	for i, f := range pp.Fields {
+		if f != "_" && pp.Count[i] == 1 && isNumericType(pp.Type[i], pp.Size[i]) {
+			cols = append(cols, i)
+		}
+	}
+	offsets := make([]int, len(cols))
+	for i, c := range cols {
+		offsets[i], _ = fieldOffsetAt(&pp.PointCloudHeader, c)
+	}
+
+	bw := bufio.NewWriter(w)
+	if header {
+		for i, c := range cols {
+			if i > 0 {
+				bw.WriteString(delimiter)
+			}
+			bw.WriteString(pp.Fields[c])
+		}
+		bw.WriteString("\n")
+	}
+	stride := pp.Stride()
+	var buf []byte
+	for i := 0; i < pp.Points; i++ {
+		p := pp.Data[i*stride:]
+		buf = buf[:0]
+		for j, c := range cols {
+			if j > 0 {
+				buf = append(buf, delimiter...)
+			}
+			buf = appendNumber(buf, p[offsets[j]:], pp.Type[c], pp.Size[c], precision)
+		}
+		buf = append(buf, '\n')
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// appendNumber appends the text representation of the value.
+// Floats are written in the significant digits of precision,
+// or the shortest representation if precision is 0.
+func appendNumber(buf, b []byte, typ string, size int, precision int) []byte {
+	switch {
+	case typ == "F":
+		if precision <= 0 {
+			precision = -1
+		}
+		return strconv.AppendFloat(buf, readNumber(b, typ, size), 'g', precision, 8*size)
+	case size == 8:
+		// float64 can't represent all 64 bits integers
+		if typ == "I" {
+			return strconv.AppendInt(buf, int64(binary.LittleEndian.Uint64(b)), 10)
+		}
+		return strconv.AppendUint(buf, binary.LittleEndian.Uint64(b), 10)
+	}
+	return strconv.AppendInt(buf, int64(readNumber(b, typ, size)), 10)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/seqsense/pcdeditor/pcd"
+)
+
+func TestText(t *testing.T) {
+	testCases := map[string]struct {
+		input    string
+		opts     formatOptions
+		fields   []string
+		expected [][]float64
+	}{
+		"XYZ": {
+			input:    "1 2 3\n4 5 6\n",
+			fields:   []string{"x", "y", "z"},
+			expected: [][]float64{{1, 2, 3}, {4, 5, 6}},
+		},
+		"XYZI": {
+			input:    "1\t2\t3\t10\n\n4\t5\t6\t20",
+			fields:   []string{"x", "y", "z", "intensity"},
+			expected: [][]float64{{1, 2, 3, 10}, {4, 5, 6, 20}},
+		},
+		"CloudCompareHeader": {
+			input:    "//X,Y,Z,R,G,B,Scalar_Classification\n1,2,3,255,128,0,5\n",
+			fields:   []string{"x", "y", "z", "red", "green", "blue", "label"},
+			expected: [][]float64{{1, 2, 3, 255, 128, 0, 5}},
+		},
+		"CommentHeader": {
+			input:    "# x y z\n1 2 3\n",
+			fields:   []string{"x", "y", "z"},
+			expected: [][]float64{{1, 2, 3}},
+		},
+		"Comment": {
+			input:    "# exported by scanner\n#X,Y,Z,Intensity\n1,2,3,4\n# end\n",
+			fields:   []string{"x", "y", "z", "intensity"},
+			expected: [][]float64{{1, 2, 3, 4}},
+		},
+		"Columns": {
+			input: "id;label;x;y;z\n1;3;0.5;1.5;2.5\n",
+			opts: formatOptions{
+				format: formatCSV,
+				text: textOptions{
+					columns:   []string{"_", "label", "x", "y", "z"},
+					delimiter: ";",
+					skipRows:  1,
+				},
+			},
+			fields:   []string{"label", "x", "y", "z"},
+			expected: [][]float64{{3, 0.5, 1.5, 2.5}},
+		},
+	}
+	for name, tt := range testCases {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			pp, err := unmarshalPointCloud(strings.NewReader(tt.input), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(tt.fields, pp.Fields) {
+				t.Fatalf("Expected fields %v, got %v", tt.fields, pp.Fields)
+			}
+			if pp.Points != len(tt.expected) {
+				t.Fatalf("Expected %d points, got %d", len(tt.expected), pp.Points)
+			}
+			for i, v := range tt.expected {
+				p := pp.Data[i*pp.Stride():]
+				for k := range v {
+					off, _ := fieldOffsetAt(&pp.PointCloudHeader, k)
+					if f := readNumber(p[off:], pp.Type[k], pp.Size[k]); f != v[k] {
+						t.Errorf("Expected %s of point %d to be %v, got %v", pp.Fields[k], i, v[k], f)
+					}
+				}
+			}
+		})
+	}
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		pp := createLASTestCloud(t, []uint32{0, 2, 300})
+		for _, f := range []pointCloudFormat{formatXYZ, formatCSV} {
+			var buf bytes.Buffer
+			if err := marshalPointCloud(pp, &buf, formatOptions{format: f}); err != nil {
+				t.Fatal(err)
+			}
+			opts := formatOptions{format: f}
+			if f == formatXYZ {
+				opts.text.columns = pp.Fields
+			}
+			out, err := unmarshalPointCloud(&buf, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.Points != pp.Points {
+				t.Fatalf("%s: expected %d points, got %d", f, pp.Points, out.Points)
+			}
+			for i := 0; i < pp.Points; i++ {
+				for k, name := range pp.Fields {
+					off, _ := fieldOffsetAt(&pp.PointCloudHeader, k)
+					v := readNumber(pp.Data[i*pp.Stride()+off:], pp.Type[k], pp.Size[k])
+					j := fieldIndex(&out.PointCloudHeader, name, 0)
+					offOut, _ := fieldOffsetAt(&out.PointCloudHeader, j)
+					vOut := readNumber(out.Data[i*out.Stride()+offOut:], out.Type[j], out.Size[j])
+					if name == "gps_time" {
+						// gps_time is stored as float32
+						continue
+					}
+					if v != vOut {
+						t.Errorf("%s: expected %s of point %d to be %v, got %v", f, name, i, v, vOut)
+					}
+				}
+			}
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		_, err := unmarshalPointCloud(strings.NewReader("1 2 3\n4 5 6\n"), formatOptions{maxBytes: 20})
+		if !errors.Is(err, pcd.ErrTooLarge) {
+			t.Errorf("Expected %v, got: %v", pcd.ErrTooLarge, err)
+		}
+	})
+
+	t.Run("NoXYZ", func(t *testing.T) {
+		_, err := unmarshalText(strings.NewReader("a,b\n1,2\n"), textOptions{}, 0)
+		if !errors.Is(err, errTextNoXYZ) {
+			t.Errorf("Expected %v, got: %v", errTextNoXYZ, err)
+		}
+	})
+}
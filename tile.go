@@ -0,0 +1,598 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	errNoTiles        = errors.New("tiled map is not loaded")
+	errTileUpdateHeld = errors.New("tiles are not switched to keep the edit history, run tile_update to discard the history and switch")
+)
+
+// defaultTileRadiusScale is the default radius to load the tiles around the view
+// relative to the tile size.
+const defaultTileRadiusScale = 1.5
+
+// tileKey is the position of the tile in the grid.
+type tileKey struct{ x, y int }
+
+type tile struct {
+	path    string
+	key     tileKey
+	pp      *pc.PointCloud // points in the editor format, nil if not loaded
+	pending []byte         // points moved from the other tiles while not loaded
+	active  bool           // included in the editor cloud
+	dirty   bool
+	failed  bool
+}
+
+func (t *tile) status() string {
+	switch {
+	case t.failed:
+		return "failed"
+	case t.active:
+		return "active"
+	case t.pp != nil:
+		return "loaded"
+	}
+	return "unloaded"
+}
+
+// tileSet manages the tiles of the map divided by the grid.
+// Points are loaded to the editor cloud from the tiles around the view,
+// and edits of the editor cloud are routed to the tiles by the point position.
+type tileSet struct {
+	resolution [2]float32
+	radius     float32
+	tiles      map[tileKey]*tile
+
+	header pc.PointCloudHeader // editor format
+	schema pc.PointCloudHeader // format of the first loaded tile to export
+
+	updateRequested bool // switch the tiles even if the edit history is not empty
+}
+
+// parseTileIndex parses the tile index in the format of Autoware's
+// pointcloud_map_metadata.yaml like below.
+//
+//	x_resolution: 20.0
+//	y_resolution: 20.0
+//	0_0.pcd: [0, 0]
+//	20_0.pcd: [20, 0]
+//
+// Values of the tiles are the minimum x and y of the tile.
+// JSON of the same structure is also accepted.
+func parseTileIndex(b []byte) (*tileSet, error) {
+	var m map[string]interface{}
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	s := &tileSet{tiles: make(map[tileKey]*tile)}
+	for i, name := range []string{"x_resolution", "y_resolution"} {
+		v, ok := toFloat(m[name])
+		if !ok || v <= 0 {
+			return nil, fmt.Errorf("%s must be a positive number", name)
+		}
+		s.resolution[i] = float32(v)
+		delete(m, name)
+	}
+	if len(m) == 0 {
+		return nil, errors.New("no tiles in the index")
+	}
+	for path, v := range m {
+		a, ok := v.([]interface{})
+		if !ok || len(a) != 2 {
+			return nil, fmt.Errorf("%s: origin must be [x, y]", path)
+		}
+		x, okX := toFloat(a[0])
+		y, okY := toFloat(a[1])
+		if !okX || !okY {
+			return nil, fmt.Errorf("%s: origin must be [x, y]", path)
+		}
+		k := tileKey{
+			x: int(math.Round(x / float64(s.resolution[0]))),
+			y: int(math.Round(y / float64(s.resolution[1]))),
+		}
+		if t, ok := s.tiles[k]; ok {
+			return nil, fmt.Errorf("%s and %s are at the same position", t.path, path)
+		}
+		s.tiles[k] = &tile{path: path, key: k}
+	}
+	s.radius = defaultTileRadiusScale * float32(math.Max(float64(s.resolution[0]), float64(s.resolution[1])))
+	return s, nil
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func (s *tileSet) keyOf(x, y float32) tileKey {
+	return tileKey{
+		x: int(math.Floor(float64(x / s.resolution[0]))),
+		y: int(math.Floor(float64(y / s.resolution[1]))),
+	}
+}
+
+// bounds returns the area covered by the tiles.
+func (s *tileSet) bounds() (min, max [2]float32) {
+	first := true
+	for k := range s.tiles {
+		for i, v := range [2]int{k.x, k.y} {
+			lo, hi := float32(v)*s.resolution[i], float32(v+1)*s.resolution[i]
+			if first || lo < min[i] {
+				min[i] = lo
+			}
+			if first || hi > max[i] {
+				max[i] = hi
+			}
+		}
+		first = false
+	}
+	return min, max
+}
+
+// sorted returns the tiles sorted by the path.
+func (s *tileSet) sorted(fn func(*tile) bool) []*tile {
+	var out []*tile
+	for _, t := range s.tiles {
+		if fn(t) {
+			out = append(out, t)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].path < out[j].path })
+	return out
+}
+
+// targets returns the tiles overlapping the area.
+func (s *tileSet) targets(min, max [2]float32) []*tile {
+	kMin, kMax := s.keyOf(min[0], min[1]), s.keyOf(max[0], max[1])
+	return s.sorted(func(t *tile) bool {
+		return !t.failed &&
+			kMin.x <= t.key.x && t.key.x <= kMax.x &&
+			kMin.y <= t.key.y && t.key.y <= kMax.y
+	})
+}
+
+// plan returns the tiles to be loaded to activate the tiles overlapping the area.
+// changed is false if the active tiles are not changed.
+func (s *tileSet) plan(min, max [2]float32) (load []*tile, changed bool) {
+	targets := s.targets(min, max)
+	nActive := 0
+	for _, t := range s.tiles {
+		if t.active {
+			nActive++
+		}
+	}
+	changed = nActive != len(targets)
+	for _, t := range targets {
+		if t.pp == nil {
+			load = append(load, t)
+		}
+		if !t.active {
+			changed = true
+		}
+	}
+	return load, changed
+}
+
+// setCloud sets the loaded points of the tile.
+// All tiles must have the same fields as the first loaded tile.
+func (s *tileSet) setCloud(t *tile, pp *pc.PointCloud) error {
+	if len(s.header.Fields) == 0 {
+		h, err := editorHeader(&pp.PointCloudHeader)
+		if err != nil {
+			return err
+		}
+		s.header = h
+		s.schema = pp.PointCloudHeader.Clone()
+	} else if !sameFields(&s.schema, &pp.PointCloudHeader) {
+		// Tiles are exported in the format of the first tile.
+		return fmt.Errorf("fields %v of tile %s differ from the first tile %v", pp.Fields, t.path, s.schema.Fields)
+	}
+	conv, err := convertFields(pp, &s.header)
+	if err != nil {
+		return err
+	}
+	t.failed = false
+	if len(t.pending) == 0 {
+		t.pp = conv
+		return nil
+	}
+	t.pp = s.newCloud(append(append([]byte{}, conv.Data...), t.pending...))
+	t.pending = nil
+	t.dirty = true
+	return nil
+}
+
+func (s *tileSet) newCloud(data []byte) *pc.PointCloud {
+	pp := &pc.PointCloud{
+		PointCloudHeader: s.header.Clone(),
+		Data:             data,
+	}
+	pp.Points = len(data) / pp.Stride()
+	pp.Width, pp.Height = pp.Points, 1
+	return pp
+}
+
+// store routes the points of the editor cloud to the tiles by the position
+// and marks the changed tiles as dirty.
+// It returns true if some points are moved to the inactive tiles
+// and the editor cloud must be rebuilt by merged().
+func (s *tileSet) store(pp *pc.PointCloud) (bool, error) {
+	if pp == nil {
+		return false, nil
+	}
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		return false, err
+	}
+	stride := pp.Stride()
+	groups := make(map[tileKey][]byte)
+	for i := 0; i < pp.Points; i++ {
+		v := it.Vec3At(i)
+		k := s.keyOf(v[0], v[1])
+		groups[k] = append(groups[k], pp.Data[i*stride:(i+1)*stride]...)
+	}
+
+	var moved bool
+	for _, t := range s.tiles {
+		if !t.active {
+			continue
+		}
+		d := groups[t.key]
+		delete(groups, t.key)
+		if !bytes.Equal(d, t.pp.Data) {
+			t.pp = s.newCloud(d)
+			t.dirty = true
+		}
+	}
+	for k, d := range groups {
+		t, ok := s.tiles[k]
+		switch {
+		case !ok:
+			// Points moved out of the indexed tiles
+			t = &tile{
+				path: strconv.FormatFloat(float64(float32(k.x)*s.resolution[0]), 'f', -1, 32) + "_" +
+					strconv.FormatFloat(float64(float32(k.y)*s.resolution[1]), 'f', -1, 32) + ".pcd",
+				key:    k,
+				pp:     s.newCloud(d),
+				active: true,
+			}
+			s.tiles[k] = t
+		case t.pp != nil:
+			t.pp = s.newCloud(append(append([]byte{}, t.pp.Data...), d...))
+			moved = true
+		default:
+			t.pending = append(t.pending, d...)
+			moved = true
+		}
+		t.dirty = true
+	}
+	return moved, nil
+}
+
+// movesOut returns true if some points of the editor cloud are in the inactive tiles.
+// store moves them and the editor cloud must be rebuilt.
+func (s *tileSet) movesOut(pp *pc.PointCloud) (bool, error) {
+	if pp == nil {
+		return false, nil
+	}
+	it, err := pp.Vec3Iterator()
+	if err != nil {
+		return false, err
+	}
+	for i := 0; i < pp.Points; i++ {
+		v := it.Vec3At(i)
+		if t, ok := s.tiles[s.keyOf(v[0], v[1])]; ok && !t.active {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// activate sets the active tiles and releases the inactive tiles not modified.
+func (s *tileSet) activate(targets []*tile) {
+	isTarget := make(map[*tile]bool)
+	for _, t := range targets {
+		isTarget[t] = true
+	}
+	for _, t := range s.tiles {
+		t.active = isTarget[t] && t.pp != nil
+		if !t.active && !t.dirty {
+			t.pp = nil
+		}
+	}
+}
+
+// merged returns the cloud of all active tiles.
+// nil is returned if no tiles are active.
+func (s *tileSet) merged() *pc.PointCloud {
+	active := s.sorted(func(t *tile) bool { return t.active })
+	if len(active) == 0 {
+		return nil
+	}
+	var n int
+	for _, t := range active {
+		n += len(t.pp.Data)
+	}
+	data := make([]byte, 0, n)
+	for _, t := range active {
+		data = append(data, t.pp.Data...)
+	}
+	return s.newCloud(data)
+}
+
+// exportable converts pp to the format of the first loaded tile.
+func (s *tileSet) exportable(pp *pc.PointCloud) (*pc.PointCloud, error) {
+	if len(s.schema.Fields) == 0 {
+		return pp, nil
+	}
+	h := exportHeader(&s.schema)
+	return convertFields(pp, &h)
+}
+
+// lines returns the status of the tiles.
+func (s *tileSet) lines() []string {
+	var out []string
+	for _, t := range s.sorted(func(*tile) bool { return true }) {
+		l := t.path + " " + t.status()
+		if t.pp != nil {
+			l += " " + strconv.Itoa(t.pp.Points)
+		}
+		if t.dirty {
+			l += " modified"
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// tileArea returns the area to activate the tiles.
+// The crop box is used if cropped, otherwise the area around the center.
+func (c *commandContext) tileArea(center mat.Vec3) (min, max [2]float32) {
+	if m := c.editor.cropMatrix; m != (mat.Mat4{}) {
+		inv := m.InvAffine()
+		for i := 0; i < 8; i++ {
+			v := inv.TransformAffine(mat.Vec3{float32(i & 1), float32(i >> 1 & 1), float32(i >> 2 & 1)})
+			for k := 0; k < 2; k++ {
+				if i == 0 || v[k] < min[k] {
+					min[k] = v[k]
+				}
+				if i == 0 || v[k] > max[k] {
+					max[k] = v[k]
+				}
+			}
+		}
+		return min, max
+	}
+	r := c.tiles.radius
+	return [2]float32{center[0] - r, center[1] - r}, [2]float32{center[0] + r, center[1] + r}
+}
+
+// ImportTileIndex starts the tiled map mode.
+func (c *commandContext) ImportTileIndex(b []byte) error {
+	ts, err := parseTileIndex(b)
+	if err != nil {
+		return err
+	}
+	c.Reset()
+	c.tiles = ts
+	return nil
+}
+
+// TileBounds returns the area covered by the tiles.
+func (c *commandContext) TileBounds() (min, max [2]float32, err error) {
+	if c.tiles == nil {
+		return min, max, errNoTiles
+	}
+	min, max = c.tiles.bounds()
+	return min, max, nil
+}
+
+// TilesToLoad returns the paths of the tiles to be loaded before ActivateTiles.
+// changed is false if the active tiles are not changed.
+func (c *commandContext) TilesToLoad(center mat.Vec3) (paths []string, changed bool) {
+	if c.tiles == nil {
+		return nil, false
+	}
+	load, changed := c.tiles.plan(c.tileArea(center))
+	for _, t := range load {
+		paths = append(paths, t.path)
+	}
+	return paths, changed
+}
+
+func (c *commandContext) tileByPath(path string) (*tile, error) {
+	if c.tiles == nil {
+		return nil, errNoTiles
+	}
+	for _, t := range c.tiles.tiles {
+		if t.path == path {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown tile %s", path)
+}
+
+// ImportTile loads the tile file.
+func (c *commandContext) ImportTile(path string, blob interface{}) error {
+	t, err := c.tileByPath(path)
+	if err != nil {
+		return err
+	}
+	pp, err := c.pcdIO.importPCD(blob, formatOptions{})
+	if err != nil {
+		return err
+	}
+	return c.tiles.setCloud(t, pp)
+}
+
+// SetTileFailed marks the tile as failed to be loaded to avoid retrying.
+func (c *commandContext) SetTileFailed(path string) {
+	if t, err := c.tileByPath(path); err == nil {
+		t.failed = true
+	}
+}
+
+// TileUpdateHeld returns true if the active tiles must not be switched to keep the edit history.
+func (c *commandContext) TileUpdateHeld() bool {
+	if c.tiles == nil || c.tiles.updateRequested {
+		return false
+	}
+	j, _ := c.editor.journal()
+	return len(j) > 0
+}
+
+// RequestTileUpdate allows the next ActivateTiles to discard the edit history.
+func (c *commandContext) RequestTileUpdate() error {
+	if c.tiles == nil {
+		return errNoTiles
+	}
+	c.tiles.updateRequested = true
+	return nil
+}
+
+// ActivateTiles stores the edits to the tiles and replaces the editor cloud by the tiles around the center.
+// Edit history is cleared since the point indices are changed,
+// so it fails while the history is not empty unless RequestTileUpdate is called.
+func (c *commandContext) ActivateTiles(center mat.Vec3) error {
+	if c.tiles == nil {
+		return errNoTiles
+	}
+	if c.TileUpdateHeld() {
+		return errTileUpdateHeld
+	}
+	c.tiles.updateRequested = false
+	if _, err := c.tiles.store(c.editor.pp); err != nil {
+		return err
+	}
+	c.tiles.activate(c.tiles.targets(c.tileArea(center)))
+	c.setTileCloud()
+	return nil
+}
+
+func (c *commandContext) setTileCloud() {
+	c.editor.clear()
+	c.editor.pp = c.tiles.merged()
+	c.editor.schema = c.tiles.schema.Clone()
+	c.editor.georef = nil
+	c.selectMask = nil
+	c.invalidateSelectMask()
+	c.setPointCloudUpdated()
+}
+
+// TilesToExport returns the paths of the modified tiles to be loaded before ExportTiles.
+func (c *commandContext) TilesToExport() []string {
+	if c.tiles == nil {
+		return nil
+	}
+	var paths []string
+	for _, t := range c.tiles.sorted(func(t *tile) bool { return len(t.pending) > 0 && t.pp == nil }) {
+		paths = append(paths, t.path)
+	}
+	return paths
+}
+
+type exportedTile struct {
+	path string
+	blob interface{}
+}
+
+// ExportTiles exports the modified tiles.
+func (c *commandContext) ExportTiles(opts formatOptions) ([]exportedTile, error) {
+	if c.tiles == nil {
+		return nil, errNoTiles
+	}
+	// Editor cloud is rebuilt if the points are moved to the inactive tiles,
+	// so it is held by the edit history as same as ActivateTiles.
+	if c.TileUpdateHeld() {
+		out, err := c.tiles.movesOut(c.editor.pp)
+		if err != nil {
+			return nil, err
+		}
+		if out {
+			return nil, fmt.Errorf("points are moved to the inactive tiles: %w", errTileUpdateHeld)
+		}
+	}
+	moved, err := c.tiles.store(c.editor.pp)
+	if err != nil {
+		return nil, err
+	}
+	if moved {
+		c.tiles.updateRequested = false
+		c.setTileCloud()
+	}
+	var out []exportedTile
+	for _, t := range c.tiles.sorted(func(t *tile) bool { return t.dirty }) {
+		if t.pp == nil {
+			return nil, fmt.Errorf("tile %s must be loaded to be exported", t.path)
+		}
+		pp, err := c.tiles.exportable(t.pp)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := c.pcdIO.exportPCD(pp, opts)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, exportedTile{path: tilePath(t.path, opts.format), blob: blob})
+	}
+	for _, t := range c.tiles.tiles {
+		t.dirty = false
+		if !t.active {
+			t.pp = nil
+		}
+	}
+	return out, nil
+}
+
+// tilePath returns the path of the tile exported in the format.
+func tilePath(p string, format pointCloudFormat) string {
+	if format == formatAuto || format == formatPCD {
+		return p
+	}
+	return strings.TrimSuffix(p, path.Ext(p)) + "." + format.String()
+}
+
+// TileStatus returns the status of the tiles.
+func (c *commandContext) TileStatus() ([]string, error) {
+	if c.tiles == nil {
+		return nil, errNoTiles
+	}
+	return c.tiles.lines(), nil
+}
+
+func (c *commandContext) TileRadius() (float32, error) {
+	if c.tiles == nil {
+		return 0, errNoTiles
+	}
+	return c.tiles.radius, nil
+}
+
+func (c *commandContext) SetTileRadius(r float32) error {
+	if c.tiles == nil {
+		return errNoTiles
+	}
+	if r < 0 {
+		return errors.New("radius must be positive")
+	}
+	c.tiles.radius = r
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"syscall/js"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+// awaitPromise waits the promise (or the value) to be settled.
+func awaitPromise(p js.Value) (js.Value, error) {
+	type result struct {
+		v   js.Value
+		err error
+	}
+	ch := make(chan result, 1)
+	onResolved := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		ch <- result{v: optionalArg(args, 0)}
+		return nil
+	})
+	defer onResolved.Release()
+	onRejected := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		err := errors.New("rejected")
+		if reason := optionalArg(args, 0); !reason.IsUndefined() && !reason.IsNull() {
+			err = errors.New(reason.Call("toString").String())
+		}
+		ch <- result{err: err}
+		return nil
+	})
+	defer onRejected.Release()
+	js.Global().Get("Promise").Call("resolve", p).Call("then", onResolved, onRejected)
+
+	r := <-ch
+	return r.v, r.err
+}
+
+// viewCenter returns the position of the view center on the ground.
+func (pe *pcdeditor) viewCenter() mat.Vec3 {
+	return mat.Vec3{-float32(pe.vi.x), -float32(pe.vi.y), 0}
+}
+
+// loadTiles fetches the tiles by the fetchTile callback given to importTiles.
+// Tiles failed to be loaded are not retried.
+func (pe *pcdeditor) loadTiles(paths []string) {
+	for _, p := range paths {
+		pe.logPrint("loading tile " + p)
+		b, err := awaitPromise(pe.fetchTile.Invoke(p))
+		if err == nil {
+			err = pe.cmd.ImportTile(p, b)
+		}
+		if err != nil {
+			pe.logPrint("failed to load tile " + p + ": " + err.Error())
+			pe.cmd.SetTileFailed(p)
+		}
+	}
+}
+
+// updateTiles loads the tiles around the view and replaces the editor cloud.
+// It returns true if the editor cloud is updated.
+func (pe *pcdeditor) updateTiles() bool {
+	if pe.cmd.SelectMode() == selectModeInsert {
+		// Wait until the inserting cloud is merged
+		return false
+	}
+	center := pe.viewCenter()
+	paths, changed := pe.cmd.TilesToLoad(center)
+	if !changed {
+		return false
+	}
+	if pe.cmd.TileUpdateHeld() {
+		if !pe.tileUpdateHeld {
+			pe.logPrint(errTileUpdateHeld)
+			pe.tileUpdateHeld = true
+		}
+		return false
+	}
+	pe.tileUpdateHeld = false
+	pe.loadTiles(paths)
+	if err := pe.cmd.ActivateTiles(center); err != nil {
+		pe.logPrint(err)
+		return false
+	}
+	return true
+}
+
+// importTiles starts the tiled map mode and moves the view to the center of the tiles.
+func (pe *pcdeditor) importTiles(index, fetchTile js.Value) error {
+	if fetchTile.Type() != js.TypeFunction {
+		return errors.New("fetchTile must be a function")
+	}
+	b, err := readTextOrBlob(index)
+	if err != nil {
+		return err
+	}
+	if err := pe.cmd.ImportTileIndex(b); err != nil {
+		return err
+	}
+	pe.fetchTile = fetchTile
+	min, max, err := pe.cmd.TileBounds()
+	if err != nil {
+		return err
+	}
+	pe.vi.x = -float64(min[0]+max[0]) / 2
+	pe.vi.y = -float64(min[1]+max[1]) / 2
+	pe.updateTiles()
+	return nil
+}
+
+// exportTiles exports the modified tiles as an array of {path, blob}.
+func (pe *pcdeditor) exportTiles(opts formatOptions) ([]interface{}, error) {
+	pe.loadTiles(pe.cmd.TilesToExport())
+	tiles, err := pe.cmd.ExportTiles(opts)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, len(tiles))
+	for i, t := range tiles {
+		out[i] = map[string]interface{}{
+			"path": t.path,
+			"blob": t.blob,
+		}
+	}
+	return out, nil
+}
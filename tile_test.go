@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+	"github.com/seqsense/pcgol/pc"
+)
+
+func TestParseTileIndex(t *testing.T) {
+	t.Run("YAML", func(t *testing.T) {
+		ts, err := parseTileIndex([]byte("x_resolution: 10.0\ny_resolution: 20\n0_0.pcd: [0, 0]\n10_-20.pcd: [10.0, -20.0]\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := map[tileKey]string{
+			{0, 0}:  "0_0.pcd",
+			{1, -1}: "10_-20.pcd",
+		}
+		if len(ts.tiles) != len(expected) {
+			t.Fatalf("Expected %d tiles, got %d", len(expected), len(ts.tiles))
+		}
+		for k, path := range expected {
+			if ts.tiles[k] == nil || ts.tiles[k].path != path {
+				t.Errorf("Expected %s at %v, got %v", path, k, ts.tiles[k])
+			}
+		}
+		if ts.radius != 30 {
+			t.Errorf("Expected default radius 30, got %f", ts.radius)
+		}
+		min, max := ts.bounds()
+		if min != [2]float32{0, -20} || max != [2]float32{20, 20} {
+			t.Errorf("Expected bounds [0 -20]-[20 20], got %v-%v", min, max)
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		ts, err := parseTileIndex([]byte(`{"x_resolution": 5, "y_resolution": 5, "a.pcd": [-5, 5]}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ts.tiles[tileKey{-1, 1}] == nil {
+			t.Errorf("Tile must be at [-1, 1], got %v", ts.tiles)
+		}
+	})
+	testCases := map[string]string{
+		"NoResolution": "0_0.pcd: [0, 0]\n",
+		"ZeroRes":      "x_resolution: 0\ny_resolution: 1\n0_0.pcd: [0, 0]\n",
+		"NoTiles":      "x_resolution: 1\ny_resolution: 1\n",
+		"InvalidPos":   "x_resolution: 1\ny_resolution: 1\n0_0.pcd: [0]\n",
+		"NotNumber":    "x_resolution: 1\ny_resolution: 1\n0_0.pcd: [a, 0]\n",
+		"Duplicated":   "x_resolution: 1\ny_resolution: 1\na.pcd: [0, 0]\nb.pcd: [0.1, 0]\n",
+		"Broken":       "x_resolution: [",
+	}
+	for name, index := range testCases {
+		if _, err := parseTileIndex([]byte(index)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestTiles(t *testing.T) {
+	c := newCommandContext(&dummyPCDIO{}, nil)
+	if _, err := c.TileStatus(); err != errNoTiles {
+		t.Fatalf("Expected %v, got %v", errNoTiles, err)
+	}
+	index := "x_resolution: 10\ny_resolution: 10\n0_0.pcd: [0, 0]\n10_0.pcd: [10, 0]\n20_0.pcd: [20, 0]\n"
+	if err := c.ImportTileIndex([]byte(index)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetTileRadius(4); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]*pc.PointCloud{
+		"0_0.pcd":  createXYZCloud(t, mat.Vec3{1, 1, 0}, mat.Vec3{2, 2, 0}),
+		"10_0.pcd": createXYZCloud(t, mat.Vec3{11, 1, 0}),
+		"20_0.pcd": createXYZCloud(t, mat.Vec3{21, 1, 0}),
+	}
+	load := func(center mat.Vec3, expected []string) {
+		t.Helper()
+		paths, changed := c.TilesToLoad(center)
+		if !reflect.DeepEqual(expected, paths) {
+			t.Fatalf("Expected to load %v, got %v", expected, paths)
+		}
+		if !changed {
+			t.Fatal("Active tiles must be changed")
+		}
+		for _, p := range paths {
+			if err := c.ImportTile(p, files[p]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.ActivateTiles(center); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	load(mat.Vec3{5, 5, 0}, []string{"0_0.pcd"})
+	expectPointCloud(t, c.editor.pp, []mat.Vec3{{1, 1, 0}, {2, 2, 0}})
+	if _, changed := c.TilesToLoad(mat.Vec3{4, 6, 0}); changed {
+		t.Error("Active tiles must not be changed")
+	}
+
+	// Move a point to the next tile, which is not loaded yet, and add a point out of the index
+	edited := &pc.PointCloud{
+		PointCloudHeader: c.editor.pp.PointCloudHeader.Clone(),
+		Data:             append([]byte{}, c.editor.pp.Data...),
+	}
+	it, _ := edited.Vec3Iterator()
+	it.SetVec3(mat.Vec3{15, 1, 0})
+	edited.Data = append(edited.Data, createXYZCloud(t, mat.Vec3{-5, 1, 0}).Data...)
+	edited.Data = append(edited.Data, make([]byte, 4)...) // label
+	edited.Points, edited.Width = 3, 3
+	if err := c.editor.replace(journalEntry{name: "test"}, edited); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ActivateTiles(mat.Vec3{5, 5, 0}); err != errTileUpdateHeld {
+		t.Fatalf("Expected %v, got %v", errTileUpdateHeld, err)
+	}
+	if j, _ := c.editor.journal(); len(j) != 1 {
+		t.Fatal("History must be kept while the tiles are held")
+	}
+	if err := c.RequestTileUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ActivateTiles(mat.Vec3{5, 5, 0}); err != nil {
+		t.Fatal(err)
+	}
+	expectPointCloud(t, c.editor.pp, []mat.Vec3{{2, 2, 0}})
+	if j, _ := c.editor.journal(); len(j) != 0 {
+		t.Error("History must be cleared after updating active tiles")
+	}
+	if paths := c.TilesToExport(); !reflect.DeepEqual([]string{"10_0.pcd"}, paths) {
+		t.Errorf("Expected to load [10_0.pcd] before export, got %v", paths)
+	}
+	if _, err := c.ExportTiles(formatOptions{}); err == nil {
+		t.Error("Export must fail if the modified tile is not loaded")
+	}
+
+	load(mat.Vec3{20, 5, 0}, []string{"10_0.pcd", "20_0.pcd"})
+	expectPointCloud(t, c.editor.pp, []mat.Vec3{{11, 1, 0}, {15, 1, 0}, {21, 1, 0}})
+
+	status, err := c.TileStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStatus := []string{
+		"-10_0.pcd loaded 1 modified",
+		"0_0.pcd loaded 1 modified",
+		"10_0.pcd active 2 modified",
+		"20_0.pcd active 1",
+	}
+	if !reflect.DeepEqual(expectedStatus, status) {
+		t.Errorf("Expected status %v, got %v", expectedStatus, status)
+	}
+
+	exported, err := c.ExportTiles(formatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedExport := map[string][]mat.Vec3{
+		"-10_0.pcd": {{-5, 1, 0}},
+		"0_0.pcd":   {{2, 2, 0}},
+		"10_0.pcd":  {{11, 1, 0}, {15, 1, 0}},
+	}
+	if len(exported) != len(expectedExport) {
+		t.Fatalf("Expected %d tiles to be exported, got %d", len(expectedExport), len(exported))
+	}
+	for _, e := range exported {
+		pp := e.blob.(*pc.PointCloud)
+		if !reflect.DeepEqual([]string{"x", "y", "z", "label"}, pp.Fields) {
+			t.Errorf("%s: tile must be exported in the original format, got %v", e.path, pp.Fields)
+		}
+		expectPointCloud(t, pp, expectedExport[e.path])
+	}
+
+	status, _ = c.TileStatus()
+	expectedStatus = []string{
+		"-10_0.pcd unloaded",
+		"0_0.pcd unloaded",
+		"10_0.pcd active 2",
+		"20_0.pcd active 1",
+	}
+	if !reflect.DeepEqual(expectedStatus, status) {
+		t.Errorf("Expected status %v, got %v", expectedStatus, status)
+	}
+	if exported, _ := c.ExportTiles(formatOptions{}); len(exported) != 0 {
+		t.Errorf("Unmodified tiles must not be exported, got %d", len(exported))
+	}
+
+	c.SetTileFailed("0_0.pcd")
+	if paths, _ := c.TilesToLoad(mat.Vec3{0, 5, 0}); !reflect.DeepEqual([]string{"-10_0.pcd"}, paths) {
+		t.Errorf("Failed tile must not be loaded again, got %v", paths)
+	}
+
+	if err := c.ImportPCD(files["0_0.pcd"], formatOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if c.tiles != nil {
+		t.Error("Tiled map mode must be finished by importing PCD")
+	}
+}
+
+func TestTilePath(t *testing.T) {
+	testCases := map[pointCloudFormat]string{
+		formatAuto: "dir/0_0.pcd",
+		formatPCD:  "dir/0_0.pcd",
+		formatPLY:  "dir/0_0.ply",
+		formatCSV:  "dir/0_0.csv",
+	}
+	for format, expected := range testCases {
+		if p := tilePath("dir/0_0.pcd", format); p != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, format, p)
+		}
+	}
+}
+
+func TestTiles_Crop(t *testing.T) {
+	c := newCommandContext(&dummyPCDIO{}, nil)
+	index := "x_resolution: 10\ny_resolution: 10\n0_0.pcd: [0, 0]\n10_0.pcd: [10, 0]\n20_0.pcd: [20, 0]\n"
+	if err := c.ImportTileIndex([]byte(index)); err != nil {
+		t.Fatal(err)
+	}
+	// Crop box of x: 12-25, y: 1-3
+	c.editor.Crop(mat.Scale(1.0/13, 0.5, 1).Mul(mat.Translate(-12, -1, 0)))
+	paths, _ := c.TilesToLoad(mat.Vec3{})
+	if expected := []string{"10_0.pcd", "20_0.pcd"}; !reflect.DeepEqual(expected, paths) {
+		t.Errorf("Expected to load %v, got %v", expected, paths)
+	}
+}
+
+func TestTiles_ExportHeld(t *testing.T) {
+	c := newCommandContext(&dummyPCDIO{}, nil)
+	index := "x_resolution: 10\ny_resolution: 10\n0_0.pcd: [0, 0]\n10_0.pcd: [10, 0]\n"
+	if err := c.ImportTileIndex([]byte(index)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetTileRadius(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ImportTile("0_0.pcd", createXYZCloud(t, mat.Vec3{1, 1, 0}, mat.Vec3{2, 2, 0})); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ActivateTiles(mat.Vec3{5, 5, 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Move a point to the inactive tile
+	edited := newPointCloudLike(c.editor.pp, c.editor.pp.Points)
+	copy(edited.Data, c.editor.pp.Data)
+	it, _ := edited.Vec3Iterator()
+	it.SetVec3(mat.Vec3{15, 1, 0})
+	if err := c.editor.replace(journalEntry{name: "test"}, edited); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExportTiles(formatOptions{}); !errors.Is(err, errTileUpdateHeld) {
+		t.Fatalf("Expected %v, got %v", errTileUpdateHeld, err)
+	}
+	if j, _ := c.editor.journal(); len(j) != 1 {
+		t.Fatal("History must be kept while the tiles are held")
+	}
+	expectPointCloud(t, c.editor.pp, []mat.Vec3{{15, 1, 0}, {2, 2, 0}})
+
+	if err := c.RequestTileUpdate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ExportTiles(formatOptions{}); errors.Is(err, errTileUpdateHeld) {
+		t.Fatalf("Export must not be held after tile_update, got %v", err)
+	}
+	expectPointCloud(t, c.editor.pp, []mat.Vec3{{2, 2, 0}})
+	if j, _ := c.editor.journal(); len(j) != 0 {
+		t.Error("History must be cleared after moving the points to the inactive tiles")
+	}
+}
+
+func TestTiles_Fields(t *testing.T) {
+	c := newCommandContext(&dummyPCDIO{}, nil)
+	index := "x_resolution: 10\ny_resolution: 10\n0_0.pcd: [0, 0]\n10_0.pcd: [10, 0]\n"
+	if err := c.ImportTileIndex([]byte(index)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ImportTile("0_0.pcd", createXYZCloud(t, mat.Vec3{1, 1, 0})); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ImportTile("10_0.pcd", createPointCloud(t, true)); err == nil {
+		t.Error("Tile having the different fields must not be loaded")
+	}
+}
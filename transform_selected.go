@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+// rotationRPY returns the rotation matrix of roll, pitch and yaw angles
+// applied in the order of x, y and z axes.
+func rotationRPY(roll, pitch, yaw float32) mat.Mat4 {
+	return mat.Rotate(0, 0, 1, yaw).
+		Mul(mat.Rotate(0, 1, 0, pitch)).
+		Mul(mat.Rotate(1, 0, 0, roll))
+}
+
+// BeginTransformSelected starts moving the selected points interactively.
+// The selected points are copied to the sub cloud to preview the transform
+// and the cursors are moved in the same way as inserting the sub cloud.
+// FinalizeCurrentMode applies the transform to the selected points.
+func (c *commandContext) BeginTransformSelected() error {
+	if c.selectMode == selectModeInsert {
+		return errors.New("already in insert mode")
+	}
+	indice, err := c.selectedIndice()
+	if err != nil {
+		return err
+	}
+	selected := make([]bool, c.editor.pp.Points)
+	for _, i := range indice {
+		selected[i] = true
+	}
+	pp, err := passThrough(c.editor.pp, func(i int, _ mat.Vec3) bool {
+		return selected[i]
+	})
+	if err != nil {
+		return err
+	}
+	if err := c.editor.SetPointCloud(pp, cloudSub); err != nil {
+		return err
+	}
+
+	c.selectMode = selectModeInsert
+	c.hasMaskSelection = false
+	// Put unit vectors to reconstruct final transformation easily
+	// by cursorsToTrans()
+	c.selected = []mat.Vec3{
+		{},
+		{1, 0, 0},
+		{0, 1, 0},
+		{0, 0, 1},
+	}
+	c.updateRect()
+	c.transformIndice = indice
+	c.transformRev = c.pointCloudRev
+
+	c.subPointCloudUpdated = true
+	return nil
+}
+
+func (c *commandContext) finalizeTransformSelected() error {
+	indice := c.transformIndice
+	if c.transformRev != c.pointCloudRev {
+		c.UnsetCursors()
+		return errors.New("point cloud is changed while transforming")
+	}
+	trans := cursorsToTrans(c.selected)
+	o := trans.Transform(mat.Vec3{})
+	if err := c.transformPoints(indice, trans, c.newJournal("transform_selected", o[0], o[1], o[2])); err != nil {
+		return err
+	}
+	c.UnsetCursors()
+	return nil
+}
+
+// TransformSelected rotates the selected points by roll, pitch and yaw
+// around the center of their bounding box and translates them by x, y and z.
+// It returns the number of the transformed points.
+func (c *commandContext) TransformSelected(x, y, z, roll, pitch, yaw float32) (int, error) {
+	if c.selectMode == selectModeInsert {
+		return 0, errors.New("selection is not available in insert mode")
+	}
+	indice, err := c.selectedIndice()
+	if err != nil {
+		return 0, err
+	}
+	it, err := c.editor.pp.Vec3Iterator()
+	if err != nil {
+		return 0, err
+	}
+	min, max := it.Vec3At(indice[0]), it.Vec3At(indice[0])
+	for _, i := range indice[1:] {
+		v := it.Vec3At(i)
+		for k := range v {
+			if v[k] < min[k] {
+				min[k] = v[k]
+			}
+			if v[k] > max[k] {
+				max[k] = v[k]
+			}
+		}
+	}
+	center := min.Add(max).Mul(0.5)
+	trans := mat.Translate(center[0]+x, center[1]+y, center[2]+z).
+		Mul(rotationRPY(roll, pitch, yaw)).
+		Mul(mat.Translate(-center[0], -center[1], -center[2]))
+	if err := c.transformPoints(indice, trans, c.newJournal("transform_selected", x, y, z, roll, pitch, yaw)); err != nil {
+		return 0, err
+	}
+	return len(indice), nil
+}
+
+func (c *commandContext) transformPoints(indice []int, trans mat.Mat4, j journalEntry) error {
+	selected := make([]bool, c.editor.pp.Points)
+	for _, i := range indice {
+		selected[i] = true
+	}
+	err := c.editor.move(j, func(i int, v mat.Vec3) (mat.Vec3, bool) {
+		if !selected[i] {
+			return v, false
+		}
+		return trans.Transform(v), true
+	})
+	if err != nil {
+		return err
+	}
+	c.setPointCloudUpdated()
+	return nil
+}
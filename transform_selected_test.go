@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/seqsense/pcgol/mat"
+)
+
+func TestTransformSelected(t *testing.T) {
+	vs := []mat.Vec3{{0, 0, 0}, {2, 0, 0}, {0, 2, 0}, {10, 10, 10}}
+
+	expectNear := func(t *testing.T, c *console, expected []mat.Vec3) {
+		t.Helper()
+		it, err := c.cmd.editor.pp.Vec3Iterator()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, e := range expected {
+			if d := it.Vec3At(i).Sub(e).Norm(); d > 1e-5 {
+				t.Errorf("Expected %v, got %v at %d", e, it.Vec3At(i), i)
+			}
+		}
+	}
+
+	t.Run("Command", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		c.cmd.SetSelectMask([]uint32{
+			selectBitmaskSegmentSelected,
+			selectBitmaskSegmentSelected,
+			selectBitmaskSegmentSelected,
+			0,
+		})
+		c.cmd.selectMode = selectModeMask
+
+		res, err := c.Run("transform_selected 0 0 1 0 0 1.5707963", noUpdate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := res.([][]float32)[0][0]; n != 3 {
+			t.Errorf("Expected 3 points to be transformed, got %v", n)
+		}
+		// Rotated around the center of the bounding box (1, 1, 0)
+		expectNear(t, c, []mat.Vec3{{2, 0, 1}, {2, 2, 1}, {0, 0, 1}, {10, 10, 10}})
+
+		if j, _ := c.cmd.Journal(); len(j) != 1 {
+			t.Fatalf("Expected 1 history entry, got %d", len(j))
+		}
+		if !c.cmd.Undo() {
+			t.Fatal("Undo failed")
+		}
+		expectPointCloud(t, c.cmd.editor.pp, vs)
+	})
+	t.Run("Interactive", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		c.cmd.SetSelectMask([]uint32{
+			selectBitmaskSelected,
+			selectBitmaskSelected,
+			0,
+			0,
+		})
+		for i, p := range []mat.Vec3{{-1, -1, 0}, {3, -1, 0}, {3, 1, 0}} {
+			c.cmd.SetCursor(i, p)
+		}
+
+		if _, err := c.Run("transform_selected", noUpdate); err != nil {
+			t.Fatal(err)
+		}
+		if c.cmd.SelectMode() != selectModeInsert {
+			t.Fatal("Expected insert mode")
+		}
+		ppSub, _, ok := c.cmd.SubPointCloud()
+		if !ok {
+			t.Fatal("Selected points must be previewed as sub cloud")
+		}
+		expectPointCloud(t, ppSub, vs[:2])
+
+		c.cmd.TransformCursors(mat.Translate(1, 2, 3))
+		if err := c.cmd.FinalizeCurrentMode(); err != nil {
+			t.Fatal(err)
+		}
+		expectNear(t, c, []mat.Vec3{{1, 2, 3}, {3, 2, 3}, {0, 2, 0}, {10, 10, 10}})
+		if c.cmd.SelectMode() != selectModeRect {
+			t.Error("Expected to leave insert mode")
+		}
+		if _, _, ok := c.cmd.SubPointCloud(); ok {
+			t.Error("Sub cloud must be cleared")
+		}
+		if !c.cmd.Undo() {
+			t.Fatal("Undo failed")
+		}
+		expectPointCloud(t, c.cmd.editor.pp, vs)
+	})
+	t.Run("Cancel", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		c.cmd.SetSelectMask([]uint32{selectBitmaskSegmentSelected, 0, 0, 0})
+		c.cmd.selectMode = selectModeMask
+
+		if err := c.cmd.BeginTransformSelected(); err != nil {
+			t.Fatal(err)
+		}
+		c.cmd.TransformCursors(mat.Translate(1, 2, 3))
+		c.cmd.UnsetCursors()
+		if err := c.cmd.FinalizeCurrentMode(); err != nil {
+			t.Fatal(err)
+		}
+		expectPointCloud(t, c.cmd.editor.pp, vs)
+		if j, _ := c.cmd.Journal(); len(j) != 0 {
+			t.Error("Canceled transform must not be recorded in the history")
+		}
+	})
+	t.Run("NoSelection", func(t *testing.T) {
+		c := newTestConsole(t, vs...)
+		c.cmd.SetSelectMask(make([]uint32, len(vs)))
+		if _, err := c.Run("transform_selected 1 0 0 0 0 0", noUpdate); err == nil {
+			t.Error("Expected error without selection")
+		}
+		if err := c.cmd.BeginTransformSelected(); err == nil {
+			t.Error("Expected error without selection")
+		}
+	})
+}
@@ -1,40 +1,21 @@
+//go:build !js
 // +build !js
 
 package main
 
-import (
-	"github.com/seqsense/pcgol/pc"
-)
+// historyBufferMemory stores history payload on the Go heap.
+type historyBufferMemory []byte
 
-// historyDummy is a dummy history implementation for testing.
-type historyDummy struct {
-	latest *pc.PointCloud
+func newHistoryBuffer(b []byte) historyBuffer {
+	buf := make(historyBufferMemory, len(b))
+	copy(buf, b)
+	return &buf
 }
 
-func newHistory(_ int) history {
-	return &historyDummy{}
+func (b *historyBufferMemory) Bytes() []byte {
+	return *b
 }
 
-func (historyDummy) MaxHistory() int {
-	return 0
-}
-
-func (historyDummy) SetMaxHistory(_ int) {
-}
-
-func (h *historyDummy) push(pp *pc.PointCloud) *pc.PointCloud {
-	h.latest = pp
-	return pp
-}
-
-func (h *historyDummy) pop() *pc.PointCloud {
-	return h.latest
-}
-
-func (historyDummy) undo() (*pc.PointCloud, bool) {
-	return nil, false
-}
-
-func (h *historyDummy) clear() {
-	h.latest = nil
+func (b *historyBufferMemory) Release() {
+	*b = nil
 }